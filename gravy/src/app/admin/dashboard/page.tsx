@@ -1,8 +1,7 @@
 'use client';
 import { useEffect, useState } from 'react';
-import axios from 'axios';
 import { useAdminAuth } from '@/hooks/useAdminAuth';
-import { API_URL } from '@/config';
+import { useAdminClient } from '@/hooks/useAdminClient';
 import toast, { Toaster } from 'react-hot-toast';
 import { PlusIcon, PencilIcon, TrashIcon, ArchiveBoxIcon, ArrowDownTrayIcon } from '@heroicons/react/24/solid';
 import QRCode from 'qrcode';
@@ -25,6 +24,7 @@ type Shelf = {
 
 export default function AdminDashboard() {
     const { token, logout } = useAdminAuth();
+    const client = useAdminClient();
     const [books, setBooks] = useState<Book[]>([]);
     const [shelves, setShelves] = useState<Shelf[]>([]);
     const [isBookModalOpen, setIsBookModalOpen] = useState(false);
@@ -46,10 +46,9 @@ export default function AdminDashboard() {
 
     const fetchBooks = async (pageNum = 1) => {
         try {
-            const { data } = await axios.post(
-                `${API_URL}/book/all`,
-                { page: pageNum, limit: 10 },
-                { headers: { Authorization: `Bearer ${token}` } }
+            const { data } = await client.post(
+                '/book/all',
+                { page: pageNum, limit: 10 }
             );
             if (data.data) {
                 setBooks(data.data);
@@ -66,10 +65,9 @@ export default function AdminDashboard() {
 
     const fetchShelves = async () => {
         try {
-            const { data } = await axios.post(
-                `${API_URL}/shelf/all`,
-                {},
-                { headers: { Authorization: `Bearer ${token}` } }
+            const { data } = await client.post(
+                '/shelf/all',
+                {}
             );
             setShelves(data);
         } catch (error) {
@@ -80,10 +78,9 @@ export default function AdminDashboard() {
     const handleDeleteBook = async (id: string) => {
         if (!confirm('Are you sure you want to delete this book?')) return;
         try {
-            await axios.post(
-                `${API_URL}/book/delete`,
-                { book_id: id },
-                { headers: { Authorization: `Bearer ${token}` } }
+            await client.post(
+                '/book/delete',
+                { book_id: id }
             );
             toast.success('Book deleted');
             fetchBooks(page);
@@ -96,20 +93,18 @@ export default function AdminDashboard() {
         e.preventDefault();
         try {
             if (isEditing && currentBook.id) {
-                await axios.post(
-                    `${API_URL}/book/update`,
+                await client.post(
+                    '/book/update',
                     {
                         book_id: currentBook.id,
                         ...currentBook
-                    },
-                    { headers: { Authorization: `Bearer ${token}` } }
+                    }
                 );
                 toast.success('Book updated');
             } else {
-                await axios.post(
-                    `${API_URL}/book/create`,
-                    currentBook,
-                    { headers: { Authorization: `Bearer ${token}` } }
+                await client.post(
+                    '/book/create',
+                    currentBook
                 );
                 toast.success('Book created');
             }
@@ -124,17 +119,15 @@ export default function AdminDashboard() {
         e.preventDefault();
         try {
             if (currentShelfId) {
-                await axios.post(
-                    `${API_URL}/shelf/update`,
-                    { shelf_id: currentShelfId, address: newShelfAddress },
-                    { headers: { Authorization: `Bearer ${token}` } }
+                await client.post(
+                    '/shelf/update',
+                    { shelf_id: currentShelfId, address: newShelfAddress }
                 );
                 toast.success('Shelf updated');
             } else {
-                await axios.post(
-                    `${API_URL}/shelf/create`,
-                    { address: newShelfAddress },
-                    { headers: { Authorization: `Bearer ${token}` } }
+                await client.post(
+                    '/shelf/create',
+                    { address: newShelfAddress }
                 );
                 toast.success('Shelf created');
             }
@@ -148,17 +141,16 @@ export default function AdminDashboard() {
     };
 
     const handleDeleteShelf = async (id: string) => {
-        if (!confirm('Are you sure? This might act weird if books are in it.')) return;
+        if (!confirm('Are you sure? Shelves that still have books are not deleted.')) return;
         try {
-            await axios.post(
-                `${API_URL}/shelf/delete`,
-                { shelf_id: id },
-                { headers: { Authorization: `Bearer ${token}` } }
+            await client.post(
+                '/shelf/delete',
+                { shelf_id: id }
             );
             toast.success('Shelf deleted');
             fetchShelves();
         } catch (error: any) {
-            toast.error('Failed to delete shelf');
+            toast.error(error.response?.data?.error || 'Failed to delete shelf');
         }
     }
 
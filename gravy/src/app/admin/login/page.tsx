@@ -18,9 +18,14 @@ export default function AdminLogin() {
                 password,
             });
             localStorage.setItem('admin_token', data.token);
+            localStorage.setItem('admin_refresh_token', data.refresh_token);
             toast.success('Login Successful');
             router.push('/admin/dashboard');
         } catch (err) {
+            if (axios.isAxiosError(err) && err.response?.status === 429) {
+                toast.error(`Too many failed attempts, try again in ${err.response.data.retry_after}s`);
+                return;
+            }
             toast.error('Invalid Credentials');
         }
     };
@@ -1,5 +1,7 @@
 import { useEffect, useState } from 'react';
 import { useRouter } from 'next/navigation';
+import axios from 'axios';
+import { API } from '@/config';
 
 export const useAdminAuth = () => {
     const router = useRouter();
@@ -15,7 +17,14 @@ export const useAdminAuth = () => {
     }, [router]);
 
     const logout = () => {
+        const refreshToken = localStorage.getItem('admin_refresh_token');
+        if (refreshToken) {
+            axios
+                .post(`${API.BASE_URL}/auth/logout`, { refresh_token: refreshToken })
+                .catch((err) => console.log('Error logging out:', err));
+        }
         localStorage.removeItem('admin_token');
+        localStorage.removeItem('admin_refresh_token');
         router.replace('/admin/login');
     };
 
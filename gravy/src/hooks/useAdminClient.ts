@@ -1,19 +1,61 @@
-import { API } from "@/config";
-import axios from "axios";
-
-export const useAdminClient = () => {
-  let token: string | undefined | null;
-
-  if (typeof window !== "undefined") {
-    token = localStorage.getItem("admin_token");
-  }
-
-  const client = axios.create({
-    baseURL: API.BASE_URL,
-    headers: {
-      Authorization: `Bearer ${token}` || "",
-    },
-  });
-
-  return client;
-};
+import { API } from "@/config";
+import axios from "axios";
+
+// refresh tokens are single use, so concurrent 401s must share one refresh
+let refreshInFlight: Promise<string | null> | null = null;
+
+const refreshAdminToken = (): Promise<string | null> => {
+  if (!refreshInFlight) {
+    refreshInFlight = (async () => {
+      const refreshToken = localStorage.getItem("admin_refresh_token");
+      if (!refreshToken) {
+        return null;
+      }
+      try {
+        const { data } = await axios.post(`${API.BASE_URL}/auth/refresh`, {
+          refresh_token: refreshToken,
+        });
+        localStorage.setItem("admin_token", data.token);
+        localStorage.setItem("admin_refresh_token", data.refresh_token);
+        return data.token as string;
+      } catch {
+        localStorage.removeItem("admin_token");
+        localStorage.removeItem("admin_refresh_token");
+        return null;
+      }
+    })().finally(() => {
+      refreshInFlight = null;
+    });
+  }
+  return refreshInFlight;
+};
+
+export const useAdminClient = () => {
+  const client = axios.create({
+    baseURL: API.BASE_URL,
+  });
+
+  // read the token per request, so requests after a refresh use the new one
+  client.interceptors.request.use((config) => {
+    const token = localStorage.getItem("admin_token");
+    if (token) {
+      config.headers.Authorization = `Bearer ${token}`;
+    }
+    return config;
+  });
+
+  client.interceptors.response.use(undefined, async (error) => {
+    const original = error.config;
+    if (error.response?.status !== 401 || original?._retried) {
+      throw error;
+    }
+    original._retried = true;
+    if ((await refreshAdminToken()) == null) {
+      window.location.replace("/admin/login");
+      throw error;
+    }
+    return client(original);
+  });
+
+  return client;
+};
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+)
+
+func main() {
+	out := flag.String("out", "", "file to write (required)")
+	format := flag.String("format", "csv", "csv, jsonl, bibtex, marc or marcxml")
+	var filter services.BookFilter
+	flag.StringVar(&filter.Search, "search", "", "search query")
+	flag.StringVar(&filter.Genre, "genre", "", "genre filter")
+	flag.StringVar(&filter.Author, "author", "", "author filter")
+	flag.StringVar(&filter.Publisher, "publisher", "", "publisher filter")
+	flag.StringVar(&filter.ShelfID, "shelf-id", "", "shelf ID filter")
+	flag.IntVar(&filter.PublishedYear, "year", 0, "publication year filter")
+	flag.BoolVar(&filter.AvailableOnly, "available-only", false, "only books that are not on loan")
+	flag.Parse()
+
+	if *out == "" {
+		log.Println("Error: --out is required.")
+		flag.Usage()
+		return
+	}
+	if _, ok := services.ExportFormats[*format]; !ok {
+		log.Fatalf("Unsupported format %q", *format)
+	}
+
+	config.LoadEnv()
+	config.ConnectDB()
+	ctx := context.Background()
+
+	plan, err := services.PlanBookSearch(ctx, filter)
+	if err != nil {
+		log.Fatalf("Failed to search books: %v", err)
+	}
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", *out, err)
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	if err := services.ExportBooks(ctx, plan.Filter, *format, w); err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+	fmt.Printf("✅ Exported to %s\n", *out)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+)
+
+func main() {
+	config.LoadEnv()
+
+	keyType := flag.String("type", "ed25519", "Key type: ed25519 (EdDSA) or rsa (RS256)")
+	kid := flag.String("kid", time.Now().Format("2006-01-02"), "Key ID, used as the file name and the kid header")
+	dir := flag.String("dir", config.Env("JWT_KEYS_DIR", "keys"), "Directory holding the signing keys")
+
+	flag.Parse()
+
+	path, err := services.GenerateSigningKey(*dir, *kid, *keyType)
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+
+	fmt.Printf("✅ Successfully generated %s key!\n", *keyType)
+	fmt.Printf("   File: %s\n", path)
+	fmt.Printf("   Set JWT_ACTIVE_KID=%s to start signing with it. Keep the old key file\n", *kid)
+	fmt.Printf("   until its tokens have expired so they still verify.\n")
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func main() {
+	file := flag.String("file", "", "CSV file to import")
+	mapping := flag.String("mapping", "", `column mapping, e.g. "title=Book Title,shelf_address=Location"`)
+	dryRun := flag.Bool("dry-run", false, "validate every row without writing books")
+	chunkSize := flag.Int("chunk", services.DefaultImportChunkSize, "rows written per checkpoint")
+	resume := flag.String("resume", "", "ID of an interrupted import to continue")
+	errorsOut := flag.String("errors", "", "write the per-row error report to this CSV file")
+	flag.Parse()
+
+	if *file == "" && *resume == "" {
+		log.Println("Error: --file or --resume is required.")
+		flag.Usage()
+		return
+	}
+
+	config.LoadEnv()
+	config.ConnectDB()
+	ctx := context.Background()
+
+	var jobID bson.ObjectID
+	if *resume != "" {
+		id, err := bson.ObjectIDFromHex(*resume)
+		if err != nil {
+			log.Fatalf("Invalid import ID: %v", err)
+		}
+		jobID = id
+	} else {
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			log.Fatalf("Failed to read %s: %v", *file, err)
+		}
+		columns, err := services.ParseImportMapping(*mapping)
+		if err != nil {
+			log.Fatalf("Invalid mapping: %v", err)
+		}
+		job, err := services.CreateImportJob(ctx, models.ImportJob{
+			Format:    "csv",
+			FileName:  filepath.Base(*file),
+			Data:      data,
+			Mapping:   columns,
+			DryRun:    *dryRun,
+			ChunkSize: *chunkSize,
+			CreatedBy: "cli",
+		})
+		if err != nil {
+			log.Fatalf("Cannot import %s: %v", *file, err)
+		}
+		jobID = job.ID
+		fmt.Printf("Created import %s\n", jobID.Hex())
+	}
+
+	job, err := services.RunImportJob(ctx, jobID)
+	if err != nil {
+		log.Printf("Import stopped after %d rows: %v", job.ProcessedRows, err)
+		log.Fatalf("Continue it with --resume %s", jobID.Hex())
+	}
+	if job.DryRun {
+		fmt.Printf("Dry run: %d rows would be imported, %d have errors\n", job.Imported, job.Failed)
+	} else {
+		fmt.Printf("✅ Imported %d books, %d rows have errors\n", job.Imported, job.Failed)
+	}
+
+	if *errorsOut != "" && job.Failed > 0 {
+		out, err := os.Create(*errorsOut)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *errorsOut, err)
+		}
+		defer out.Close()
+		if err := services.WriteImportErrorsCSV(ctx, jobID, out); err != nil {
+			log.Fatalf("Failed to write error report: %v", err)
+		}
+		fmt.Printf("Error report written to %s\n", *errorsOut)
+	}
+}
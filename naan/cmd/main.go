@@ -4,6 +4,7 @@ import (
 	"log"
 
 	"sync"
+	"time"
 
 	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/contrib/websocket"
@@ -12,6 +13,7 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/pranava-mohan/library-automation-pre/naan/config"
 	"github.com/pranava-mohan/library-automation-pre/naan/server/routes"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
 )
 
 func UserStatusMiddleware() fiber.Handler {
@@ -21,10 +23,16 @@ func UserStatusMiddleware() fiber.Handler {
 			return fiber.ErrUnauthorized
 		}
 		claims := user.Claims.(jwt.MapClaims)
-		userType := claims["type"].(string)
+		// other tokens signed by naan (e.g. oauth state) carry no type or id
+		userType, _ := claims["type"].(string)
+		userID, _ := claims["id"].(string)
+		validType := userType == "admin" || userType == "normal" || userType == "kiosk"
+		if !validType || userID == "" {
+			return fiber.ErrUnauthorized
+		}
 
 		c.Locals("user_type", userType)
-		c.Locals("user_id", claims["id"].(string))
+		c.Locals("user_id", userID)
 
 		return c.Next()
 	}
@@ -51,6 +59,11 @@ type UserCheckInReq struct {
 
 func main() {
 	config.LoadEnv()
+	if err := services.LoadSigningKeys(); err != nil {
+		log.Fatalf("failed to load signing keys: %v", err)
+	}
+	services.LoadOIDCProviders()
+	services.LoadMetadataProviders()
 	app := fiber.New()
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
@@ -59,8 +72,15 @@ func main() {
 	}))
 
 	config.ConnectDB()
+	if err := services.LoadCoverStorage(); err != nil {
+		log.Fatalf("failed to load cover storage: %v", err)
+	}
+	services.StartSearchIndexRefresher(15 * time.Minute)
 
 	routes.InitAuth(app)
+	routes.InitOPDS(app)
+	routes.InitSRU(app)
+	routes.InitCover(app)
 	app.Get("/", func(c *fiber.Ctx) error {
 		return c.SendString("naan running")
 	})
@@ -77,9 +97,7 @@ func main() {
 		roomID := c.Params("id")
 		kioskToken := c.Query("token")
 
-		token, err := jwt.Parse(kioskToken, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.JWTSecret()), nil
-		})
+		token, err := services.ParseToken(kioskToken)
 		if err != nil || !token.Valid {
 			log.Println("Invalid kiosk token")
 			c.WriteJSON(fiber.Map{"error": "Invalid kiosk token"})
@@ -141,14 +159,19 @@ func main() {
 	}))
 
 	app.Use(jwtware.New(jwtware.Config{
-		SigningKey: jwtware.SigningKey{Key: []byte(config.JWTSecret())},
+		KeyFunc: services.VerificationKey,
 	}))
 	app.Use(UserStatusMiddleware())
 
+	routes.InitSession(app)
 	routes.InitUser(app)
 	routes.InitShelf(app)
+	routes.InitLocation(app)
 	routes.InitBook(app)
+	routes.InitSubject(app)
+	routes.InitTag(app)
 	routes.InitKiosk(app)
+	routes.InitAdmin(app)
 
 	app.Post("/check-in/:id", func(c *fiber.Ctx) error {
 		roomID := c.Params("id")
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: marc import -file records.mrc [-format marc|marcxml] [-shelf address | -shelf-id id] [-dry-run]")
+	fmt.Fprintln(os.Stderr, "       marc export -out books.xml [-format marc|marcxml] [-search q] [-genre g] [-author a]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "import":
+		importRecords(os.Args[2:])
+	case "export":
+		exportRecords(os.Args[2:])
+	default:
+		usage()
+	}
+}
+
+func importRecords(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	file := flags.String("file", "", "binary MARC or MARCXML file")
+	format := flags.String("format", "", "marc or marcxml (default from the file extension)")
+	shelf := flags.String("shelf", "", "shelf address for records without a 949 field")
+	shelfID := flags.String("shelf-id", "", "put every record on this shelf, in its free slots")
+	dryRun := flags.Bool("dry-run", false, "validate every record without writing books")
+	flags.Parse(args)
+	if *file == "" {
+		usage()
+	}
+	if *format == "" {
+		*format = "marc"
+		if filepath.Ext(*file) == ".xml" {
+			*format = "marcxml"
+		}
+	}
+
+	data, err := os.ReadFile(*file)
+	if err != nil {
+		log.Fatalf("Failed to read %s: %v", *file, err)
+	}
+	config.LoadEnv()
+	config.ConnectDB()
+	ctx := context.Background()
+
+	job := models.ImportJob{
+		Format:    *format,
+		FileName:  filepath.Base(*file),
+		Data:      data,
+		DryRun:    *dryRun,
+		CreatedBy: "cli",
+	}
+	if *shelf != "" {
+		job.Defaults = map[string]string{"shelf_address": *shelf}
+	}
+	if *shelfID != "" {
+		id, err := bson.ObjectIDFromHex(*shelfID)
+		if err != nil {
+			log.Fatalf("Invalid shelf ID %s", *shelfID)
+		}
+		job.ShelfID = &id
+	}
+	job, err = services.CreateImportJob(ctx, job)
+	if err != nil {
+		log.Fatalf("Cannot import %s: %v", *file, err)
+	}
+	job, err = services.RunImportJob(ctx, job.ID)
+	if err != nil {
+		log.Fatalf("Import stopped after %d records: %v (continue it with import_books --resume %s)", job.ProcessedRows, err, job.ID.Hex())
+	}
+	if job.DryRun {
+		fmt.Printf("Dry run: %d records would be imported, %d have errors\n", job.Imported, job.Failed)
+	} else {
+		fmt.Printf("✅ Imported %d records, %d have errors\n", job.Imported, job.Failed)
+	}
+	if job.Failed > 0 {
+		problems, err := services.ListImportErrors(ctx, job.ID, 0)
+		if err != nil {
+			log.Fatalf("Failed to list errors: %v", err)
+		}
+		for _, problem := range problems {
+			fmt.Printf("record %d\t%s\t%q\t%s\n", problem.Row, problem.Field, problem.Value, problem.Message)
+		}
+	}
+}
+
+func exportRecords(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("out", "", "file to write")
+	format := flags.String("format", "marcxml", "marc or marcxml")
+	var filter services.BookFilter
+	flags.StringVar(&filter.Search, "search", "", "search query")
+	flags.StringVar(&filter.Genre, "genre", "", "genre filter")
+	flags.StringVar(&filter.Author, "author", "", "author filter")
+	flags.StringVar(&filter.Publisher, "publisher", "", "publisher filter")
+	flags.StringVar(&filter.ShelfID, "shelf-id", "", "shelf ID filter")
+	flags.Parse(args)
+	if *out == "" {
+		usage()
+	}
+
+	config.LoadEnv()
+	config.ConnectDB()
+	ctx := context.Background()
+
+	plan, err := services.PlanBookSearch(ctx, filter)
+	if err != nil {
+		log.Fatalf("Failed to search books: %v", err)
+	}
+	w, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", *out, err)
+	}
+	defer w.Close()
+	buffered := bufio.NewWriter(w)
+	if err := services.ExportMARC(ctx, plan.Filter, *format, buffered); err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+	if err := buffered.Flush(); err != nil {
+		log.Fatalf("Export failed: %v", err)
+	}
+}
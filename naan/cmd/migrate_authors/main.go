@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+)
+
+func main() {
+	apply := flag.Bool("apply", false, "write contributor lists and authors (default only reports)")
+	flag.Parse()
+
+	config.LoadEnv()
+	config.ConnectDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	report, err := services.MigrateContributors(ctx, *apply)
+	if err != nil {
+		log.Fatalf("Failed to migrate authors: %v", err)
+	}
+
+	fmt.Printf("Checked %d books without contributors: %d without an author, %d split into several authors\n",
+		report.Checked, report.Missing, len(report.Split))
+	if *apply {
+		fmt.Printf("✅ Migrated %d books to contributor lists\n", report.Migrated)
+		if err := services.RebuildSuggestions(ctx); err != nil {
+			log.Printf("⚠️ failed to rebuild suggestions: %v", err)
+		}
+	} else {
+		fmt.Printf("%d books would be migrated, run with -apply to write them\n", report.Migrated)
+	}
+	for _, split := range report.Split {
+		fmt.Printf("%s\t%q\t%q\t%s\n", split.BookID.Hex(), split.Title, split.Author, strings.Join(split.Authors, " | "))
+	}
+}
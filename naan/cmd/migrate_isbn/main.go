@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+)
+
+func main() {
+	apply := flag.Bool("apply", false, "rewrite valid ISBNs to canonical ISBN-13 (default only reports)")
+	flag.Parse()
+
+	config.LoadEnv()
+	config.ConnectDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report, err := services.MigrateISBNs(ctx, *apply)
+	if err != nil {
+		log.Fatalf("Failed to migrate ISBNs: %v", err)
+	}
+
+	fmt.Printf("Checked %d books: %d canonical, %d without ISBN, %d invalid\n",
+		report.Checked, report.Canonical, report.Missing, len(report.Invalid))
+	if *apply {
+		fmt.Printf("✅ Normalized %d ISBNs to ISBN-13\n", report.Normalized)
+	} else {
+		fmt.Printf("%d ISBNs would be normalized, run with -apply to rewrite them\n", report.Normalized)
+	}
+	for _, issue := range report.Invalid {
+		fmt.Printf("%s\t%q\t%q\t%s\n", issue.BookID.Hex(), issue.Title, issue.ISBN, issue.Reason)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+)
+
+func main() {
+	apply := flag.Bool("apply", false, "write the missing sort fields (default only reports)")
+	flag.Parse()
+
+	config.LoadEnv()
+	config.ConnectDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	report, err := services.BackfillSortFields(ctx, *apply)
+	if err != nil {
+		log.Fatalf("Failed to backfill sort fields: %v", err)
+	}
+
+	verb := "would get"
+	if *apply {
+		verb = "got"
+	}
+	fmt.Printf("%d books %s title and author sort keys\n", report.Keyed, verb)
+	for _, field := range slices.Sorted(maps.Keys(report.Filled)) {
+		fmt.Printf("%d books %s a default %s\n", report.Filled[field], verb, field)
+	}
+	if !*apply {
+		fmt.Println("Run with -apply to write them")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+)
+
+func main() {
+	apply := flag.Bool("apply", false, "file books under subjects (default only reports)")
+	flag.Parse()
+
+	config.LoadEnv()
+	config.ConnectDB()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	report, err := services.MigrateSubjects(ctx, *apply)
+	if err != nil {
+		log.Fatalf("Failed to migrate subjects: %v", err)
+	}
+
+	fmt.Printf("Checked %d books without subjects: %d new subjects\n", report.Checked, len(report.Subjects))
+	if *apply {
+		fmt.Printf("✅ Filed %d books under subjects\n", report.Migrated)
+	} else {
+		fmt.Printf("%d books would be filed, run with -apply to write them\n", report.Migrated)
+	}
+	for _, subject := range report.Subjects {
+		fmt.Println(subject)
+	}
+}
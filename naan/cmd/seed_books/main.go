@@ -9,6 +9,7 @@ import (
 
 	"github.com/pranava-mohan/library-automation-pre/naan/config"
 	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
@@ -61,6 +62,20 @@ var realBooks = []BookData{
 	{"The Hitchhiker's Guide to the Galaxy", "Douglas Adams", "Science Fiction"},
 }
 
+type SeriesData struct {
+	Name   string
+	Number float64
+}
+
+var seriesOf = map[string]SeriesData{
+	"Harry Potter and the Sorcerer's Stone": {"Harry Potter", 1},
+	"A Game of Thrones":                     {"A Song of Ice and Fire", 1},
+	"The Hunger Games":                      {"The Hunger Games", 1},
+	"Dune":                                  {"Dune Chronicles", 1},
+	"Foundation":                            {"Foundation", 1},
+	"The Hitchhiker's Guide to the Galaxy":  {"The Hitchhiker's Guide to the Galaxy", 1},
+}
+
 func main() {
 
 	config.LoadEnv()
@@ -87,21 +102,37 @@ func main() {
 
 	fmt.Printf("Found %d shelves. Starting seed...\n", len(shelves))
 
+	contributorsOf := map[string][]models.Contributor{}
 	booksToInsert := make([]interface{}, 0, 100)
 	for i := 0; i < 100; i++ {
 		randomShelf := shelves[rand.Intn(len(shelves))]
 		randomBook := realBooks[rand.Intn(len(realBooks))]
 
+		contributors, ok := contributorsOf[randomBook.Author]
+		if !ok {
+			contributors, err = services.LinkContributors(ctx, services.ContributorsFromAuthorLine(randomBook.Author))
+			if err != nil {
+				log.Fatalf("Failed to save authors: %v", err)
+			}
+			contributorsOf[randomBook.Author] = contributors
+		}
+
+		author := services.ContributorAuthorLine(contributors)
 		book := models.Book{
-			Title:     randomBook.Title,
-			Author:    randomBook.Author,
-			Publisher: "Generic Publisher",
-			ISBN:      fmt.Sprintf("978-%d-%d-%d-%d", rand.Intn(10), rand.Intn(1000), rand.Intn(100), rand.Intn(10)),
-			Genre:     randomBook.Genre,
-			ShelfID:   randomShelf.ID,
-			AddedAt:   time.Now(),
-			Row:       rand.Intn(5) + 1,
-			Column:    rand.Intn(5) + 1,
+			Title:        randomBook.Title,
+			Author:       author,
+			TitleKey:     services.SortKey(randomBook.Title),
+			AuthorKey:    services.SortKey(author),
+			Contributors: contributors,
+			Series:       seriesOf[randomBook.Title].Name,
+			SeriesNumber: seriesOf[randomBook.Title].Number,
+			Publisher:    "Generic Publisher",
+			ISBN:         services.CompleteISBN13(fmt.Sprintf("978%09d", rand.Intn(1000000000))),
+			Genre:        randomBook.Genre,
+			ShelfID:      randomShelf.ID,
+			AddedAt:      time.Now(),
+			Row:          rand.Intn(5) + 1,
+			Column:       rand.Intn(5) + 1,
 		}
 		booksToInsert = append(booksToInsert, book)
 	}
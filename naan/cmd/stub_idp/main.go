@@ -0,0 +1,150 @@
+// stub_idp is a tiny OpenID Connect provider for local development. It signs
+// every login in as the same configured user without asking anything.
+//
+//	go run ./cmd/stub_idp -addr :9000 -email someone@example.com
+//
+// then point naan at it with OIDC_PROVIDERS=stub, OIDC_STUB_ISSUER=http://localhost:9000
+// and OIDC_STUB_CLIENT_ID=naan.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type pendingCode struct {
+	ClientID      string
+	Nonce         string
+	CodeChallenge string
+}
+
+func main() {
+	addr := flag.String("addr", ":9000", "Address to listen on")
+	issuer := flag.String("issuer", "http://localhost:9000", "Issuer URL, must match how naan reaches this server")
+	subject := flag.String("sub", "stub-user-1", "Subject of the signed in user")
+	email := flag.String("email", "patron@example.com", "Email of the signed in user")
+	name := flag.String("name", "Stub Patron", "Name of the signed in user")
+	verified := flag.Bool("verified", true, "Whether the email is reported as verified")
+
+	flag.Parse()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Fatalf("Failed to generate key: %v", err)
+	}
+
+	var mu sync.Mutex
+	codes := map[string]pendingCode{}
+
+	app := fiber.New()
+
+	app.Get("/.well-known/openid-configuration", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"issuer":                 *issuer,
+			"authorization_endpoint": *issuer + "/authorize",
+			"token_endpoint":         *issuer + "/token",
+			"userinfo_endpoint":      *issuer + "/userinfo",
+			"jwks_uri":               *issuer + "/jwks",
+		})
+	})
+
+	app.Get("/jwks", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"keys": []fiber.Map{{
+			"kty": "RSA",
+			"kid": "stub",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	app.Get("/authorize", func(c *fiber.Ctx) error {
+		redirectURI, err := url.Parse(c.Query("redirect_uri"))
+		if err != nil || redirectURI.Scheme == "" {
+			return c.Status(fiber.StatusBadRequest).SendString("invalid redirect_uri")
+		}
+		code := rand.Text()
+		mu.Lock()
+		codes[code] = pendingCode{
+			ClientID:      c.Query("client_id"),
+			Nonce:         c.Query("nonce"),
+			CodeChallenge: c.Query("code_challenge"),
+		}
+		mu.Unlock()
+
+		params := redirectURI.Query()
+		params.Set("code", code)
+		if state := c.Query("state"); state != "" {
+			params.Set("state", state)
+		}
+		redirectURI.RawQuery = params.Encode()
+		return c.Redirect(redirectURI.String())
+	})
+
+	app.Post("/token", func(c *fiber.Ctx) error {
+		mu.Lock()
+		pending, ok := codes[c.FormValue("code")]
+		delete(codes, c.FormValue("code"))
+		mu.Unlock()
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_grant"})
+		}
+		if pending.CodeChallenge != "" {
+			sum := sha256.Sum256([]byte(c.FormValue("code_verifier")))
+			if base64.RawURLEncoding.EncodeToString(sum[:]) != pending.CodeChallenge {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_grant"})
+			}
+		}
+
+		claims := jwt.MapClaims{
+			"iss":            *issuer,
+			"sub":            *subject,
+			"aud":            pending.ClientID,
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"iat":            time.Now().Unix(),
+			"email":          *email,
+			"email_verified": *verified,
+			"name":           *name,
+		}
+		if pending.Nonce != "" {
+			claims["nonce"] = pending.Nonce
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "stub"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "server_error"})
+		}
+		return c.JSON(fiber.Map{
+			"access_token": "stub-access-token",
+			"token_type":   "Bearer",
+			"id_token":     idToken,
+			"expires_in":   3600,
+		})
+	})
+
+	app.Get("/userinfo", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"sub":            *subject,
+			"email":          *email,
+			"email_verified": *verified,
+			"name":           *name,
+		})
+	})
+
+	fmt.Printf("stub identity provider for %s listening on %s\n", *email, *addr)
+	log.Fatal(app.Listen(*addr))
+}
@@ -35,6 +35,9 @@ func ConnectDB() {
 type IndexConfig struct {
 	Name  string
 	Model mongo.IndexModel
+	// Replaces names older versions of the index, dropped before it is
+	// created. A collection can only have one text index, for one.
+	Replaces []string
 }
 
 type CollectionConfig struct {
@@ -53,6 +56,13 @@ var Collections = []CollectionConfig{
 					Options: options.Index().SetUnique(true).SetSparse(true).SetName("email_1"),
 				},
 			},
+			{
+				Name: "identities_provider_subject_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+					Options: options.Index().SetUnique(true).SetSparse(true).SetName("identities_provider_subject_1"),
+				},
+			},
 		},
 	},
 	{
@@ -91,6 +101,222 @@ var Collections = []CollectionConfig{
 					Options: options.Index().SetName("isbn_1"),
 				},
 			},
+			{
+				Name: "books_text_v3",
+				Model: mongo.IndexModel{
+					Keys: bson.D{
+						{Key: "title", Value: "text"},
+						{Key: "contributors.name", Value: "text"},
+						{Key: "series", Value: "text"},
+						{Key: "genre", Value: "text"},
+						{Key: "subjects", Value: "text"},
+						{Key: "tags", Value: "text"},
+						{Key: "publisher", Value: "text"},
+					},
+					Options: options.Index().SetWeights(bson.D{
+						{Key: "title", Value: 10},
+						{Key: "contributors.name", Value: 6},
+						{Key: "series", Value: 5},
+						{Key: "genre", Value: 3},
+						{Key: "subjects", Value: 3},
+						{Key: "tags", Value: 2},
+						{Key: "publisher", Value: 1},
+					}).SetDefaultLanguage("english").SetName("books_text_v3"),
+				},
+				Replaces: []string{"books_text", "books_text_v2"},
+			},
+			{
+				Name: "title_key_id_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "title_key", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("title_key_id_1"),
+				},
+				Replaces: []string{"title_id_1"},
+			},
+			{
+				Name: "author_key_id_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "author_key", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("author_key_id_1"),
+				},
+				Replaces: []string{"author_id_1"},
+			},
+			{
+				Name: "added_at_id_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "added_at", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("added_at_id_1"),
+				},
+			},
+			{
+				Name: "loan_count_id_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "loan_count", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("loan_count_id_1"),
+				},
+			},
+			{
+				Name: "contributors_author_id_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "contributors.author_id", Value: 1}},
+					Options: options.Index().SetName("contributors_author_id_1"),
+				},
+			},
+			{
+				Name: "subject_tree_ids_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "subject_tree_ids", Value: 1}},
+					Options: options.Index().SetName("subject_tree_ids_1"),
+				},
+			},
+			{
+				Name: "tags_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "tags", Value: 1}},
+					Options: options.Index().SetName("tags_1"),
+				},
+			},
+			{
+				Name: "series_number_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "series", Value: 1}, {Key: "series_number", Value: 1}},
+					Options: options.Index().SetSparse(true).SetName("series_number_1"),
+				},
+			},
+			{
+				Name: "call_number_key_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "call_number_key", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("call_number_key_1"),
+				},
+			},
+			{
+				Name: "import_id_row_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "import_id", Value: 1}, {Key: "import_row", Value: 1}},
+					Options: options.Index().SetUnique(true).SetSparse(true).SetName("import_id_row_1"),
+				},
+			},
+		},
+	},
+	{
+		Name: "authors",
+		Indexes: []IndexConfig{
+			{
+				Name: "author_key_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "key", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("author_key_1"),
+				},
+			},
+			{
+				Name: "author_sort_name_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "sort_name", Value: 1}, {Key: "_id", Value: 1}},
+					Options: options.Index().SetName("author_sort_name_1"),
+				},
+			},
+		},
+	},
+	{
+		Name: "subjects",
+		Indexes: []IndexConfig{
+			{
+				Name: "subject_key_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "key", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("subject_key_1"),
+				},
+			},
+			{
+				Name: "subject_parent_id_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "parent_id", Value: 1}},
+					Options: options.Index().SetName("subject_parent_id_1"),
+				},
+			},
+			{
+				Name: "subject_ancestors_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "ancestors", Value: 1}},
+					Options: options.Index().SetName("subject_ancestors_1"),
+				},
+			},
+		},
+	},
+	{
+		Name: "locations",
+		Indexes: []IndexConfig{
+			{
+				// names are unique among the locations in one place
+				Name: "location_parent_id_key_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "parent_id", Value: 1}, {Key: "key", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("location_parent_id_key_1"),
+				},
+			},
+		},
+	},
+	{
+		Name: "shelves",
+		Indexes: []IndexConfig{
+			{
+				Name: "shelf_location_id_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "location_id", Value: 1}},
+					Options: options.Index().SetName("shelf_location_id_1"),
+				},
+			},
+		},
+	},
+	{
+		Name: "import_jobs",
+		Indexes: []IndexConfig{
+			{
+				Name: "import_created_at_-1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "created_at", Value: -1}},
+					Options: options.Index().SetName("import_created_at_-1"),
+				},
+			},
+		},
+	},
+	{
+		Name: "import_errors",
+		Indexes: []IndexConfig{
+			{
+				Name: "import_error_job_row_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "job_id", Value: 1}, {Key: "row", Value: 1}},
+					Options: options.Index().SetName("import_error_job_row_1"),
+				},
+			},
+		},
+	},
+	{
+		Name: "suggestions",
+		Indexes: []IndexConfig{
+			{
+				Name: "suggest_kind_key_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "key", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("suggest_kind_key_1"),
+				},
+			},
+			{
+				Name: "suggest_kind_tokens_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "kind", Value: 1}, {Key: "tokens", Value: 1}},
+					Options: options.Index().SetName("suggest_kind_tokens_1"),
+				},
+			},
+			{
+				Name: "suggest_built_at_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "built_at", Value: 1}},
+					Options: options.Index().SetName("suggest_built_at_1"),
+				},
+			},
 		},
 	},
 	{
@@ -112,6 +338,135 @@ var Collections = []CollectionConfig{
 			},
 		},
 	},
+	{
+		Name: "holds",
+		Indexes: []IndexConfig{
+			{
+				Name: "hold_book_id_status_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "book_id", Value: 1}, {Key: "status", Value: 1}},
+					Options: options.Index().SetName("hold_book_id_status_1"),
+				},
+			},
+		},
+	},
+	{
+		Name: "login_attempts",
+		Indexes: []IndexConfig{
+			{
+				Name: "login_key_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "key", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("login_key_1"),
+				},
+			},
+			{
+				// counters are forgotten a day after the last failed attempt
+				Name: "last_failure_at_ttl",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "last_failure_at", Value: 1}},
+					Options: options.Index().SetExpireAfterSeconds(24 * 60 * 60).SetName("last_failure_at_ttl"),
+				},
+			},
+		},
+	},
+	{
+		Name: "refresh_tokens",
+		Indexes: []IndexConfig{
+			{
+				Name: "token_hash_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "token_hash", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("token_hash_1"),
+				},
+			},
+			{
+				Name: "refresh_family_id_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "family_id", Value: 1}},
+					Options: options.Index().SetName("refresh_family_id_1"),
+				},
+			},
+			{
+				Name: "refresh_user_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "user_type", Value: 1}},
+					Options: options.Index().SetName("refresh_user_1"),
+				},
+			},
+			{
+				Name: "refresh_expires_at_ttl",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "expires_at", Value: 1}},
+					Options: options.Index().SetExpireAfterSeconds(0).SetName("refresh_expires_at_ttl"),
+				},
+			},
+		},
+	},
+	{
+		Name: "login_codes",
+		Indexes: []IndexConfig{
+			{
+				Name: "code_hash_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "code_hash", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("code_hash_1"),
+				},
+			},
+			{
+				Name: "login_code_expires_at_ttl",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "expires_at", Value: 1}},
+					Options: options.Index().SetExpireAfterSeconds(0).SetName("login_code_expires_at_ttl"),
+				},
+			},
+		},
+	},
+	{
+		Name: "metadata_cache",
+		Indexes: []IndexConfig{
+			{
+				Name: "metadata_isbn_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "isbn", Value: 1}},
+					Options: options.Index().SetUnique(true).SetName("metadata_isbn_1"),
+				},
+			},
+			{
+				Name: "metadata_expires_at_ttl",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "expires_at", Value: 1}},
+					Options: options.Index().SetExpireAfterSeconds(0).SetName("metadata_expires_at_ttl"),
+				},
+			},
+		},
+	},
+	{
+		Name: "audit_logs",
+		Indexes: []IndexConfig{
+			{
+				Name: "audit_created_at_-1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "created_at", Value: -1}},
+					Options: options.Index().SetName("audit_created_at_-1"),
+				},
+			},
+			{
+				Name: "audit_action_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "action", Value: 1}},
+					Options: options.Index().SetName("audit_action_1"),
+				},
+			},
+			{
+				Name: "audit_details_book_id_1",
+				Model: mongo.IndexModel{
+					Keys:    bson.D{{Key: "details.book_id", Value: 1}, {Key: "created_at", Value: -1}},
+					Options: options.Index().SetSparse(true).SetName("audit_details_book_id_1"),
+				},
+			},
+		},
+	},
 	{
 		Name: "kiosks",
 		Indexes: []IndexConfig{
@@ -169,9 +524,20 @@ func EnsureCollectionsAndIndexes(db *mongo.Database, collections []CollectionCon
 
 		toCreate := []mongo.IndexModel{}
 		for _, ic := range cfg.Indexes {
-			if !existingIdx[ic.Name] {
-				toCreate = append(toCreate, ic.Model)
+			if existingIdx[ic.Name] {
+				continue
+			}
+			for _, old := range ic.Replaces {
+				if !existingIdx[old] {
+					continue
+				}
+				if err := col.Indexes().DropOne(ctx, old); err != nil {
+					log.Printf("⚠️ failed to drop index %s on %s: %v", old, cfg.Name, err)
+				} else {
+					log.Printf("✅ dropped index %s on %s, replaced by %s", old, cfg.Name, ic.Name)
+				}
 			}
+			toCreate = append(toCreate, ic.Model)
 		}
 
 		if len(toCreate) > 0 {
@@ -209,10 +575,58 @@ func GetShelfCollection() *mongo.Collection {
 	return GetCollection("shelves")
 }
 
+func GetLocationCollection() *mongo.Collection {
+	return GetCollection("locations")
+}
+
 func GetHistoryCollection() *mongo.Collection {
 	return GetCollection("history")
 }
 
+func GetHoldCollection() *mongo.Collection {
+	return GetCollection("holds")
+}
+
 func GetKioskCollection() *mongo.Collection {
 	return GetCollection("kiosks")
 }
+
+func GetLoginAttemptCollection() *mongo.Collection {
+	return GetCollection("login_attempts")
+}
+
+func GetAuditLogCollection() *mongo.Collection {
+	return GetCollection("audit_logs")
+}
+
+func GetRefreshTokenCollection() *mongo.Collection {
+	return GetCollection("refresh_tokens")
+}
+
+func GetLoginCodeCollection() *mongo.Collection {
+	return GetCollection("login_codes")
+}
+
+func GetSuggestionCollection() *mongo.Collection {
+	return GetCollection("suggestions")
+}
+
+func GetMetadataCacheCollection() *mongo.Collection {
+	return GetCollection("metadata_cache")
+}
+
+func GetAuthorCollection() *mongo.Collection {
+	return GetCollection("authors")
+}
+
+func GetSubjectCollection() *mongo.Collection {
+	return GetCollection("subjects")
+}
+
+func GetImportJobCollection() *mongo.Collection {
+	return GetCollection("import_jobs")
+}
+
+func GetImportErrorCollection() *mongo.Collection {
+	return GetCollection("import_errors")
+}
@@ -22,7 +22,8 @@ func Env(key, defaultValue string) string {
 	return value
 }
 
-func JWTSecret() string {
-	secret := Env("JWT_SECRET", "my_secret_key")
-	return secret
+// IsDevMode is only true when explicitly asked for with APP_ENV=development.
+// It allows insecure conveniences like auto-generated signing keys.
+func IsDevMode() bool {
+	return Env("APP_ENV", "production") == "development"
 }
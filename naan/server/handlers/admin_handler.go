@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+func ListLockouts(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	lockouts, err := services.ListLockedLogins(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch lockouts",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"lockouts": lockouts,
+	})
+}
+
+type UnlockLoginReq struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+func UnlockLogin(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(UnlockLoginReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	if data.Kind != services.LoginKindUsername && data.Kind != services.LoginKindIP {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "kind must be username or ip",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	unlocked, err := services.ClearLoginFailures(ctx, services.LoginAttemptKey(data.Kind, data.Value))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to unlock",
+		})
+	}
+	if !unlocked {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "no failed attempts recorded",
+		})
+	}
+	services.Audit(c, "admin_login_unlocked", bson.M{"kind": data.Kind, "value": data.Value})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "unlocked successfully",
+	})
+}
+
+type GetAuditLogsReq struct {
+	Action string `json:"action"`
+	Limit  int64  `json:"limit"`
+	// BookID narrows the logs to one book, e.g. to trace its moves.
+	BookID string `json:"book_id"`
+}
+
+func GetAuditLogs(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(GetAuditLogsReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	limit := data.Limit
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	filter := bson.M{}
+	if data.Action != "" {
+		filter["action"] = data.Action
+	}
+	if data.BookID != "" {
+		filter["details.book_id"] = data.BookID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cursor, err := config.GetAuditLogCollection().Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch audit logs",
+		})
+	}
+	defer cursor.Close(ctx)
+
+	logs := []models.AuditLog{}
+	if err := cursor.All(ctx, &logs); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to decode audit logs",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(logs)
+}
+
+// GetISBNReport lists books whose stored ISBN is invalid, and how many would
+// be rewritten to the canonical ISBN-13 by cmd/migrate_isbn.
+func GetISBNReport(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	report, err := services.MigrateISBNs(ctx, false)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check ISBNs",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+// GetContributorReport lists the books whose author line cmd/migrate_authors
+// would split into several authors, and how many books it would migrate.
+func GetContributorReport(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	report, err := services.MigrateContributors(ctx, false)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check authors",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+// GetSubjectReport shows how many books cmd/migrate_subjects would file
+// under subjects and which subjects it would add to the vocabulary.
+func GetSubjectReport(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	report, err := services.MigrateSubjects(ctx, false)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check subjects",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(report)
+}
@@ -1,37 +1,23 @@
 package handlers
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
+	"errors"
 	"log"
-	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/pranava-mohan/library-automation-pre/naan/config"
 	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"golang.org/x/crypto/bcrypt"
 )
 
-type DauthUserRes struct {
-	AccessToken string `json:"access_token"`
-}
-
-type DauthFinalUserRes struct {
-	ID          json.Number `json:"id"`
-	Email       string      `json:"email"`
-	Gender      string      `json:"gender"`
-	Name        string      `json:"name"`
-	PhoneNumber string      `json:"phoneNumber"`
-}
-
 func checkPasswordHash(password, hash string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
 	return err == nil
@@ -47,197 +33,341 @@ func LoginAdmin(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
 	}
 
-	userCollection := config.GetAdminUserCollection()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
+
+	wait, err := services.LoginLockedFor(ctx,
+		services.LoginAttemptKey(services.LoginKindUsername, input.Username),
+		services.LoginAttemptKey(services.LoginKindIP, c.IP()),
+	)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if wait > 0 {
+		retryAfter := int(wait.Seconds()) + 1
+		services.Audit(c, "admin_login_blocked", bson.M{"username": input.Username})
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error":       "Too many failed attempts, try again later",
+			"retry_after": retryAfter,
+		})
+	}
+
+	userCollection := config.GetAdminUserCollection()
 	var user models.AdminUser
-	err := userCollection.FindOne(ctx, bson.M{"username": input.Username}).Decode(&user)
+	err = userCollection.FindOne(ctx, bson.M{"username": input.Username}).Decode(&user)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+		return failAdminLogin(ctx, c, input.Username, "unknown_username")
 	}
 
 	if !checkPasswordHash(input.Password, user.PasswordHash) {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+		return failAdminLogin(ctx, c, input.Username, "wrong_password")
 	}
 
-	claims := jwt.MapClaims{
-		"id":   user.ID.Hex(),
-		"exp":  time.Now().Add(time.Hour * 24 * 24).Unix(),
-		"type": "admin",
+	if _, err := services.ClearLoginFailures(ctx, services.LoginAttemptKey(services.LoginKindUsername, input.Username)); err != nil {
+		log.Printf("failed to clear login failures for %s: %v", input.Username, err)
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := token.SignedString([]byte(config.JWTSecret()))
+	tokens, err := services.IssueTokenPair(ctx, user.ID.Hex(), "admin", services.SessionFromRequest(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
 	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{"token": t})
+	return c.Status(fiber.StatusOK).JSON(tokens)
 }
 
-// Google OAuth2 Implementation
+type RefreshTokenReq struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func RefreshToken(c *fiber.Ctx) error {
+	data := new(RefreshTokenReq)
+	if err := c.BodyParser(data); err != nil || data.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-type GoogleTokenRes struct {
-	AccessToken string `json:"access_token"`
-	IDToken     string `json:"id_token"`
+	tokens, err := services.RotateRefreshToken(ctx, data.RefreshToken, services.SessionFromRequest(c))
+	if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReuse) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid refresh token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to refresh token"})
+	}
+	return c.Status(fiber.StatusOK).JSON(tokens)
 }
 
-type GoogleUserRes struct {
-	ID            string `json:"id"`
-	Email         string `json:"email"`
-	VerifiedEmail bool   `json:"verified_email"`
-	Name          string `json:"name"`
-	GivenName     string `json:"given_name"`
-	FamilyName    string `json:"family_name"`
-	Picture       string `json:"picture"`
+type ExchangeLoginCodeReq struct {
+	LoginCode string `json:"login_code"`
 }
 
-func googleStep1(code string) (string, error) {
-	token_url := "https://oauth2.googleapis.com/token"
-	data := url.Values{}
-	data.Set("code", code)
-	data.Set("client_id", config.Env("GOOGLE_CLIENT_ID", ""))
-	data.Set("client_secret", config.Env("GOOGLE_CLIENT_SECRET", ""))
-	data.Set("redirect_uri", config.Env("GOOGLE_REDIRECT_URL", "http://localhost:8000/auth/google"))
-	data.Set("grant_type", "authorization_code")
+// ExchangeLoginCode hands out the token pair for the one-time code the app
+// got back from a provider login.
+func ExchangeLoginCode(c *fiber.Ctx) error {
+	data := new(ExchangeLoginCodeReq)
+	if err := c.BodyParser(data); err != nil || data.LoginCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	req, err := http.NewRequest("POST", token_url, bytes.NewBufferString(data.Encode()))
+	tokens, err := services.RedeemLoginCode(ctx, data.LoginCode, services.SessionFromRequest(c))
+	if errors.Is(err, services.ErrInvalidLoginCode) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired login code"})
+	}
 	if err != nil {
-		return "", err
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to generate token"})
 	}
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+// Logout revokes the session behind the given refresh token. It does not
+// need a valid access token so that expired clients can still sign out.
+func Logout(c *fiber.Ctx) error {
+	data := new(RefreshTokenReq)
+	if err := c.BodyParser(data); err != nil || data.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
+	err := services.RevokeRefreshToken(ctx, data.RefreshToken)
+	if err != nil && !errors.Is(err, services.ErrInvalidRefreshToken) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to log out"})
 	}
-	defer resp.Body.Close()
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "logged out"})
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
+func LogoutAll(c *fiber.Ctx) error {
+	userType, _ := c.Locals("user_type").(string)
+	if userType != "admin" && userType != "normal" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized access"})
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	var googleTokenRes GoogleTokenRes
-	err = json.Unmarshal(body, &googleTokenRes)
+	revoked, err := services.RevokeAllRefreshTokens(ctx, services.GetUserID(c), userType)
 	if err != nil {
-		return "", err
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to log out"})
 	}
-	return googleTokenRes.AccessToken, nil
+	services.Audit(c, "logout_all", bson.M{"sessions_revoked": revoked})
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message":          "logged out everywhere",
+		"sessions_revoked": revoked,
+	})
 }
 
-func googleStep2(accessToken string) (GoogleUserRes, error) {
-	user_url := "https://www.googleapis.com/oauth2/v2/userinfo"
-	req, err := http.NewRequest("GET", user_url, nil)
-	client := &http.Client{}
-	if err != nil {
-		return GoogleUserRes{}, err
+// failAdminLogin counts the failure against both the username and the client
+// IP and writes it to the audit log before answering 401.
+func failAdminLogin(ctx context.Context, c *fiber.Ctx, username, reason string) error {
+	details := bson.M{"username": username, "reason": reason}
+	counters := map[string]string{
+		services.LoginKindUsername: username,
+		services.LoginKindIP:       c.IP(),
+	}
+	for kind, value := range counters {
+		attempt, err := services.RecordLoginFailure(ctx, kind, value)
+		if err != nil {
+			log.Printf("failed to record login failure for %s: %v", services.LoginAttemptKey(kind, value), err)
+			continue
+		}
+		if attempt.LockedUntil != nil {
+			details[kind+"_locked_until"] = *attempt.LockedUntil
+		}
 	}
-	req.Header.Set("Authorization", "Bearer "+accessToken)
+	services.Audit(c, "admin_login_failed", details)
+
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid credentials"})
+}
+
+// OpenID Connect login, see services.LoadOIDCProviders for configuration
+
+func ListLoginProviders(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"providers": services.ListOIDCProviders(),
+	})
+}
 
-	resp, err := client.Do(req)
+func LoginOIDC(c *fiber.Ctx) error {
+	provider, err := services.GetOIDCProvider(c.Params("provider"))
 	if err != nil {
-		return GoogleUserRes{}, err
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown login provider"})
+	}
+	redirectTo := c.Query("redirect_uri", config.Env("FRONTEND_AUTH_URL", "http://localhost:3000"))
+	if !services.IsAllowedRedirect(redirectTo) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Redirect target not allowed"})
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	binding, params, err := services.StartOAuthLogin(provider.Name, redirectTo)
 	if err != nil {
-		return GoogleUserRes{}, err
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to start login"})
 	}
+	setOAuthCookie(c, provider.Name, binding, time.Now().Add(10*time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	var userRes GoogleUserRes
-	err = json.Unmarshal(body, &userRes)
+	authURL, err := provider.AuthCodeURL(ctx, params)
 	if err != nil {
-		return GoogleUserRes{}, err
+		log.Printf("oidc %s: %v", provider.Name, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "Login provider unavailable"})
 	}
-
-	return userRes, nil
+	return c.Redirect(authURL)
 }
 
-func LoginGoogle(c *fiber.Ctx) error {
-	clientID := config.Env("GOOGLE_CLIENT_ID", "")
-	redirectURI := config.Env("GOOGLE_REDIRECT_URL", "http://localhost:8000/auth/google")
-	baseURL := "https://accounts.google.com/o/oauth2/v2/auth"
+func OIDCCallback(c *fiber.Ctx) error {
+	provider, err := services.GetOIDCProvider(c.Params("provider"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Unknown login provider"})
+	}
+	if providerErr := c.Query("error"); providerErr != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Login failed: " + providerErr})
+	}
+	binding := c.Cookies(oauthCookieName(provider.Name))
+	setOAuthCookie(c, provider.Name, "", time.Unix(0, 0))
 
-	params := url.Values{}
-	params.Add("client_id", clientID)
-	params.Add("redirect_uri", redirectURI)
-	params.Add("response_type", "code")
-	params.Add("scope", "https://www.googleapis.com/auth/userinfo.email https://www.googleapis.com/auth/userinfo.profile")
-	params.Add("access_type", "offline")
+	login, extra, err := services.FinishOAuthLogin(provider.Name, c.Query("state"), binding)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid or expired login state, please try again"})
+	}
 
-	finalURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
-	return c.Redirect(finalURL)
-}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
 
-func GoogleCallback(c *fiber.Ctx) error {
-	code := c.Query("code")
+	identity, err := provider.Exchange(ctx, c.Query("code"), login.Nonce, extra)
+	if err != nil {
+		log.Printf("oidc %s: %v", provider.Name, err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Failed to verify login"})
+	}
 
-	accessToken, err := googleStep1(code)
+	user, err := findOrCreateOIDCUser(ctx, identity)
+	if errors.Is(err, errEmailNotVerified) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "An account with this email already exists, verify the email with " + provider.DisplayName + " to link it",
+		})
+	}
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to exchange code for token: " + err.Error()})
+		log.Printf("findOrInsert error: %v", err)
+		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
 	}
-	userRes, err := googleStep2(accessToken)
+
+	code, err := services.IssueLoginCode(ctx, user.ID.Hex(), "normal")
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to get user info: " + err.Error()})
+		return c.Status(500).JSON(fiber.Map{"error": "Token generation error"})
 	}
 
-	var user models.User
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	finalURL, err := url.Parse(login.RedirectTo)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid redirect target"})
+	}
+	// the app trades the code for tokens at /auth/exchange
+	params := finalURL.Query()
+	params.Set("login_code", code)
+	finalURL.RawQuery = params.Encode()
+
+	return c.Redirect(finalURL.String())
+}
 
+func oauthCookieName(provider string) string {
+	return "naan_oauth_" + provider
+}
+
+// the cookie binds the login to the browser that started it, it is scoped to
+// the callback path and has to survive the top-level redirect back from the
+// provider, hence Lax
+func setOAuthCookie(c *fiber.Ctx, provider, value string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     oauthCookieName(provider),
+		Value:    value,
+		Path:     "/auth/" + provider,
+		Expires:  expires,
+		HTTPOnly: true,
+		Secure:   c.Protocol() == "https",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+var errEmailNotVerified = errors.New("email not verified by provider")
+
+// findOrCreateOIDCUser resolves the provider identity to a user. Identities
+// are only linked to an existing account by email when the provider says the
+// email is verified, otherwise anyone could claim someone else's account.
+func findOrCreateOIDCUser(ctx context.Context, identity services.OIDCIdentity) (models.User, error) {
 	userCollection := config.GetUserCollection()
-	// match by google_id OR email to link existing accounts
-	filter := bson.M{
-		"$or": []bson.M{
-			{"google_id": userRes.ID},
-			{"email": userRes.Email},
-		},
-	}
-
-	err = userCollection.FindOne(ctx, filter).Decode(&user)
-
-	update := bson.M{
-		"$set": bson.M{
-			"google_id": userRes.ID,
-			"name":      userRes.Name,
-			"email":     userRes.Email,
-			"picture":   userRes.Picture,
-		},
-		"$setOnInsert": bson.M{
-			"createdAt": time.Now(),
-		},
-	}
-
-	opts := options.FindOneAndUpdate().
-		SetUpsert(true).
-		SetReturnDocument(options.After)
-	user_err := userCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&user)
-	if user_err != nil {
-		log.Printf("findOrInsert error: %v", user_err)
-		return c.Status(500).JSON(fiber.Map{"error": "Database error"})
+	var user models.User
+
+	filters := []bson.M{{
+		"identities": bson.M{"$elemMatch": bson.M{
+			"provider": identity.Provider,
+			"subject":  identity.Subject,
+		}},
+	}}
+	if identity.Provider == "google" {
+		// accounts created before OIDC only stored the google id
+		filters = append(filters, bson.M{"google_id": identity.Subject})
 	}
 
-	claims := jwt.MapClaims{
-		"id":   user.ID.Hex(),
-		"exp":  time.Now().Add(time.Hour * 24 * 24).Unix(),
-		"type": "normal",
+	profile := bson.M{"name": identity.Name, "picture": identity.Picture}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := userCollection.FindOneAndUpdate(ctx, bson.M{"$or": filters}, bson.M{"$set": profile}, opts).Decode(&user)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return user, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	linked := models.UserIdentity{
+		Provider: identity.Provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+		LinkedAt: time.Now(),
+	}
 
-	t, err := token.SignedString([]byte(config.JWTSecret()))
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Token generation error"})
+	if identity.Email != "" {
+		if identity.LinkEmail() == "" {
+			count, err := userCollection.CountDocuments(ctx, bson.M{"email": identity.Email})
+			if err != nil {
+				return user, err
+			}
+			if count > 0 {
+				return user, errEmailNotVerified
+			}
+		} else {
+			err = userCollection.FindOneAndUpdate(ctx, bson.M{"email": identity.LinkEmail()}, bson.M{
+				"$push": bson.M{"identities": linked},
+			}, opts).Decode(&user)
+			if err == nil {
+				return user, nil
+			}
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				return user, err
+			}
+		}
 	}
 
-	frontendURL := config.Env("FRONTEND_AUTH_URL", "http://localhost:3000")
-	params := url.Values{}
-	params.Add("token", t)
+	newUser := bson.M{
+		"name":       identity.Name,
+		"picture":    identity.Picture,
+		"identities": []models.UserIdentity{linked},
+		"createdAt":  time.Now(),
+	}
+	// an unverified email is not stored so it can't be used to link later
+	if email := identity.LinkEmail(); email != "" {
+		newUser["email"] = email
+	}
+	result, err := userCollection.InsertOne(ctx, newUser)
+	if err != nil {
+		return user, err
+	}
+	err = userCollection.FindOne(ctx, bson.M{"_id": result.InsertedID}).Decode(&user)
+	return user, err
+}
 
-	finalURL := fmt.Sprintf("%s?%s", frontendURL, params.Encode())
-	return c.Redirect(finalURL)
+func GetJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(services.PublicJWKS())
 }
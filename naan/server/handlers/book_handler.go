@@ -2,6 +2,9 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -13,14 +16,59 @@ import (
 )
 
 type CreateBookReq struct {
-	Title     string `json:"title"`
-	Author    string `json:"author"`
-	Publisher string `json:"publisher"`
-	ISBN      string `json:"isbn"`
-	Genre     string `json:"genre"`
-	ShelfID   string `json:"shelf_id"`
-	Row       int    `json:"row"`
-	Column    int    `json:"column"`
+	Title         string   `json:"title"`
+	Author        string   `json:"author"`
+	Publisher     string   `json:"publisher"`
+	ISBN          string   `json:"isbn"`
+	Genre         string   `json:"genre"`
+	PublishedYear int      `json:"published_year"`
+	Subjects      []string `json:"subjects"`
+	PageCount     int      `json:"page_count"`
+	CoverURL      string   `json:"cover_url"`
+	ShelfID       string   `json:"shelf_id"`
+	Row           int      `json:"row"`
+	Column        int      `json:"column"`
+	Series        string   `json:"series"`
+	SeriesNumber  float64  `json:"series_number"`
+	// Contributors credits authors, editors, translators and illustrators;
+	// without it the names in Author are credited as authors.
+	Contributors []models.Contributor `json:"contributors"`
+	// Enrich fills empty fields from the ISBN's metadata, defaulting to
+	// ENRICH_ON_CREATE.
+	Enrich *bool `json:"enrich,omitempty"`
+	// Tags are librarian labels such as "staff pick", kept apart from the
+	// subject vocabulary.
+	Tags []string `json:"tags"`
+	// CallNumber is a Dewey or Library of Congress call number.
+	CallNumber string `json:"call_number"`
+}
+
+// applyMetadata fills in the fields the cataloguer left empty.
+func (data *CreateBookReq) applyMetadata(metadata models.BookMetadata) {
+	if data.Title == "" {
+		data.Title = metadata.Title
+	}
+	if data.Author == "" && len(data.Contributors) == 0 {
+		data.Author = services.AuthorLine(metadata.Authors)
+	}
+	if data.Publisher == "" {
+		data.Publisher = metadata.Publisher
+	}
+	if data.Genre == "" && len(metadata.Subjects) > 0 {
+		data.Genre = metadata.Subjects[0]
+	}
+	if data.PublishedYear == 0 {
+		data.PublishedYear = metadata.PublishedYear
+	}
+	if len(data.Subjects) == 0 {
+		data.Subjects = metadata.Subjects
+	}
+	if data.PageCount == 0 {
+		data.PageCount = metadata.PageCount
+	}
+	if data.CoverURL == "" {
+		data.CoverURL = metadata.CoverURL
+	}
 }
 
 func CreateBook(c *fiber.Ctx) error {
@@ -42,10 +90,47 @@ func CreateBook(c *fiber.Ctx) error {
 			"error": "invalid shelf ID",
 		})
 	}
+	if data.ISBN != "" {
+		isbn, err := services.NormalizeISBN(data.ISBN)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		data.ISBN = isbn
+	}
+	var callNumber services.CallNumber
+	if data.CallNumber != "" {
+		parsed, err := services.ParseCallNumber(data.CallNumber)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		callNumber = parsed
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	enrich := services.EnrichOnCreate()
+	if data.Enrich != nil {
+		enrich = *data.Enrich
+	}
+	if enrich && data.ISBN != "" {
+		enrichCtx, cancelEnrich := context.WithTimeout(ctx, services.EnrichTimeout)
+		metadata, err := services.LookupMetadata(enrichCtx, data.ISBN)
+		cancelEnrich()
+		if err == nil {
+			data.applyMetadata(metadata)
+		} else if !errors.Is(err, services.ErrMetadataNotFound) {
+			log.Printf("⚠️ failed to enrich %s: %v", data.ISBN, err)
+		}
+	}
+
+	if err := services.CheckPlacement(ctx, shelfIdObjID, data.Row, data.Column); err != nil {
+		return locationError(c, err, "failed to fetch shelf")
+	}
 	var existingBook bson.M
 	bookCollection.FindOne(ctx, bson.M{
 		"shelf_id": shelfIdObjID,
@@ -58,16 +143,55 @@ func CreateBook(c *fiber.Ctx) error {
 		})
 	}
 
+	contributors, err := services.BookContributors(data.Contributors, data.Author)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	contributors, err = services.LinkContributors(ctx, contributors)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save authors",
+		})
+	}
+	data.Author = services.ContributorAuthorLine(contributors)
+	// the genre is filed as a subject too, as the subject migration does
+	subjects, err := services.BookSubjects(ctx, append([]string{data.Genre}, data.Subjects...))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to save subjects",
+		})
+	}
+
 	newBook := bson.M{
-		"title":     data.Title,
-		"author":    data.Author,
-		"publisher": data.Publisher,
-		"isbn":      data.ISBN,
-		"genre":     data.Genre,
-		"shelf_id":  shelfIdObjID,
-		"added_at":  time.Now(),
-		"row":       data.Row,
-		"column":    data.Column,
+		"title":          data.Title,
+		"author":         data.Author,
+		"title_key":      services.SortKey(data.Title),
+		"author_key":     services.SortKey(data.Author),
+		"contributors":   contributors,
+		"series":         strings.TrimSpace(data.Series),
+		"series_number":  data.SeriesNumber,
+		"publisher":      data.Publisher,
+		"isbn":           data.ISBN,
+		"genre":          data.Genre,
+		"shelf_id":       shelfIdObjID,
+		"published_year": data.PublishedYear,
+		"page_count":     data.PageCount,
+		"cover_url":      data.CoverURL,
+		"added_at":       time.Now(),
+		"loan_count":     0,
+		"row":            data.Row,
+		"column":         data.Column,
+		"tags":           services.NormalizeTags(data.Tags),
+		// sorting by call number needs every book to have a key
+		"call_number_key": callNumber.Key,
+	}
+	if callNumber.Key != "" {
+		newBook["call_number"] = callNumber.Normalized
+	}
+	for field, value := range subjects {
+		newBook[field] = value
 	}
 	result, insertErr := bookCollection.InsertOne(ctx, newBook)
 	if insertErr != nil {
@@ -75,6 +199,7 @@ func CreateBook(c *fiber.Ctx) error {
 			"error": "failed to create book",
 		})
 	}
+	services.AddBookSuggestions(ctx, models.Book{Title: data.Title, Contributors: contributors, Series: data.Series})
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "book created successfully",
 		"book_id": result.InsertedID.(bson.ObjectID).Hex(),
@@ -82,15 +207,28 @@ func CreateBook(c *fiber.Ctx) error {
 }
 
 type UpdateBookReq struct {
-	BookID    string `json:"book_id"`
-	Title     string `json:"title,omitempty"`
-	Author    string `json:"author,omitempty"`
-	Publisher string `json:"publisher,omitempty"`
-	ISBN      string `json:"isbn,omitempty"`
-	Genre     string `json:"genre,omitempty"`
-	ShelfID   string `json:"shelf_id,omitempty"`
-	Row       int    `json:"row,omitempty"`
-	Column    int    `json:"column,omitempty"`
+	BookID        string   `json:"book_id"`
+	Title         string   `json:"title,omitempty"`
+	Author        string   `json:"author,omitempty"`
+	Publisher     string   `json:"publisher,omitempty"`
+	ISBN          string   `json:"isbn,omitempty"`
+	Genre         string   `json:"genre,omitempty"`
+	PublishedYear int      `json:"published_year,omitempty"`
+	Subjects      []string `json:"subjects,omitempty"`
+	PageCount     int      `json:"page_count,omitempty"`
+	CoverURL      string   `json:"cover_url,omitempty"`
+	ShelfID       string   `json:"shelf_id,omitempty"`
+	Row           int      `json:"row,omitempty"`
+	Column        int      `json:"column,omitempty"`
+	Series        string   `json:"series,omitempty"`
+	SeriesNumber  float64  `json:"series_number,omitempty"`
+	// Contributors replaces the credited people; a new Author line alone
+	// replaces them with its names as authors.
+	Contributors []models.Contributor `json:"contributors,omitempty"`
+	// Subjects and Tags replace the book's lists when present; an empty list
+	// clears them.
+	Tags       []string `json:"tags,omitempty"`
+	CallNumber string   `json:"call_number,omitempty"`
 }
 
 func UpdateBook(c *fiber.Ctx) error {
@@ -118,7 +256,7 @@ func UpdateBook(c *fiber.Ctx) error {
 
 	var existingBook models.Book
 	bookCollection.FindOne(ctx, bson.M{
-		"book_id": bookID,
+		"_id": bookID,
 	}).Decode(&existingBook)
 	if existingBook.ID.IsZero() {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -126,25 +264,101 @@ func UpdateBook(c *fiber.Ctx) error {
 		})
 	}
 
-	update := bson.M{
-		"row":    data.Row,
-		"column": data.Column,
-	}
+	update := bson.M{}
 	if data.Title != "" {
 		update["title"] = data.Title
+		update["title_key"] = services.SortKey(data.Title)
+	}
+	suggested := models.Book{Title: data.Title, Series: data.Series}
+	if data.Author != "" || len(data.Contributors) > 0 {
+		contributors, err := services.BookContributors(data.Contributors, data.Author)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		contributors, err = services.LinkContributors(ctx, contributors)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to save authors",
+			})
+		}
+		author := services.ContributorAuthorLine(contributors)
+		update["contributors"] = contributors
+		update["author"] = author
+		update["author_key"] = services.SortKey(author)
+		suggested.Contributors = contributors
 	}
-	if data.Author != "" {
-		update["author"] = data.Author
+	if data.Series != "" {
+		update["series"] = strings.TrimSpace(data.Series)
+	}
+	if data.SeriesNumber != 0 {
+		update["series_number"] = data.SeriesNumber
 	}
 	if data.Publisher != "" {
 		update["publisher"] = data.Publisher
 	}
 	if data.ISBN != "" {
-		update["isbn"] = data.ISBN
+		isbn, err := services.NormalizeISBN(data.ISBN)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		update["isbn"] = isbn
 	}
 	if data.Genre != "" {
 		update["genre"] = data.Genre
 	}
+	if data.PublishedYear != 0 {
+		update["published_year"] = data.PublishedYear
+	}
+	// the genre is filed as a subject too, as CreateBook does, so a new
+	// genre replaces the old one in the subjects the book keeps
+	if data.Subjects != nil || data.Genre != "" {
+		genre, names := existingBook.Genre, data.Subjects
+		if data.Genre != "" {
+			genre = data.Genre
+		}
+		if names == nil {
+			names = make([]string, 0, len(existingBook.Subjects))
+			for _, name := range existingBook.Subjects {
+				if services.SubjectKey(name) != services.SubjectKey(existingBook.Genre) {
+					names = append(names, name)
+				}
+			}
+		}
+		subjects, err := services.BookSubjects(ctx, append([]string{genre}, names...))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to save subjects",
+			})
+		}
+		for field, value := range subjects {
+			update[field] = value
+		}
+	}
+	if data.Tags != nil {
+		update["tags"] = services.NormalizeTags(data.Tags)
+	}
+	if data.CallNumber != "" {
+		callNumber, err := services.ParseCallNumber(data.CallNumber)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		update["call_number"] = callNumber.Normalized
+		update["call_number_key"] = callNumber.Key
+	}
+	if data.PageCount != 0 {
+		update["page_count"] = data.PageCount
+	}
+	if data.CoverURL != "" {
+		update["cover_url"] = data.CoverURL
+	}
+	// fields left out of the request keep the book where it is
+	shelfID, row, column := existingBook.ShelfID, existingBook.Row, existingBook.Column
 	if data.ShelfID != "" {
 		shelfIdObjID, shelfIDErr := bson.ObjectIDFromHex(data.ShelfID)
 		if shelfIDErr != nil {
@@ -152,21 +366,27 @@ func UpdateBook(c *fiber.Ctx) error {
 				"error": "invalid shelf ID",
 			})
 		}
-		update["shelf_id"] = shelfIdObjID
+		shelfID = shelfIdObjID
 	}
 	if data.Row != 0 {
-		update["row"] = data.Row
+		row = data.Row
 	}
 	if data.Column != 0 {
-		update["column"] = data.Column
+		column = data.Column
 	}
+	if err := services.CheckPlacement(ctx, shelfID, row, column); err != nil {
+		return locationError(c, err, "failed to fetch shelf")
+	}
+	update["shelf_id"] = shelfID
+	update["row"] = row
+	update["column"] = column
 	// check if smthg is already there in that specified row/col in shelf
-	if shelfID, ok := update["shelf_id"]; ok {
+	if shelfID != existingBook.ShelfID || row != existingBook.Row || column != existingBook.Column {
 		var bookAtPosition bson.M
 		bookCollection.FindOne(c.Context(), bson.M{
 			"shelf_id": shelfID,
-			"row":      update["row"],
-			"column":   update["column"],
+			"row":      row,
+			"column":   column,
 			"_id":      bson.M{"$ne": bookID},
 		}).Decode(&bookAtPosition)
 		if bookAtPosition != nil {
@@ -184,12 +404,82 @@ func UpdateBook(c *fiber.Ctx) error {
 			"error": "failed to update book",
 		})
 	}
+	services.AddBookSuggestions(ctx, suggested)
+	move := services.BookMove{
+		BookID:     bookID,
+		Title:      existingBook.Title,
+		FromShelf:  existingBook.ShelfID,
+		FromRow:    existingBook.Row,
+		FromColumn: existingBook.Column,
+		ToShelf:    shelfID,
+		ToRow:      row,
+		ToColumn:   column,
+	}
+	if move.ToShelf != move.FromShelf || move.ToRow != move.FromRow || move.ToColumn != move.FromColumn {
+		services.Audit(c, "book_moved", move.AuditDetails(services.MoveUpdate))
+	}
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "book updated successfully",
 	})
 }
 
+type PreviewISBNReq struct {
+	ISBN    string `json:"isbn"`
+	Refresh bool   `json:"refresh"`
+}
+
+// PreviewISBN shows what creating a book with this ISBN and enrichment on
+// would fill in, without saving anything.
+func PreviewISBN(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(PreviewISBNReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	isbn, err := services.NormalizeISBN(data.ISBN)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	if data.Refresh {
+		if err := services.DeleteCachedMetadata(ctx, isbn); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to clear cached metadata",
+			})
+		}
+	}
+	metadata, err := services.LookupMetadata(ctx, isbn)
+	if errors.Is(err, services.ErrMetadataNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "no metadata found for ISBN " + isbn,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "metadata providers are unavailable",
+		})
+	}
+
+	book := CreateBookReq{ISBN: isbn}
+	book.applyMetadata(metadata)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"metadata": metadata,
+		"book":     book,
+	})
+}
+
 type DeleteBookReq struct {
 	BookID string `json:"book_id"`
 }
@@ -215,6 +505,9 @@ func DeleteBook(c *fiber.Ctx) error {
 			"error": "invalid book ID",
 		})
 	}
+	if err := services.DeleteCover(ctx, bookID); err != nil && !errors.Is(err, services.ErrCoverBook) {
+		log.Printf("⚠️ failed to delete cover of book %s: %v", bookID.Hex(), err)
+	}
 	_, deleteErr := bookCollection.DeleteOne(ctx, bson.M{"_id": bookID})
 	if deleteErr != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -260,9 +553,54 @@ func GetBook(c *fiber.Ctx) error {
 			"error": "book not found",
 		})
 	}
+	book.CoverURLs = services.CoverURLs(c.BaseURL(), models.Book{ID: book.ID, Cover: book.Cover, CoverURL: book.CoverURL})
 	return c.Status(fiber.StatusOK).JSON(book)
 }
 
+type GetBookDetailReq struct {
+	BookID string `json:"book_id"`
+}
+
+// GetBookDetail is the patron facing book page: the full record, where it
+// is shelved, whether it is on loan and until when, the length of its
+// hold queue and the other copies of the title.
+func GetBookDetail(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) && !services.IsNormalUser(c) && !services.IsKiosk(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(GetBookDetailReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	bookID, err := bson.ObjectIDFromHex(data.BookID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid book ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	detail, err := services.GetBookDetail(ctx, bookID, services.IsAdmin(c))
+	if errors.Is(err, services.ErrBookNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "book not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to get book",
+		})
+	}
+	detail.CoverURLs = services.CoverURLs(c.BaseURL(), detail.Book)
+	return c.Status(fiber.StatusOK).JSON(detail)
+}
+
 type CheckInBooksReq struct {
 	BookIDs []string `json:"book_ids"`
 	UserID  string   `json:"user_id"`
@@ -313,6 +651,9 @@ func CheckInBooks(c *fiber.Ctx) error {
 			"$set": bson.M{
 				"taken_by_user_id": userID,
 			},
+			"$inc": bson.M{
+				"loan_count": 1,
+			},
 		})
 		if updateErr != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -410,19 +751,26 @@ func ReturnBooks(c *fiber.Ctx) error {
 }
 
 type GetAllBooksReq struct {
-	Page          int64  `json:"page"`
-	Limit         int64  `json:"limit"`
-	AvailableOnly bool   `json:"available_only"`
-	Genre         string `json:"genre"`
-	Author        string `json:"author"`
-	Publisher     string `json:"publisher"`
-	ShelfID       string `json:"shelf_id"`
-	Search        string `json:"search"`
+	// Page switches to numbered pages, otherwise Cursor from the previous
+	// response's next_cursor continues the listing.
+	Page         int64  `json:"page"`
+	Cursor       string `json:"cursor"`
+	Limit        int64  `json:"limit"`
+	Sort         string `json:"sort"`
+	IncludeTotal bool   `json:"include_total"`
+	Facets       bool   `json:"facets"`
+	FacetLimit   int    `json:"facet_limit"`
+	services.BookFilter
 }
 
 type BookWithShelf struct {
 	models.Book  `bson:",inline"`
-	ShelfAddress string `bson:"shelf_address" json:"shelf_address"`
+	ShelfAddress string                                 `bson:"shelf_address" json:"shelf_address"`
+	Score        float64                                `bson:"score,omitempty" json:"score,omitempty"`
+	SortValue    any                                    `bson:"sort_value,omitempty" json:"-"`
+	Highlights   map[string][]services.HighlightSegment `bson:"-" json:"highlights,omitempty"`
+	CoverURLs    map[string]string                      `bson:"-" json:"cover_urls,omitempty"`
+	LocationPath []models.LocationCrumb                 `bson:"location_path" json:"location_path"`
 }
 
 func GetAllBooks(c *fiber.Ctx) error {
@@ -439,78 +787,57 @@ func GetAllBooks(c *fiber.Ctx) error {
 		})
 	}
 
-	page := req.Page
-	if page <= 0 {
-		page = 1
-	}
 	limit := req.Limit
 	if limit <= 0 {
 		limit = 10
 	}
-	skip := (page - 1) * limit
+	if limit > 100 {
+		limit = 100
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	bookCollection := config.GetBookCollection()
 
-	filter := bson.M{}
-	if req.AvailableOnly {
-		filter["taken_by_user_id"] = nil
-	}
-	if req.Genre != "" {
-		filter["genre"] = bson.M{"$regex": req.Genre, "$options": "i"}
-	}
-	if req.Author != "" {
-		filter["author"] = bson.M{"$regex": req.Author, "$options": "i"}
-	}
-	if req.Publisher != "" {
-		filter["publisher"] = bson.M{"$regex": req.Publisher, "$options": "i"}
-	}
-	if req.ShelfID != "" {
-		shelfID, err := bson.ObjectIDFromHex(req.ShelfID)
-		if err == nil {
-			filter["shelf_id"] = shelfID
-		}
-	}
-	if req.Search != "" {
-		searchRegex := bson.M{"$regex": req.Search, "$options": "i"}
-		filter["$or"] = []bson.M{
-			{"title": searchRegex},
-			{"author": searchRegex},
-			{"publisher": searchRegex},
-			{"isbn": searchRegex},
-			{"genre": searchRegex},
-		}
+	plan, err := services.PlanBookSearch(ctx, req.BookFilter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to search books",
+		})
 	}
+	filter := plan.Filter
 
-	total, err := bookCollection.CountDocuments(ctx, filter)
+	sort, err := services.ResolveBookSort(req.Sort, plan.Ranked)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "failed to count books",
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
 		})
 	}
 
 	pipeline := mongo.Pipeline{
 		{{Key: "$match", Value: filter}},
-		{{Key: "$skip", Value: skip}},
-		{{Key: "$limit", Value: limit}},
-		{{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "shelves"},
-			{Key: "localField", Value: "shelf_id"},
-			{Key: "foreignField", Value: "_id"},
-			{Key: "as", Value: "shelf_details"},
-		}}},
-		{{Key: "$unwind", Value: bson.D{
-			{Key: "path", Value: "$shelf_details"},
-			{Key: "preserveNullAndEmptyArrays", Value: true},
-		}}},
-		{{Key: "$addFields", Value: bson.D{
-			{Key: "shelf_address", Value: "$shelf_details.address"},
-		}}},
-		{{Key: "$project", Value: bson.D{
-			{Key: "shelf_details", Value: 0},
-		}}},
 	}
+	if plan.Ranked {
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}},
+		}}})
+	}
+	if req.Page <= 0 && req.Cursor != "" {
+		after, err := services.DecodeCursor(req.Cursor, sort)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid cursor for this sort",
+			})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: sort.After(after)}})
+	}
+	pipeline = append(pipeline, sort.Stage())
+	if req.Page > 0 {
+		pipeline = append(pipeline, bson.D{{Key: "$skip", Value: (req.Page - 1) * limit}})
+	}
+	// one extra book tells whether there is a next page
+	pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit + 1}}, sort.ValueStage())
+	pipeline = append(pipeline, services.ShelfAddressStages()...)
 
 	cursor, err := bookCollection.Aggregate(ctx, pipeline)
 	if err != nil {
@@ -530,16 +857,151 @@ func GetAllBooks(c *fiber.Ctx) error {
 	if books == nil {
 		books = []BookWithShelf{}
 	}
+	hasMore := int64(len(books)) > limit
+	if hasMore {
+		books = books[:limit]
+	}
+	for i := range books {
+		books[i].CoverURLs = services.CoverURLs(c.BaseURL(), books[i].Book)
+	}
+	if req.Search != "" {
+		for i := range books {
+			authors := books[i].Author
+			if len(books[i].Contributors) > 0 {
+				authors = services.AuthorLine(services.ContributorNames(books[i].Contributors))
+			}
+			books[i].Highlights = services.HighlightBook(map[string]string{
+				"title":     books[i].Title,
+				"author":    authors,
+				"series":    books[i].Series,
+				"publisher": books[i].Publisher,
+				"genre":     books[i].Genre,
+			}, plan.Query)
+		}
+	}
 
-	lastPage := (total + limit - 1) / limit
+	meta := fiber.Map{
+		"limit": limit,
+		"sort":  sort.Key,
+	}
+	if req.Page > 0 || req.IncludeTotal {
+		total, err := bookCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to count books",
+			})
+		}
+		meta["total"] = total
+		if req.Page > 0 {
+			meta["page"] = req.Page
+			meta["last_page"] = (total + limit - 1) / limit
+		}
+	}
+	if hasMore {
+		last := books[len(books)-1]
+		nextCursor, err := services.EncodeCursor(services.PageCursor{
+			Sort:  sort.Key,
+			Value: last.SortValue,
+			ID:    last.ID,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to encode cursor",
+			})
+		}
+		meta["next_cursor"] = nextCursor
+	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+	response := fiber.Map{
 		"data": books,
+		"meta": meta,
+	}
+	if plan.DidYouMean != "" {
+		response["did_you_mean"] = plan.DidYouMean
+	}
+	if req.Facets {
+		facets, err := bookFacets(ctx, filter, req.FacetLimit)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "failed to compute facets",
+			})
+		}
+		response["facets"] = facets
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func bookFacets(ctx context.Context, filter bson.M, limit int) (services.BookFacets, error) {
+	var facets services.BookFacets
+	cursor, err := config.GetBookCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		services.FacetStage(limit),
+	})
+	if err != nil {
+		return facets, err
+	}
+	defer cursor.Close(ctx)
+	if cursor.Next(ctx) {
+		err = cursor.Decode(&facets)
+	}
+	return facets, err
+}
+
+func GetSuggestions(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) && !services.IsNormalUser(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	limit := int64(c.QueryInt("limit", 5))
+	if limit <= 0 || limit > 20 {
+		limit = 5
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	suggestions, err := services.Suggest(ctx, c.Query("q"), limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch suggestions",
+		})
+	}
+	c.Set(fiber.HeaderCacheControl, "private, max-age=60")
+	return c.Status(fiber.StatusOK).JSON(suggestions)
+}
+
+// GetAuthors lists authors by sort name, optionally those with a name
+// starting with q, with how many books credit each.
+func GetAuthors(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) && !services.IsNormalUser(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	page := int64(c.QueryInt("page", 1))
+	if page < 1 {
+		page = 1
+	}
+	limit := int64(c.QueryInt("limit", 20))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	authors, total, err := services.ListAuthors(ctx, c.Query("q"), (page-1)*limit, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch authors",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": authors,
 		"meta": fiber.Map{
 			"total":     total,
 			"page":      page,
-			"last_page": lastPage,
-			"limit":     limit,
+			"last_page": (total + limit - 1) / limit,
 		},
 	})
 }
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// coverError answers with the status matching a cover service error.
+func coverError(c *fiber.Ctx, err error, message string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrCoverTooLarge):
+		status = fiber.StatusRequestEntityTooLarge
+	case errors.Is(err, services.ErrCoverType):
+		status = fiber.StatusUnsupportedMediaType
+	case errors.Is(err, services.ErrCoverDimension):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, services.ErrCoverBook):
+		status = fiber.StatusNotFound
+	}
+	if status != fiber.StatusInternalServerError {
+		message = err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// UploadCover takes a multipart upload with the book ID under "book_id" and
+// a JPEG, PNG or GIF image under "cover".
+func UploadCover(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	bookID, err := bson.ObjectIDFromHex(c.FormValue("book_id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid book ID",
+		})
+	}
+	fileHeader, err := c.FormFile("cover")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cover is required",
+		})
+	}
+	if fileHeader.Size > services.MaxCoverFileSize {
+		return coverError(c, services.ErrCoverTooLarge, "")
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot read cover",
+		})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, services.MaxCoverFileSize+1))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot read cover",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cover, err := services.SaveCover(ctx, bookID, data)
+	if err != nil {
+		return coverError(c, err, "failed to save cover")
+	}
+	services.Audit(c, "book_cover_uploaded", bson.M{"book_id": bookID.Hex(), "version": cover.Version})
+
+	urls := map[string]string{}
+	for _, size := range []string{"small", "medium", "large", services.CoverOriginal} {
+		urls[size] = c.BaseURL() + services.CoverPath(bookID, &cover, size)
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"cover":      cover,
+		"cover_urls": urls,
+	})
+}
+
+type DeleteCoverReq struct {
+	BookID string `json:"book_id"`
+}
+
+func DeleteCover(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(DeleteCoverReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	bookID, err := bson.ObjectIDFromHex(data.BookID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid book ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := services.DeleteCover(ctx, bookID); err != nil {
+		return coverError(c, err, "failed to delete cover")
+	}
+	services.Audit(c, "book_cover_deleted", bson.M{"book_id": data.BookID})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "cover deleted successfully",
+	})
+}
+
+// GetCover serves a cover image. The version in the URL changes with every
+// upload, so images can be cached for good.
+func GetCover(c *fiber.Ctx) error {
+	bookID, err := bson.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	version, size := c.Params("version"), c.Params("size")
+	etag := `"` + version + "-" + size + `"`
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	cover, body, length, err := services.OpenCover(ctx, bookID, version, size)
+	if errors.Is(err, services.ErrCoverNotFound) {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+	if err != nil {
+		log.Printf("⚠️ failed to open cover %s/%s/%s: %v", bookID.Hex(), version, size, err)
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	defer body.Close()
+	// the stream is read after the handler returns, so copy it out first
+	image, err := io.ReadAll(body)
+	if err != nil {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+	if length >= 0 && int64(len(image)) != length {
+		log.Printf("⚠️ cover %s/%s/%s is %d bytes, expected %d", bookID.Hex(), version, size, len(image), length)
+	}
+	c.Set(fiber.HeaderContentType, services.CoverContentType(cover, size))
+	c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+	c.Set(fiber.HeaderETag, etag)
+	return c.Send(image)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type ExportBooksReq struct {
+	Format  string   `json:"format"`
+	BookIDs []string `json:"book_ids"`
+	services.BookFilter
+}
+
+// exportFilter selects the listed books, or else what a search with the same
+// filters would return.
+func exportFilter(ctx context.Context, req *ExportBooksReq) (bson.M, error) {
+	if len(req.BookIDs) > 0 {
+		ids := make([]bson.ObjectID, 0, len(req.BookIDs))
+		for _, hex := range req.BookIDs {
+			id, err := bson.ObjectIDFromHex(hex)
+			if err != nil {
+				return nil, fiber.NewError(fiber.StatusBadRequest, "invalid book ID: "+hex)
+			}
+			ids = append(ids, id)
+		}
+		return bson.M{"_id": bson.M{"$in": ids}}, nil
+	}
+	plan, err := services.PlanBookSearch(ctx, req.BookFilter)
+	if err != nil {
+		return nil, err
+	}
+	return plan.Filter, nil
+}
+
+// streamExport sends what write produces as a download. Once streaming has
+// started the status is sent, so failures can only be logged.
+func streamExport(c *fiber.Ctx, contentType, fileName string, write func(ctx context.Context, w *bufio.Writer) error) error {
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+fileName+`"`)
+	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		defer cancel()
+		if err := write(ctx, w); err != nil {
+			log.Printf("⚠️ export %s failed: %v", fileName, err)
+		}
+		w.Flush()
+	})
+	return nil
+}
+
+// ExportBooks downloads the books a search with the same filters as
+// GetAllBooks would return, or the listed book_ids, as CSV, JSON Lines,
+// BibTeX or MARC.
+func ExportBooks(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) && !services.IsNormalUser(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	req := new(ExportBooksReq)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	return exportBooks(c, req)
+}
+
+// ExportMARCRecords downloads books as MARCXML, or binary MARC with format
+// "marc".
+func ExportMARCRecords(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	req := new(ExportBooksReq)
+	if err := c.BodyParser(req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	if req.Format == "" {
+		req.Format = "marcxml"
+	}
+	if req.Format != "marc" && req.Format != "marcxml" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "format must be marc or marcxml",
+		})
+	}
+	return exportBooks(c, req)
+}
+
+func exportBooks(c *fiber.Ctx, req *ExportBooksReq) error {
+	exportType, ok := services.ExportFormats[req.Format]
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "unsupported format " + req.Format,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	filter, err := exportFilter(ctx, req)
+	if fiberErr, ok := err.(*fiber.Error); ok {
+		return c.Status(fiberErr.Code).JSON(fiber.Map{
+			"error": fiberErr.Message,
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to search books",
+		})
+	}
+
+	fileName := "books-" + time.Now().Format("20060102") + "." + exportType[1]
+	return streamExport(c, exportType[0], fileName, func(ctx context.Context, w *bufio.Writer) error {
+		return services.ExportBooks(ctx, filter, req.Format, w)
+	})
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// importFormat guesses the format from the file name when none is given.
+func importFormat(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".mrc", ".marc":
+		return "marc"
+	case ".xml":
+		return "marcxml"
+	}
+	return "csv"
+}
+
+// StartImport takes a multipart upload with the file under "file" (CSV,
+// binary MARC or MARCXML, see "format"), an optional "mapping" JSON object of
+// book field to CSV column header, "defaults" for fields a record leaves
+// empty, "shelf_id" to put every record on one shelf, "dry_run" and
+// "chunk_size". Records without a row and column get a free slot on their
+// shelf. The import runs in the background.
+//
+// A dry run only validates and cannot be promoted to a real import; upload
+// the file again without "dry_run" to write the records.
+func StartImport(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "file is required",
+		})
+	}
+	if fileHeader.Size > services.MaxImportFileSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"error": "file is too large",
+		})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot read file",
+		})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot read file",
+		})
+	}
+
+	job := models.ImportJob{
+		Format:    c.FormValue("format", importFormat(fileHeader.Filename)),
+		FileName:  fileHeader.Filename,
+		Data:      data,
+		DryRun:    c.FormValue("dry_run") == "true",
+		CreatedBy: services.GetUserID(c),
+	}
+	if mapping := c.FormValue("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &job.Mapping); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "mapping must be a JSON object of field to column",
+			})
+		}
+	}
+	if defaults := c.FormValue("defaults"); defaults != "" {
+		if err := json.Unmarshal([]byte(defaults), &job.Defaults); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "defaults must be a JSON object of field to value",
+			})
+		}
+	}
+	if shelfID := c.FormValue("shelf_id"); shelfID != "" {
+		id, err := bson.ObjectIDFromHex(shelfID)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid shelf ID",
+			})
+		}
+		job.ShelfID = &id
+	}
+	if chunkSize := c.FormValue("chunk_size"); chunkSize != "" {
+		job.ChunkSize, err = strconv.Atoi(chunkSize)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "chunk_size must be a number",
+			})
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err = services.CreateImportJob(ctx, job)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	services.Audit(c, "catalog_import_started", bson.M{
+		"job_id":  job.ID.Hex(),
+		"file":    job.FileName,
+		"dry_run": job.DryRun,
+	})
+	services.StartImportJob(job.ID)
+
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+func GetImport(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	jobID, err := bson.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid import ID",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := services.GetImportJob(ctx, jobID)
+	if errors.Is(err, services.ErrImportNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "import not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch import",
+		})
+	}
+	problems, err := services.ListImportErrors(ctx, jobID, 100)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch import errors",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"job":    job,
+		"errors": problems,
+	})
+}
+
+// ResumeImport continues an import that failed or whose worker went away,
+// from its last checkpoint.
+func ResumeImport(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	jobID, err := bson.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid import ID",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := services.GetImportJob(ctx, jobID)
+	if errors.Is(err, services.ErrImportNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "import not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch import",
+		})
+	}
+	if services.ImportJobBusy(job) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": services.ErrImportBusy.Error(),
+		})
+	}
+	services.Audit(c, "catalog_import_resumed", bson.M{"job_id": job.ID.Hex(), "processed_rows": job.ProcessedRows})
+	services.StartImportJob(job.ID)
+
+	return c.Status(fiber.StatusAccepted).JSON(job)
+}
+
+// GetImportErrors downloads the per-row error report as CSV.
+func GetImportErrors(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	jobID, err := bson.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid import ID",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	job, err := services.GetImportJob(ctx, jobID)
+	if errors.Is(err, services.ErrImportNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "import not found",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch import",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Attachment("import-" + job.ID.Hex() + "-errors.csv")
+	if err := services.WriteImportErrorsCSV(ctx, jobID, c); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to write error report",
+		})
+	}
+	return nil
+}
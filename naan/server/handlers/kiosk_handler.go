@@ -128,8 +128,7 @@ func KioskAuth(c *fiber.Ctx) error {
 		"id":   kiosk.Name,
 		"type": "kiosk",
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := token.SignedString([]byte(config.JWTSecret()))
+	t, err := services.SignToken(claims)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to generate token",
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// locationError answers with the status matching a location or shelf
+// service error.
+func locationError(c *fiber.Ctx, err error, message string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrLocationNotFound), errors.Is(err, services.ErrShelfNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, services.ErrLocationName), errors.Is(err, services.ErrLocationParent),
+		errors.Is(err, services.ErrShelfUnit), errors.Is(err, services.ErrShelfGrid),
+		errors.Is(err, services.ErrSlotOutOfRange), errors.Is(err, services.ErrRelocateSame),
+		errors.Is(err, services.ErrRelocateBooks):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, services.ErrLocationExists), errors.Is(err, services.ErrLocationNotEmpty),
+		errors.Is(err, services.ErrShelfGridInUse), errors.Is(err, services.ErrShelfNotEmpty),
+		errors.Is(err, services.ErrShelfFull), errors.Is(err, services.ErrRelocateRacing):
+		status = fiber.StatusConflict
+	}
+	if status != fiber.StatusInternalServerError {
+		message = err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// GetLocationTree returns the branches with their floors, rooms and shelf
+// units, each unit with its shelves, and the shelves not yet placed.
+func GetLocationTree(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tree, unplaced, err := services.LocationTree(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch locations",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data":     tree,
+		"unplaced": unplaced,
+	})
+}
+
+type CreateLocationReq struct {
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id"`
+}
+
+// CreateLocation adds a branch, or a floor, room or shelf unit under the
+// location of the level above.
+func CreateLocation(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(CreateLocationReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	parentID, err := optionalObjectID(data.ParentID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid parent ID",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	location, err := services.CreateLocation(ctx, data.Name, parentID)
+	if err != nil {
+		return locationError(c, err, "failed to create location")
+	}
+	services.Audit(c, "location_created", bson.M{"location_id": location.ID.Hex(), "kind": location.Kind, "name": location.Name})
+	return c.Status(fiber.StatusOK).JSON(location)
+}
+
+type RenameLocationReq struct {
+	LocationID string `json:"location_id"`
+	Name       string `json:"name"`
+}
+
+func RenameLocation(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(RenameLocationReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	locationID, err := bson.ObjectIDFromHex(data.LocationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid location ID",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	location, err := services.RenameLocation(ctx, locationID, data.Name)
+	if err != nil {
+		return locationError(c, err, "failed to rename location")
+	}
+	services.Audit(c, "location_renamed", bson.M{"location_id": data.LocationID, "name": location.Name})
+	return c.Status(fiber.StatusOK).JSON(location)
+}
+
+type MoveLocationReq struct {
+	LocationID string `json:"location_id"`
+	ParentID   string `json:"parent_id"`
+}
+
+func MoveLocation(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(MoveLocationReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	locationID, err := bson.ObjectIDFromHex(data.LocationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid location ID",
+		})
+	}
+	parentID, err := bson.ObjectIDFromHex(data.ParentID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid parent ID",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	location, err := services.MoveLocation(ctx, locationID, parentID)
+	if err != nil {
+		return locationError(c, err, "failed to move location")
+	}
+	services.Audit(c, "location_moved", bson.M{"location_id": data.LocationID, "parent_id": data.ParentID})
+	return c.Status(fiber.StatusOK).JSON(location)
+}
+
+type DeleteLocationReq struct {
+	LocationID string `json:"location_id"`
+}
+
+func DeleteLocation(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(DeleteLocationReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	locationID, err := bson.ObjectIDFromHex(data.LocationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid location ID",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := services.DeleteLocation(ctx, locationID); err != nil {
+		return locationError(c, err, "failed to delete location")
+	}
+	services.Audit(c, "location_deleted", bson.M{"location_id": data.LocationID})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "location deleted successfully",
+	})
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// CatalogAccess guards the OPDS and SRU routes, which sit outside the JWT
+// middleware. With CATALOG_ACCESS=token a patron or admin access token is
+// required, as a bearer token or, for e-reader apps and SRU clients that
+// can't send headers, in the token query parameter.
+func CatalogAccess() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !catalogProtected() {
+			return c.Next()
+		}
+		raw := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if raw == "" {
+			raw = c.Query("token")
+		}
+		token, err := services.ParseToken(raw)
+		if err == nil && token.Valid {
+			claims, _ := token.Claims.(jwt.MapClaims)
+			if claims["type"] == "admin" || claims["type"] == "normal" {
+				return c.Next()
+			}
+		}
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="naan catalog"`)
+		return c.Status(fiber.StatusUnauthorized).SendString("a valid access token is required")
+	}
+}
+
+func catalogProtected() bool {
+	return config.Env("CATALOG_ACCESS", "public") == "token"
+}
+
+// setCatalogCaching lets shared caches keep public feeds for a while. A
+// protected feed is only for its caller and its links carry their token, so
+// it must not be stored at all.
+func setCatalogCaching(c *fiber.Ctx) {
+	if catalogProtected() {
+		c.Set(fiber.HeaderCacheControl, "private, no-store")
+		return
+	}
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+}
+
+// opdsLinker makes absolute links that carry the caller's token query
+// parameter along, so clients that authenticate that way stay signed in.
+func opdsLinker(c *fiber.Ctx) services.OPDSLinker {
+	base := c.BaseURL()
+	token := c.Query("token")
+	return func(path string) string {
+		if token == "" {
+			return base + path
+		}
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+		return base + path + separator + "token=" + url.QueryEscape(token)
+	}
+}
+
+func sendOPDS(c *fiber.Ctx, kind string, document any) error {
+	out, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to render feed")
+	}
+	c.Set(fiber.HeaderContentType, kind+";charset=utf-8")
+	setCatalogCaching(c)
+	return c.Send(append([]byte(xml.Header), out...))
+}
+
+func opdsPage(c *fiber.Ctx) int64 {
+	page := int64(c.QueryInt("page", 1))
+	if page < 1 {
+		page = 1
+	}
+	return page
+}
+
+func OPDSRoot(c *fiber.Ctx) error {
+	link := opdsLinker(c)
+	feed := services.NewOPDSFeed(link, "root", "Library catalog", "/opds", services.OPDSNavigationType)
+	feed.Entries = []services.OPDSEntry{
+		services.NavigationEntry(link, "new", "New arrivals", "/opds/new", services.OPDSAcquisitionType, "Books most recently added to the library", 0),
+		services.NavigationEntry(link, "genres", "By genre", "/opds/genres", services.OPDSNavigationType, "Browse books by genre", 0),
+		services.NavigationEntry(link, "authors", "By author", "/opds/authors", services.OPDSNavigationType, "Browse books by author", 0),
+		services.NavigationEntry(link, "series", "By series", "/opds/series", services.OPDSNavigationType, "Browse series in reading order", 0),
+		services.NavigationEntry(link, "all", "All books", "/opds/all", services.OPDSAcquisitionType, "Every book, by title", 0),
+	}
+	return sendOPDS(c, services.OPDSNavigationType, feed)
+}
+
+func OPDSOpenSearch(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderContentType, services.OpenSearchType+";charset=utf-8")
+	setCatalogCaching(c)
+	return c.Send(services.OpenSearchDescription(opdsLinker(c)))
+}
+
+type opdsGroup struct {
+	Value string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+// opdsGroupFields says what each navigation feed groups books by. Authors
+// come from the contributor list, so a co-written book counts for each.
+var opdsGroupFields = map[string]struct {
+	Field  string
+	Stages mongo.Pipeline
+}{
+	"genre":  {Field: "genre"},
+	"series": {Field: "series"},
+	"author": {Field: "contributors.name", Stages: mongo.Pipeline{
+		{{Key: "$unwind", Value: "$contributors"}},
+		{{Key: "$match", Value: bson.M{"contributors.role": models.RoleAuthor}}},
+	}},
+}
+
+// opdsGroups counts books by a field, in name order.
+func opdsGroups(ctx context.Context, kind string, skip, limit int64) ([]opdsGroup, int64, error) {
+	group := opdsGroupFields[kind]
+	field := group.Field
+	pipeline := append(mongo.Pipeline{}, group.Stages...)
+	cursor, err := config.GetBookCollection().Aggregate(ctx, append(pipeline, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{field: bson.M{"$nin": bson.A{"", nil}}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$" + field},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		{{Key: "$facet", Value: bson.D{
+			{Key: "total", Value: bson.A{bson.D{{Key: "$count", Value: "n"}}}},
+			{Key: "groups", Value: bson.A{
+				bson.D{{Key: "$skip", Value: skip}},
+				bson.D{{Key: "$limit", Value: limit}},
+			}},
+		}}},
+	}...))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+	var result []struct {
+		Total []struct {
+			N int64 `bson:"n"`
+		} `bson:"total"`
+		Groups []opdsGroup `bson:"groups"`
+	}
+	if err := cursor.All(ctx, &result); err != nil || len(result) == 0 {
+		return nil, 0, err
+	}
+	total := int64(0)
+	if len(result[0].Total) > 0 {
+		total = result[0].Total[0].N
+	}
+	return result[0].Groups, total, nil
+}
+
+// opdsNavigation lists the values of a field, each linking to the books
+// that have it.
+func opdsNavigation(c *fiber.Ctx, kind, path, title string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	page := opdsPage(c)
+	groups, total, err := opdsGroups(ctx, kind, (page-1)*services.OPDSPageSize, services.OPDSPageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to build feed")
+	}
+
+	link := opdsLinker(c)
+	feed := services.NewOPDSFeed(link, strings.TrimPrefix(path, "/opds/"), title, path, services.OPDSNavigationType)
+	for _, group := range groups {
+		feed.Entries = append(feed.Entries, services.NavigationEntry(link,
+			kind+":"+url.PathEscape(group.Value), group.Value, path+"/"+url.PathEscape(group.Value),
+			services.OPDSAcquisitionType, "", group.Count))
+	}
+	feed.Paginate(link, path, services.OPDSNavigationType, page, total)
+	return sendOPDS(c, services.OPDSNavigationType, feed)
+}
+
+func OPDSGenres(c *fiber.Ctx) error {
+	return opdsNavigation(c, "genre", "/opds/genres", "Books by genre")
+}
+
+func OPDSAuthors(c *fiber.Ctx) error {
+	return opdsNavigation(c, "author", "/opds/authors", "Books by author")
+}
+
+func OPDSSeries(c *fiber.Ctx) error {
+	return opdsNavigation(c, "series", "/opds/series", "Books by series")
+}
+
+// opdsAcquisition sends a page of the books a search with filter finds. The
+// feeds a navigation entry links to filter on its exact value, so they hold
+// as many books as the entry counted.
+func opdsAcquisition(c *fiber.Ctx, id, title, path string, filter services.BookFilter, sortKey string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	plan, err := services.PlanBookSearch(ctx, filter)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to search books")
+	}
+	sort, err := services.ResolveBookSort(sortKey, plan.Ranked)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+	}
+	page := opdsPage(c)
+	books, total, err := services.FindBooksPage(ctx, plan, sort, (page-1)*services.OPDSPageSize, services.OPDSPageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to fetch books")
+	}
+
+	link := opdsLinker(c)
+	feed := services.NewOPDSFeed(link, id, title, path, services.OPDSAcquisitionType)
+	for _, book := range books {
+		feed.Entries = append(feed.Entries, services.BookEntry(link, book))
+	}
+	feed.Paginate(link, path, services.OPDSAcquisitionType, page, total)
+	return sendOPDS(c, services.OPDSAcquisitionType, feed)
+}
+
+func OPDSNewArrivals(c *fiber.Ctx) error {
+	return opdsAcquisition(c, "new", "New arrivals", "/opds/new", services.BookFilter{}, "added_at")
+}
+
+func OPDSAllBooks(c *fiber.Ctx) error {
+	return opdsAcquisition(c, "all", "All books", "/opds/all", services.BookFilter{}, "title")
+}
+
+func OPDSGenreBooks(c *fiber.Ctx) error {
+	genre, err := url.PathUnescape(c.Params("genre"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("invalid genre")
+	}
+	escaped := url.PathEscape(genre)
+	return opdsAcquisition(c, "genre:"+escaped, genre, "/opds/genres/"+escaped, services.BookFilter{Genre: genre, Exact: true}, "title")
+}
+
+func OPDSAuthorBooks(c *fiber.Ctx) error {
+	author, err := url.PathUnescape(c.Params("author"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("invalid author")
+	}
+	escaped := url.PathEscape(author)
+	return opdsAcquisition(c, "author:"+escaped, author, "/opds/authors/"+escaped, services.BookFilter{Author: author, Exact: true}, "title")
+}
+
+func OPDSSeriesBooks(c *fiber.Ctx) error {
+	series, err := url.PathUnescape(c.Params("series"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("invalid series")
+	}
+	escaped := url.PathEscape(series)
+	return opdsAcquisition(c, "series:"+escaped, series, "/opds/series/"+escaped, services.BookFilter{Series: series, Exact: true}, "series_number")
+}
+
+func OPDSSearch(c *fiber.Ctx) error {
+	query := strings.TrimSpace(c.Query("q"))
+	escaped := url.QueryEscape(query)
+	return opdsAcquisition(c, "search:"+escaped, "Search: "+query, "/opds/search?q="+escaped, services.BookFilter{Search: query}, "")
+}
+
+// OPDSBook is the complete entry for one book.
+func OPDSBook(c *fiber.Ctx) error {
+	bookID, err := bson.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("invalid book ID")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var found *services.ExportedBook
+	err = services.ForEachBook(ctx, bson.M{"_id": bookID}, func(book services.ExportedBook) error {
+		found = &book
+		return nil
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to fetch book")
+	}
+	if found == nil {
+		return c.Status(fiber.StatusNotFound).SendString("book not found")
+	}
+	entry := services.BookEntry(opdsLinker(c), *found)
+	entry.Xmlns = "http://www.w3.org/2005/Atom"
+	entry.XmlnsDC = "http://purl.org/dc/terms/"
+	return sendOPDS(c, services.OPDSEntryType, entry)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -9,10 +10,16 @@ import (
 	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
 	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
 	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
 )
 
 type CreateShelfReq struct {
 	Address string `json:"address"`
+	// LocationID is the shelf unit to place the shelf in, which then needs
+	// its Rows and Columns.
+	LocationID string `json:"location_id"`
+	Rows       int    `json:"rows"`
+	Columns    int    `json:"columns"`
 }
 
 func CreateShelf(c *fiber.Ctx) error {
@@ -29,12 +36,29 @@ func CreateShelf(c *fiber.Ctx) error {
 			"error": "cannot parse JSON",
 		})
 	}
+	locationID, err := optionalObjectID(data.LocationID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid location ID",
+		})
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	shelfCollection := config.GetShelfCollection()
 
-	shelfDetails, shelfErr := shelfCollection.InsertOne(ctx, data)
+	path, err := services.ShelfPath(ctx, locationID, data.Rows, data.Columns)
+	if err != nil {
+		return locationError(c, err, "failed to create shelf")
+	}
+	shelf := models.Shelf{
+		Address:    data.Address,
+		LocationID: locationID,
+		Path:       path,
+		Rows:       data.Rows,
+		Columns:    data.Columns,
+	}
+	shelfDetails, shelfErr := shelfCollection.InsertOne(ctx, shelf)
 
 	if shelfErr != nil {
 		return shelfErr
@@ -51,6 +75,11 @@ func CreateShelf(c *fiber.Ctx) error {
 type UpdateShelfReq struct {
 	ShelfID string `json:"shelf_id"`
 	Address string `json:"address"`
+	// LocationID, Rows and Columns change only when present; an empty
+	// LocationID takes the shelf out of the location tree.
+	LocationID *string `json:"location_id"`
+	Rows       *int    `json:"rows"`
+	Columns    *int    `json:"columns"`
 }
 
 func UpdateShelf(c *fiber.Ctx) error {
@@ -79,11 +108,47 @@ func UpdateShelf(c *fiber.Ctx) error {
 			"error": "invalid shelf ID",
 		})
 	}
+	shelf, err := services.GetShelf(ctx, shelfID)
+	if err != nil {
+		return locationError(c, err, "failed to fetch shelf")
+	}
 
-	update := bson.M{
-		"$set": bson.M{
-			"address": data.Address,
-		},
+	set := bson.M{}
+	if data.Address != "" {
+		set["address"] = data.Address
+	}
+	if data.LocationID != nil {
+		if shelf.LocationID, err = optionalObjectID(*data.LocationID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid location ID",
+			})
+		}
+	}
+	if data.Rows != nil {
+		shelf.Rows = *data.Rows
+		set["rows"] = shelf.Rows
+	}
+	if data.Columns != nil {
+		shelf.Columns = *data.Columns
+		set["columns"] = shelf.Columns
+	}
+	path, err := services.ShelfPath(ctx, shelf.LocationID, shelf.Rows, shelf.Columns)
+	if err == nil && (data.Rows != nil || data.Columns != nil) {
+		err = services.CheckShelfGrid(ctx, shelfID, shelf.Rows, shelf.Columns)
+	}
+	if err != nil {
+		return locationError(c, err, "failed to update shelf")
+	}
+
+	update := bson.M{}
+	if shelf.LocationID != nil {
+		set["location_id"] = shelf.LocationID
+		set["path"] = path
+	} else {
+		update["$unset"] = bson.M{"location_id": "", "path": ""}
+	}
+	if len(set) > 0 {
+		update["$set"] = set
 	}
 
 	_, err = shelfCollection.UpdateOne(ctx, bson.M{"_id": shelfID}, update)
@@ -100,6 +165,9 @@ func UpdateShelf(c *fiber.Ctx) error {
 
 type DeleteShelfReq struct {
 	ShelfID string `json:"shelf_id"`
+	// TargetShelfID receives the shelf's books; without it a shelf that
+	// still has books is not deleted.
+	TargetShelfID string `json:"target_shelf_id"`
 }
 
 func DeleteShelf(c *fiber.Ctx) error {
@@ -116,9 +184,8 @@ func DeleteShelf(c *fiber.Ctx) error {
 			"error": "cannot parse JSON",
 		})
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
-	shelfCollection := config.GetShelfCollection()
 	// Convert ShelfID to ObjectID
 	shelfID, err := bson.ObjectIDFromHex(data.ShelfID)
 	if err != nil {
@@ -126,17 +193,102 @@ func DeleteShelf(c *fiber.Ctx) error {
 			"error": "invalid shelf ID",
 		})
 	}
-	_, err = shelfCollection.DeleteOne(ctx, bson.M{"_id": shelfID})
+	targetID, err := optionalObjectID(data.TargetShelfID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "failed to delete shelf",
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid target shelf ID",
 		})
 	}
+	moves, err := services.DeleteShelf(ctx, shelfID, targetID)
+	// books already moved stay moved, so record them even if deleting failed
+	services.AuditEach(c, "book_moved", services.MovesAuditDetails(moves, services.MoveShelfDeleted))
+	if err != nil {
+		return locationError(c, err, "failed to delete shelf")
+	}
+	services.Audit(c, "shelf_deleted", bson.M{"shelf_id": data.ShelfID, "target_shelf_id": data.TargetShelfID, "moved": len(moves)})
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "shelf deleted successfully",
+		"moved":   moves,
+	})
+}
+
+type RelocateBooksReq struct {
+	FromShelfID string `json:"from_shelf_id"`
+	ToShelfID   string `json:"to_shelf_id"`
+	// BookIDs picks the books to move; empty moves the whole shelf.
+	BookIDs []string `json:"book_ids"`
+	// DryRun returns the slots the books would get without moving them.
+	DryRun bool `json:"dry_run"`
+}
+
+// RelocateBooks moves books from one shelf to another, giving each a free
+// slot on the target.
+func RelocateBooks(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(RelocateBooksReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	fromID, err := bson.ObjectIDFromHex(data.FromShelfID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid source shelf ID",
+		})
+	}
+	toID, err := bson.ObjectIDFromHex(data.ToShelfID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid target shelf ID",
+		})
+	}
+	var bookIDs []bson.ObjectID
+	for _, hex := range data.BookIDs {
+		bookID, err := bson.ObjectIDFromHex(hex)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid book ID: " + hex,
+			})
+		}
+		if !containsObjectID(bookIDs, bookID) {
+			bookIDs = append(bookIDs, bookID)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var moves []services.BookMove
+	if data.DryRun {
+		moves, err = services.PlanRelocation(ctx, fromID, toID, bookIDs)
+	} else {
+		moves, err = services.RelocateBooks(ctx, fromID, toID, bookIDs)
+		// record the books moved before any failure, as DeleteShelf does
+		services.AuditEach(c, "book_moved", services.MovesAuditDetails(moves, services.MoveRelocate))
+	}
+	if err != nil {
+		return locationError(c, err, "failed to relocate books")
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"dry_run": data.DryRun,
+		"moved":   moves,
 	})
 }
 
+func containsObjectID(ids []bson.ObjectID, id bson.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
 func GetAllShelves(c *fiber.Ctx) error {
 	if !services.IsAdmin(c) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -164,3 +316,116 @@ func GetAllShelves(c *fiber.Ctx) error {
 
 	return c.Status(fiber.StatusOK).JSON(shelves)
 }
+
+type ShelfBooksReq struct {
+	ShelfID string `json:"shelf_id"`
+}
+
+// findShelf reads the shelf named in a ShelfBooksReq, answering the request
+// itself when it can't.
+func findShelf(ctx context.Context, c *fiber.Ctx) (models.Shelf, bool) {
+	var shelf models.Shelf
+	data := new(ShelfBooksReq)
+	if err := c.BodyParser(data); err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+		return shelf, false
+	}
+	shelfID, err := bson.ObjectIDFromHex(data.ShelfID)
+	if err != nil {
+		c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid shelf ID",
+		})
+		return shelf, false
+	}
+	err = config.GetShelfCollection().FindOne(ctx, bson.M{"_id": shelfID}).Decode(&shelf)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "shelf not found",
+		})
+		return shelf, false
+	}
+	if err != nil {
+		c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch shelf",
+		})
+		return shelf, false
+	}
+	return shelf, true
+}
+
+// GetShelfList returns a shelf's books in call number order, the order
+// they should stand in.
+func GetShelfList(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	shelf, ok := findShelf(ctx, c)
+	if !ok {
+		return nil
+	}
+	books, err := services.ShelfList(ctx, shelf.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch books",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"shelf": shelf,
+		"data":  books,
+	})
+}
+
+// CheckShelfOrder flags the books on a shelf that stand out of call number
+// order, with where each one belongs.
+func CheckShelfOrder(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	shelf, ok := findShelf(ctx, c)
+	if !ok {
+		return nil
+	}
+	report, err := services.CheckShelfOrder(ctx, shelf.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to check shelf order",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+// GetShelfMap draws a shelf as its grid of slots, each with the book there
+// and whether it is on loan or on hold, flagging slots that two books claim.
+func GetShelfMap(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	shelf, ok := findShelf(ctx, c)
+	if !ok {
+		return nil
+	}
+	shelfMap, err := services.GetShelfMap(ctx, shelf)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to map shelf",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(shelfMap)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+)
+
+const sruContentType = "application/sru+xml;charset=utf-8"
+
+func sendSRU(c *fiber.Ctx, document any) error {
+	out, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).SendString("failed to render response")
+	}
+	c.Set(fiber.HeaderContentType, sruContentType)
+	return c.Send(append([]byte(xml.Header), out...))
+}
+
+// sruDiagnostic answers a searchRetrieve that can't run. SRU reports these
+// in the body with a 200, so clients treat them as search results.
+func sruDiagnostic(c *fiber.Ctx, code int, details, message string) error {
+	response := services.NewSRUSearchRetrieveResponse()
+	response.Diagnostics = &services.SRUDiagnostics{Diagnostics: []services.SRUDiagnostic{{
+		URI:     fmt.Sprintf("info:srw/diagnostic/1/%d", code),
+		Details: details,
+		Message: message,
+	}}}
+	return sendSRU(c, response)
+}
+
+// sruServerAddress is the host and port explain advertises: SRU_HOST and
+// SRU_PORT when set, otherwise the ones the client asked for in the Host
+// header, with the scheme's default port when it names none.
+func sruServerAddress(c *fiber.Ctx) (string, string) {
+	host, port := c.Hostname(), ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host, port = h, p
+	}
+	if port == "" {
+		port = "80"
+		if c.Protocol() == "https" {
+			port = "443"
+		}
+	}
+	return config.Env("SRU_HOST", host), config.Env("SRU_PORT", port)
+}
+
+// SRU serves both operations from one URL: a request without a query is an
+// explain, as the SRU 2.0 spec asks.
+func SRU(c *fiber.Ctx) error {
+	operation := c.Query("operation")
+	if operation == "" {
+		operation = "explain"
+		if c.Query("query") != "" {
+			operation = "searchRetrieve"
+		}
+	}
+	switch operation {
+	case "explain":
+		host, port := sruServerAddress(c)
+		return sendSRU(c, services.NewSRUExplainResponse(host, port, "sru"))
+	case "searchRetrieve":
+		return sruSearchRetrieve(c)
+	}
+	return sruDiagnostic(c, 4, operation, "Unsupported operation")
+}
+
+func sruSearchRetrieve(c *fiber.Ctx) error {
+	query := c.Query("query")
+	if query == "" {
+		return sruDiagnostic(c, 7, "query", "Mandatory parameter not supplied")
+	}
+	schema, ok := services.SRUSchemas[c.Query("recordSchema", "dc")]
+	if !ok {
+		return sruDiagnostic(c, 66, c.Query("recordSchema"), "Unknown schema for retrieval")
+	}
+	escaping := c.Query("recordXMLEscaping", "xml")
+	if escaping != "xml" && escaping != "string" {
+		return sruDiagnostic(c, 71, escaping, "Unsupported record packing")
+	}
+	start := int64(c.QueryInt("startRecord", 1))
+	if start < 1 {
+		return sruDiagnostic(c, 6, "startRecord", "Unsupported parameter value")
+	}
+	maximum := int64(c.QueryInt("maximumRecords", services.SRUDefaultRecords))
+	if maximum < 0 {
+		return sruDiagnostic(c, 6, "maximumRecords", "Unsupported parameter value")
+	}
+	if maximum > services.SRUMaxRecords {
+		maximum = services.SRUMaxRecords
+	}
+
+	filter, err := services.ParseCQL(query)
+	if err != nil {
+		uri, details, message := services.DescribeCQLError(err)
+		response := services.NewSRUSearchRetrieveResponse()
+		response.Diagnostics = &services.SRUDiagnostics{Diagnostics: []services.SRUDiagnostic{{URI: uri, Details: details, Message: message}}}
+		return sendSRU(c, response)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var books []services.ExportedBook
+	var total int64
+	if maximum == 0 {
+		// clients ask for no records to learn just the hit count
+		total, err = config.GetBookCollection().CountDocuments(ctx, filter)
+	} else {
+		sort, _ := services.ResolveBookSort("title", false)
+		books, total, err = services.FindBooksPage(ctx, services.SearchPlan{Filter: filter}, sort, start-1, maximum)
+	}
+	if err != nil {
+		return sruDiagnostic(c, 1, "", "General system error")
+	}
+
+	if total > 0 && start > total {
+		return sruDiagnostic(c, 61, fmt.Sprint(start), "First record position out of range")
+	}
+	response := services.NewSRUSearchRetrieveResponse()
+	response.NumberOfRecords = total
+	if len(books) > 0 {
+		response.Records = &services.SRURecords{}
+	}
+	for i, book := range books {
+		record, err := services.SRURecordFor(book, schema, escaping, start+int64(i))
+		if err != nil {
+			return sruDiagnostic(c, 1, "", "General system error")
+		}
+		response.Records.Records = append(response.Records.Records, record)
+	}
+	if next := start + int64(len(books)); next <= total && len(books) > 0 {
+		response.NextRecordPosition = next
+	}
+	return sendSRU(c, response)
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// subjectError answers with the status matching a subject service error.
+func subjectError(c *fiber.Ctx, err error, message string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrSubjectNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, services.ErrSubjectName), errors.Is(err, services.ErrSubjectCycle):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, services.ErrSubjectExists), errors.Is(err, services.ErrSubjectHasChildren):
+		status = fiber.StatusConflict
+	}
+	if status != fiber.StatusInternalServerError {
+		message = err.Error()
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// optionalObjectID reads an ID that may be left empty, as for a subject
+// at the top of the tree.
+func optionalObjectID(hex string) (*bson.ObjectID, error) {
+	if hex == "" {
+		return nil, nil
+	}
+	id, err := bson.ObjectIDFromHex(hex)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// GetSubjectTree returns the subject vocabulary as a tree with the number of
+// books under each subject.
+func GetSubjectTree(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) && !services.IsNormalUser(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tree, err := services.SubjectTree(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch subjects",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": tree,
+	})
+}
+
+// GetSubjectBooks browses a subject: its place in the tree, its narrower
+// subjects and a page of its books. Books filed under narrower subjects are
+// included unless narrower=false.
+func GetSubjectBooks(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) && !services.IsNormalUser(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	subjectID, err := bson.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid subject ID",
+		})
+	}
+	page := int64(c.QueryInt("page", 1))
+	if page < 1 {
+		page = 1
+	}
+	limit := int64(c.QueryInt("limit", 20))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	sort, err := services.ResolveBookSort(c.Query("sort"), false)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	subject, breadcrumb, err := services.SubjectBranch(ctx, subjectID)
+	if err != nil {
+		return subjectError(c, err, "failed to fetch subject")
+	}
+	filter := bson.M{"subject_tree_ids": subjectID}
+	if !c.QueryBool("narrower", true) {
+		filter = bson.M{"subject_ids": subjectID}
+	}
+	books, total, err := services.FindBooksPage(ctx, services.SearchPlan{Filter: filter}, sort, (page-1)*limit, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch books",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"subject":    subject,
+		"breadcrumb": breadcrumb,
+		"data":       books,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": (total + limit - 1) / limit,
+			"sort":      sort.Key,
+		},
+	})
+}
+
+type CreateSubjectReq struct {
+	Name      string `json:"name"`
+	ParentID  string `json:"parent_id"`
+	ScopeNote string `json:"scope_note"`
+}
+
+func CreateSubject(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(CreateSubjectReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	parentID, err := optionalObjectID(data.ParentID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid parent ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	subject, err := services.CreateSubject(ctx, data.Name, parentID, data.ScopeNote)
+	if err != nil {
+		return subjectError(c, err, "failed to create subject")
+	}
+	services.Audit(c, "subject_created", bson.M{"subject_id": subject.ID.Hex(), "name": subject.Name})
+	return c.Status(fiber.StatusOK).JSON(subject)
+}
+
+type RenameSubjectReq struct {
+	SubjectID string `json:"subject_id"`
+	Name      string `json:"name"`
+}
+
+// RenameSubject renames a subject and the subject name stored on its books.
+func RenameSubject(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(RenameSubjectReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	subjectID, err := bson.ObjectIDFromHex(data.SubjectID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid subject ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	subject, err := services.RenameSubject(ctx, subjectID, data.Name)
+	if err != nil {
+		return subjectError(c, err, "failed to rename subject")
+	}
+	services.Audit(c, "subject_renamed", bson.M{"subject_id": subject.ID.Hex(), "name": subject.Name})
+	return c.Status(fiber.StatusOK).JSON(subject)
+}
+
+type MoveSubjectReq struct {
+	SubjectID string `json:"subject_id"`
+	// ParentID is the new broader subject; empty moves the subject to the
+	// top of the tree.
+	ParentID string `json:"parent_id"`
+}
+
+func MoveSubject(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(MoveSubjectReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	subjectID, err := bson.ObjectIDFromHex(data.SubjectID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid subject ID",
+		})
+	}
+	parentID, err := optionalObjectID(data.ParentID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid parent ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	subject, err := services.MoveSubject(ctx, subjectID, parentID)
+	if err != nil {
+		return subjectError(c, err, "failed to move subject")
+	}
+	services.Audit(c, "subject_moved", bson.M{"subject_id": subject.ID.Hex(), "parent_id": data.ParentID})
+	return c.Status(fiber.StatusOK).JSON(subject)
+}
+
+type MergeSubjectsReq struct {
+	SourceID string `json:"source_id"`
+	TargetID string `json:"target_id"`
+}
+
+// MergeSubjects files the source subject's books and narrower subjects under
+// the target and removes the source.
+func MergeSubjects(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(MergeSubjectsReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	sourceID, sourceErr := bson.ObjectIDFromHex(data.SourceID)
+	targetID, targetErr := bson.ObjectIDFromHex(data.TargetID)
+	if sourceErr != nil || targetErr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid subject ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	subject, err := services.MergeSubjects(ctx, sourceID, targetID)
+	if err != nil {
+		return subjectError(c, err, "failed to merge subjects")
+	}
+	services.Audit(c, "subjects_merged", bson.M{"source_id": data.SourceID, "target_id": data.TargetID})
+	return c.Status(fiber.StatusOK).JSON(subject)
+}
+
+type DeleteSubjectReq struct {
+	SubjectID string `json:"subject_id"`
+}
+
+func DeleteSubject(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(DeleteSubjectReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	subjectID, err := bson.ObjectIDFromHex(data.SubjectID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid subject ID",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	if err := services.DeleteSubject(ctx, subjectID); err != nil {
+		return subjectError(c, err, "failed to delete subject")
+	}
+	services.Audit(c, "subject_deleted", bson.M{"subject_id": data.SubjectID})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "subject deleted successfully",
+	})
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/services"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// tagError answers with the status matching a tag service error.
+func tagError(c *fiber.Ctx, err error, message string) error {
+	if errors.Is(err, services.ErrTagName) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": message,
+	})
+}
+
+// GetTags lists the tags in use with how many books carry each.
+func GetTags(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) && !services.IsNormalUser(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tags, err := services.ListTags(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to fetch tags",
+		})
+	}
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"data": tags,
+	})
+}
+
+type TagBooksReq struct {
+	Tag     string   `json:"tag"`
+	BookIDs []string `json:"book_ids"`
+	Remove  bool     `json:"remove"`
+}
+
+// TagBooks adds a tag to the given books, or takes it off them.
+func TagBooks(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(TagBooksReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+	if len(data.BookIDs) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "no books given",
+		})
+	}
+	bookIDs := make([]bson.ObjectID, 0, len(data.BookIDs))
+	for _, hex := range data.BookIDs {
+		bookID, err := bson.ObjectIDFromHex(hex)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid book ID " + hex,
+			})
+		}
+		bookIDs = append(bookIDs, bookID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	modified, err := services.TagBooks(ctx, data.Tag, bookIDs, data.Remove)
+	if err != nil {
+		return tagError(c, err, "failed to tag books")
+	}
+	action := "books_tagged"
+	if data.Remove {
+		action = "books_untagged"
+	}
+	services.Audit(c, action, bson.M{"tag": services.NormalizeTag(data.Tag), "book_ids": data.BookIDs})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"modified": modified,
+	})
+}
+
+type RenameTagReq struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// RenameTag renames a tag on every book, merging it into To if that tag is
+// already in use.
+func RenameTag(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(RenameTagReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	modified, err := services.RenameTag(ctx, data.From, data.To)
+	if err != nil {
+		return tagError(c, err, "failed to rename tag")
+	}
+	services.Audit(c, "tag_renamed", bson.M{
+		"from": services.NormalizeTag(data.From),
+		"to":   services.NormalizeTag(data.To),
+	})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"modified": modified,
+	})
+}
+
+type DeleteTagReq struct {
+	Tag string `json:"tag"`
+}
+
+func DeleteTag(c *fiber.Ctx) error {
+	if !services.IsAdmin(c) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "unauthorized access",
+		})
+	}
+	data := new(DeleteTagReq)
+	if err := c.BodyParser(data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "cannot parse JSON",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	modified, err := services.DeleteTag(ctx, data.Tag)
+	if err != nil {
+		return tagError(c, err, "failed to delete tag")
+	}
+	services.Audit(c, "tag_deleted", bson.M{"tag": services.NormalizeTag(data.Tag)})
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"modified": modified,
+	})
+}
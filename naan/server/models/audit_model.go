@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+type AuditLog struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Action    string        `bson:"action" json:"action"`
+	ActorType string        `bson:"actor_type,omitempty" json:"actor_type,omitempty"`
+	ActorID   string        `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	IP        string        `bson:"ip,omitempty" json:"ip,omitempty"`
+	Details   bson.M        `bson:"details,omitempty" json:"details,omitempty"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+}
@@ -7,14 +7,22 @@ import (
 )
 
 type User struct {
-	ID        bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Name      string        `bson:"name" json:"name"`
-	Email     string        `bson:"email" json:"email"`
-	Picture   string        `bson:"picture" json:"picture"`
-	Phone     string        `bson:"phone" json:"phone"`
-	DauthID   string        `bson:"dauth_id" json:"dauth_id"`
-	GoogleID  string        `bson:"google_id" json:"google_id"`
-	CreatedAt time.Time     `bson:"createdAt" json:"created_at"`
+	ID         bson.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Name       string         `bson:"name" json:"name"`
+	Email      string         `bson:"email" json:"email"`
+	Picture    string         `bson:"picture" json:"picture"`
+	Phone      string         `bson:"phone" json:"phone"`
+	DauthID    string         `bson:"dauth_id" json:"dauth_id"`
+	GoogleID   string         `bson:"google_id" json:"google_id"`
+	Identities []UserIdentity `bson:"identities,omitempty" json:"identities,omitempty"`
+	CreatedAt  time.Time      `bson:"createdAt" json:"created_at"`
+}
+
+type UserIdentity struct {
+	Provider string    `bson:"provider" json:"provider"`
+	Subject  string    `bson:"subject" json:"subject"`
+	Email    string    `bson:"email,omitempty" json:"email,omitempty"`
+	LinkedAt time.Time `bson:"linked_at" json:"linked_at"`
 }
 
 type PublicUser struct {
@@ -28,3 +36,38 @@ type AdminUser struct {
 	PasswordHash string        `bson:"password_hash" json:"password_hash"`
 	CreatedAt    time.Time     `bson:"createdAt" json:"created_at"`
 }
+
+type LoginAttempt struct {
+	ID            bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Key           string        `bson:"key" json:"key"`
+	Kind          string        `bson:"kind" json:"kind"`
+	Value         string        `bson:"value" json:"value"`
+	Failures      int           `bson:"failures" json:"failures"`
+	LastFailureAt time.Time     `bson:"last_failure_at" json:"last_failure_at"`
+	LockedUntil   *time.Time    `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+}
+
+type RefreshToken struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	TokenHash string        `bson:"token_hash" json:"-"`
+	FamilyID  string        `bson:"family_id" json:"family_id"`
+	UserID    string        `bson:"user_id" json:"user_id"`
+	UserType  string        `bson:"user_type" json:"user_type"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time     `bson:"expires_at" json:"expires_at"`
+	RotatedAt *time.Time    `bson:"rotated_at,omitempty" json:"rotated_at,omitempty"`
+	RevokedAt *time.Time    `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	UserAgent string        `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	IP        string        `bson:"ip,omitempty" json:"ip,omitempty"`
+}
+
+// LoginCode is a one-time code handed to the app after a provider login,
+// which it trades for a token pair.
+type LoginCode struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CodeHash  string        `bson:"code_hash" json:"-"`
+	UserID    string        `bson:"user_id" json:"user_id"`
+	UserType  string        `bson:"user_type" json:"user_type"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+	ExpiresAt time.Time     `bson:"expires_at" json:"expires_at"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	RoleAuthor      = "author"
+	RoleEditor      = "editor"
+	RoleTranslator  = "translator"
+	RoleIllustrator = "illustrator"
+)
+
+var ContributorRoles = []string{RoleAuthor, RoleEditor, RoleTranslator, RoleIllustrator}
+
+// Contributor is a person credited on a book. Name is copied from the
+// author document so books can be listed and searched without a lookup.
+type Contributor struct {
+	AuthorID bson.ObjectID `bson:"author_id,omitempty" json:"author_id,omitempty"`
+	Name     string        `bson:"name" json:"name"`
+	Role     string        `bson:"role" json:"role"`
+}
+
+// Author is a person, named the same way on every book. Key is the folded
+// name that identifies them, so "Tolkien, J.R.R." and "J. R. R. Tolkien"
+// are one author.
+type Author struct {
+	ID        bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Name      string        `bson:"name" json:"name"`
+	SortName  string        `bson:"sort_name" json:"sort_name"`
+	Key       string        `bson:"key" json:"-"`
+	BookCount int64         `bson:"book_count,omitempty" json:"book_count"`
+	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+}
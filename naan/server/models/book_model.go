@@ -7,26 +7,78 @@ import (
 )
 
 type Book struct {
-	ID            bson.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
-	Title         string         `bson:"title" json:"title"`
-	Author        string         `bson:"author" json:"author"`
+	ID    bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Title string        `bson:"title" json:"title"`
+	// Author is the line of author names, kept in step with Contributors
+	// for display and sorting.
+	Author string `bson:"author" json:"author"`
+	// TitleKey and AuthorKey are Title and Author folded for sorting (see
+	// services.SortKey).
+	TitleKey      string         `bson:"title_key" json:"-"`
+	AuthorKey     string         `bson:"author_key" json:"-"`
+	Contributors  []Contributor  `bson:"contributors,omitempty" json:"contributors,omitempty"`
+	Series        string         `bson:"series,omitempty" json:"series,omitempty"`
+	SeriesNumber  float64        `bson:"series_number" json:"series_number,omitempty"`
 	Publisher     string         `bson:"publisher" json:"publisher"`
 	ISBN          string         `bson:"isbn" json:"isbn"`
 	Genre         string         `bson:"genre" json:"genre"`
+	PublishedYear int            `bson:"published_year,omitempty" json:"published_year,omitempty"`
+	Subjects      []string       `bson:"subjects,omitempty" json:"subjects,omitempty"`
+	PageCount     int            `bson:"page_count,omitempty" json:"page_count,omitempty"`
+	CoverURL      string         `bson:"cover_url,omitempty" json:"cover_url,omitempty"`
 	ShelfID       bson.ObjectID  `bson:"shelf_id" json:"shelf_id"`
 	AddedAt       time.Time      `bson:"added_at" json:"added_at"`
+	LoanCount     int64          `bson:"loan_count" json:"loan_count"`
 	TakenByUserID *bson.ObjectID `bson:"taken_by_user_id,omitempty" json:"taken_by_user_id,omitempty"`
 	Row           int            `bson:"row" json:"row"`
 	Column        int            `bson:"column" json:"column"`
+	// MARC leader and control fields kept from an import so the record can
+	// be exported again unchanged.
+	MARCLeader  string             `bson:"marc_leader,omitempty" json:"-"`
+	MARCControl []MARCControlField `bson:"marc_control,omitempty" json:"-"`
+	// SubjectIDs are the subjects Subjects names; SubjectTreeIDs adds every
+	// broader subject so browsing a subject finds books filed below it.
+	SubjectIDs     []bson.ObjectID `bson:"subject_ids,omitempty" json:"subject_ids,omitempty"`
+	SubjectTreeIDs []bson.ObjectID `bson:"subject_tree_ids,omitempty" json:"-"`
+	// Tags are librarian labels kept apart from the subject vocabulary.
+	Tags []string `bson:"tags,omitempty" json:"tags,omitempty"`
+	// CallNumber is the Dewey or Library of Congress call number as
+	// catalogued; CallNumberKey is its shelf order sort key.
+	CallNumber    string `bson:"call_number,omitempty" json:"call_number,omitempty"`
+	CallNumberKey string `bson:"call_number_key" json:"-"`
+	// Cover is the uploaded cover image; CoverURL is the one found by
+	// metadata enrichment.
+	Cover *BookCover `bson:"cover,omitempty" json:"cover,omitempty"`
 }
 
 type PublicBook struct {
-	ID        bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	Title     string        `bson:"title" json:"title"`
-	Author    string        `bson:"author" json:"author"`
-	Publisher string        `bson:"publisher" json:"publisher"`
-	ISBN      string        `bson:"isbn" json:"isbn"`
-	Genre     string        `bson:"genre" json:"genre"`
+	ID            bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Title         string        `bson:"title" json:"title"`
+	Author        string        `bson:"author" json:"author"`
+	Publisher     string        `bson:"publisher" json:"publisher"`
+	ISBN          string        `bson:"isbn" json:"isbn"`
+	Genre         string        `bson:"genre" json:"genre"`
+	PublishedYear int           `bson:"published_year,omitempty" json:"published_year,omitempty"`
+	// the cover fields only feed CoverURLs
+	Cover     *BookCover        `bson:"cover,omitempty" json:"-"`
+	CoverURL  string            `bson:"cover_url,omitempty" json:"-"`
+	CoverURLs map[string]string `bson:"-" json:"cover_urls,omitempty"`
+}
+
+// BookMetadata is bibliographic data looked up by ISBN from a metadata
+// provider.
+type BookMetadata struct {
+	ISBN          string   `bson:"isbn" json:"isbn"`
+	Title         string   `bson:"title" json:"title"`
+	Subtitle      string   `bson:"subtitle,omitempty" json:"subtitle,omitempty"`
+	Authors       []string `bson:"authors,omitempty" json:"authors,omitempty"`
+	Publisher     string   `bson:"publisher,omitempty" json:"publisher,omitempty"`
+	PublishedYear int      `bson:"published_year,omitempty" json:"published_year,omitempty"`
+	Subjects      []string `bson:"subjects,omitempty" json:"subjects,omitempty"`
+	PageCount     int      `bson:"page_count,omitempty" json:"page_count,omitempty"`
+	CoverURL      string   `bson:"cover_url,omitempty" json:"cover_url,omitempty"`
+	Language      string   `bson:"language,omitempty" json:"language,omitempty"`
+	Sources       []string `bson:"sources" json:"sources"`
 }
 
 type History struct {
@@ -36,3 +88,12 @@ type History struct {
 	IssuedAt   time.Time     `bson:"issued_at" json:"issued_at"`
 	ReturnedAt *time.Time    `bson:"returned_at,omitempty" json:"returned_at,omitempty"`
 }
+
+type Suggestion struct {
+	ID         bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	Kind       string        `bson:"kind" json:"kind"`
+	Key        string        `bson:"key" json:"-"`
+	Text       string        `bson:"text" json:"text"`
+	Popularity int64         `bson:"popularity" json:"popularity"`
+	BookCount  int64         `bson:"book_count" json:"book_count"`
+}
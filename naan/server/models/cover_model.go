@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// BookCover describes an uploaded cover image. Version changes with every
+// upload and is part of the image URLs, so they can be cached forever.
+type BookCover struct {
+	Version     string    `bson:"version" json:"version"`
+	ContentType string    `bson:"content_type" json:"content_type"`
+	Width       int       `bson:"width" json:"width"`
+	Height      int       `bson:"height" json:"height"`
+	Size        int64     `bson:"size" json:"size"`
+	UploadedAt  time.Time `bson:"uploaded_at" json:"uploaded_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const HoldActive = "active"
+
+// Hold is a patron's place in the queue for a book that is out on loan.
+// Only active holds count towards a book's queue.
+type Hold struct {
+	ID       bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	BookID   bson.ObjectID `bson:"book_id" json:"book_id"`
+	UserID   bson.ObjectID `bson:"user_id" json:"user_id"`
+	Status   string        `bson:"status" json:"status"`
+	PlacedAt time.Time     `bson:"placed_at" json:"placed_at"`
+}
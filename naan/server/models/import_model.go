@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+type ImportJob struct {
+	ID       bson.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`
+	Format   string            `bson:"format" json:"format"`
+	FileName string            `bson:"file_name" json:"file_name"`
+	Data     []byte            `bson:"data" json:"-"`
+	Mapping  map[string]string `bson:"mapping,omitempty" json:"mapping,omitempty"`
+	// Defaults fill fields a record leaves empty, such as the shelf for MARC
+	// records without holdings.
+	Defaults map[string]string `bson:"defaults,omitempty" json:"defaults,omitempty"`
+	// ShelfID puts every record on this shelf, whatever shelf, row and
+	// column it names; the books fill its free slots in file order.
+	ShelfID   *bson.ObjectID `bson:"shelf_id,omitempty" json:"shelf_id,omitempty"`
+	DryRun    bool           `bson:"dry_run" json:"dry_run"`
+	ChunkSize int            `bson:"chunk_size" json:"chunk_size"`
+	Status    string         `bson:"status" json:"status"`
+	Error     string         `bson:"error,omitempty" json:"error,omitempty"`
+	// ProcessedRows is the checkpoint a resumed import continues after.
+	// On a dry run Imported counts the rows that would have been imported.
+	ProcessedRows int64      `bson:"processed_rows" json:"processed_rows"`
+	CheckpointRow int64      `bson:"checkpoint_row" json:"-"`
+	Imported      int64      `bson:"imported" json:"imported"`
+	Failed        int64      `bson:"failed" json:"failed"`
+	LeaseUntil    *time.Time `bson:"lease_until,omitempty" json:"-"`
+	CreatedBy     string     `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt     time.Time  `bson:"created_at" json:"created_at"`
+	UpdatedAt     time.Time  `bson:"updated_at" json:"updated_at"`
+	FinishedAt    *time.Time `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+type ImportRowError struct {
+	ID      bson.ObjectID `bson:"_id,omitempty" json:"-"`
+	JobID   bson.ObjectID `bson:"job_id" json:"-"`
+	Row     int64         `bson:"row" json:"row"`
+	Field   string        `bson:"field,omitempty" json:"field,omitempty"`
+	Value   string        `bson:"value,omitempty" json:"value,omitempty"`
+	Message string        `bson:"message" json:"message"`
+}
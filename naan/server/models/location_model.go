@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Location levels, from the top of the tree down. Shelves hang below shelf
+// units.
+const (
+	LocationBranch = "branch"
+	LocationFloor  = "floor"
+	LocationRoom   = "room"
+	LocationUnit   = "unit"
+	LocationShelf  = "shelf"
+)
+
+// Location is a branch, floor, room or shelf unit. Path is the breadcrumb
+// from the branch down to the location itself, kept so shelves and search
+// results can show where they are without walking the tree.
+type Location struct {
+	ID        bson.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Kind      string          `bson:"kind" json:"kind"`
+	Name      string          `bson:"name" json:"name"`
+	Key       string          `bson:"key" json:"-"`
+	ParentID  *bson.ObjectID  `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	Ancestors []bson.ObjectID `bson:"ancestors" json:"ancestors"`
+	Path      []LocationCrumb `bson:"path" json:"path"`
+	CreatedAt time.Time       `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time       `bson:"updated_at" json:"updated_at"`
+}
+
+type LocationCrumb struct {
+	ID   bson.ObjectID `bson:"id" json:"id"`
+	Kind string        `bson:"kind" json:"kind"`
+	Name string        `bson:"name" json:"name"`
+}
+
+// LocationNode is a location in the tree returned to clients, with the
+// shelves of a shelf unit.
+type LocationNode struct {
+	Location `bson:",inline"`
+	Children []LocationNode `bson:"-" json:"children"`
+	Shelves  []Shelf        `bson:"-" json:"shelves,omitempty"`
+}
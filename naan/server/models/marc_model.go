@@ -0,0 +1,28 @@
+package models
+
+// MARCRecord is a MARC 21 bibliographic record as read from ISO 2709 or
+// MARCXML.
+type MARCRecord struct {
+	Leader        string             `bson:"leader" json:"leader"`
+	ControlFields []MARCControlField `bson:"control_fields" json:"control_fields"`
+	DataFields    []MARCDataField    `bson:"data_fields" json:"data_fields"`
+}
+
+// MARCControlField is one of the 00X fields, which have no indicators or
+// subfields.
+type MARCControlField struct {
+	Tag   string `bson:"tag" json:"tag"`
+	Value string `bson:"value" json:"value"`
+}
+
+type MARCDataField struct {
+	Tag       string         `bson:"tag" json:"tag"`
+	Ind1      string         `bson:"ind1" json:"ind1"`
+	Ind2      string         `bson:"ind2" json:"ind2"`
+	Subfields []MARCSubfield `bson:"subfields" json:"subfields"`
+}
+
+type MARCSubfield struct {
+	Code  string `bson:"code" json:"code"`
+	Value string `bson:"value" json:"value"`
+}
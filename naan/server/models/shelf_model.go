@@ -5,4 +5,13 @@ import "go.mongodb.org/mongo-driver/v2/bson"
 type Shelf struct {
 	ID      bson.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
 	Address string        `bson:"address" json:"address"`
+	// LocationID is the shelf unit holding the shelf and Path the breadcrumb
+	// down to that unit. Shelves created before the location tree have
+	// neither.
+	LocationID *bson.ObjectID  `bson:"location_id,omitempty" json:"location_id,omitempty"`
+	Path       []LocationCrumb `bson:"path,omitempty" json:"path,omitempty"`
+	// Rows and Columns are the declared grid books are placed on, counted
+	// from 1. Zero means undeclared, which accepts any position.
+	Rows    int `bson:"rows,omitempty" json:"rows,omitempty"`
+	Columns int `bson:"columns,omitempty" json:"columns,omitempty"`
 }
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Subject is a heading in the controlled vocabulary. Ancestors lists the
+// broader subjects from the top of the tree down to the parent, so a
+// subtree is found with one query on it.
+type Subject struct {
+	ID        bson.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	Name      string          `bson:"name" json:"name"`
+	Key       string          `bson:"key" json:"-"`
+	ParentID  *bson.ObjectID  `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	Ancestors []bson.ObjectID `bson:"ancestors" json:"ancestors"`
+	ScopeNote string          `bson:"scope_note,omitempty" json:"scope_note,omitempty"`
+	CreatedAt time.Time       `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time       `bson:"updated_at" json:"updated_at"`
+}
+
+// SubjectNode is a subject in the tree returned to clients. BookCount
+// includes the books under narrower subjects.
+type SubjectNode struct {
+	Subject   `bson:",inline"`
+	BookCount int64         `bson:"book_count" json:"book_count"`
+	Children  []SubjectNode `bson:"-" json:"children"`
+}
+
+type TagCount struct {
+	Tag   string `bson:"_id" json:"tag"`
+	Count int64  `bson:"count" json:"count"`
+}
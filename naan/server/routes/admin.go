@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/handlers"
+)
+
+func InitAdmin(api fiber.Router) {
+	api = api.Group("/admin")
+
+	api.Get("/lockouts", handlers.ListLockouts)
+	api.Post("/unlock", handlers.UnlockLogin)
+	api.Post("/audit-logs", handlers.GetAuditLogs)
+	api.Get("/isbn-report", handlers.GetISBNReport)
+	api.Get("/author-report", handlers.GetContributorReport)
+	api.Get("/subject-report", handlers.GetSubjectReport)
+
+	api.Post("/import", handlers.StartImport)
+	api.Get("/import/:id", handlers.GetImport)
+	api.Post("/import/:id/resume", handlers.ResumeImport)
+	api.Get("/import/:id/errors", handlers.GetImportErrors)
+	api.Post("/marc/export", handlers.ExportMARCRecords)
+}
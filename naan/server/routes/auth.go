@@ -6,11 +6,22 @@ import (
 )
 
 func InitAuth(api fiber.Router) {
-	// api.Get("/login/dauth", handlers.LoginDauth)
-	// api.Get("/auth/dauth", handlers.DauthCallback)
-	api.Get("/login/google", handlers.LoginGoogle)
-	api.Get("/auth/google", handlers.GoogleCallback)
-
 	api.Post("/login/admin", handlers.LoginAdmin)
 
+	// google, dauth, keycloak, ... whatever OIDC_PROVIDERS configures
+	api.Get("/auth/providers", handlers.ListLoginProviders)
+	api.Get("/login/:provider", handlers.LoginOIDC)
+	api.Get("/auth/:provider", handlers.OIDCCallback)
+
+	api.Post("/auth/exchange", handlers.ExchangeLoginCode)
+	api.Post("/auth/refresh", handlers.RefreshToken)
+	api.Post("/auth/logout", handlers.Logout)
+
+	api.Get("/.well-known/jwks.json", handlers.GetJWKS)
+
+}
+
+// InitSession registers the auth routes that need a valid access token.
+func InitSession(api fiber.Router) {
+	api.Post("/auth/logout-all", handlers.LogoutAll)
 }
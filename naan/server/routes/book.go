@@ -11,11 +11,18 @@ func InitBook(api fiber.Router) {
 
 	api.Post("/create", handlers.CreateBook)
 	api.Post("/update", handlers.UpdateBook)
+	api.Post("/preview-isbn", handlers.PreviewISBN)
 	api.Post("/delete", handlers.DeleteBook)
+	api.Post("/cover", handlers.UploadCover)
+	api.Post("/cover/delete", handlers.DeleteCover)
 
 	api.Post("/get", handlers.GetBook)
+	api.Post("/detail", handlers.GetBookDetail)
 	api.Post("/check-in", handlers.CheckInBooks)
 	api.Post("/return", handlers.ReturnBooks)
 
 	api.Post("/all", handlers.GetAllBooks)
+	api.Post("/export", handlers.ExportBooks)
+	api.Get("/suggest", handlers.GetSuggestions)
+	api.Get("/authors", handlers.GetAuthors)
 }
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/handlers"
+)
+
+// InitCover serves cover images without a token, so they can be loaded
+// straight into image tags.
+func InitCover(api fiber.Router) {
+	api.Get("/cover/:id/:version/:size", handlers.GetCover)
+}
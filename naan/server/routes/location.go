@@ -0,0 +1,16 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/handlers"
+)
+
+func InitLocation(api fiber.Router) {
+	api = api.Group("/location")
+
+	api.Post("/tree", handlers.GetLocationTree)
+	api.Post("/create", handlers.CreateLocation)
+	api.Post("/rename", handlers.RenameLocation)
+	api.Post("/move", handlers.MoveLocation)
+	api.Post("/delete", handlers.DeleteLocation)
+}
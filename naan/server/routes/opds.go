@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/handlers"
+)
+
+// InitOPDS registers the OPDS catalog ahead of the JWT middleware; access is
+// decided by handlers.CatalogAccess.
+func InitOPDS(api fiber.Router) {
+	api = api.Group("/opds", handlers.CatalogAccess())
+
+	api.Get("/", handlers.OPDSRoot)
+	api.Get("/opensearch.xml", handlers.OPDSOpenSearch)
+	api.Get("/search", handlers.OPDSSearch)
+	api.Get("/new", handlers.OPDSNewArrivals)
+	api.Get("/all", handlers.OPDSAllBooks)
+	api.Get("/genres", handlers.OPDSGenres)
+	api.Get("/genres/:genre", handlers.OPDSGenreBooks)
+	api.Get("/authors", handlers.OPDSAuthors)
+	api.Get("/authors/:author", handlers.OPDSAuthorBooks)
+	api.Get("/series", handlers.OPDSSeries)
+	api.Get("/series/:series", handlers.OPDSSeriesBooks)
+	api.Get("/books/:id", handlers.OPDSBook)
+}
@@ -12,4 +12,8 @@ func InitShelf(api fiber.Router) {
 	api.Post("/update", handlers.UpdateShelf)
 	api.Post("/delete", handlers.DeleteShelf)
 	api.Post("/all", handlers.GetAllShelves)
+	api.Post("/books", handlers.GetShelfList)
+	api.Post("/check-order", handlers.CheckShelfOrder)
+	api.Post("/map", handlers.GetShelfMap)
+	api.Post("/relocate", handlers.RelocateBooks)
 }
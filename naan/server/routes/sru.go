@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/handlers"
+)
+
+// InitSRU registers the SRU endpoint next to the OPDS feed, under the same
+// catalog access rules.
+func InitSRU(api fiber.Router) {
+	api.Get("/sru", handlers.CatalogAccess(), handlers.SRU)
+}
@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/handlers"
+)
+
+func InitSubject(api fiber.Router) {
+	api = api.Group("/subject")
+
+	api.Get("/tree", handlers.GetSubjectTree)
+	api.Post("/create", handlers.CreateSubject)
+	api.Post("/rename", handlers.RenameSubject)
+	api.Post("/move", handlers.MoveSubject)
+	api.Post("/merge", handlers.MergeSubjects)
+	api.Post("/delete", handlers.DeleteSubject)
+	api.Get("/:id", handlers.GetSubjectBooks)
+}
+
+func InitTag(api fiber.Router) {
+	api = api.Group("/tag")
+
+	api.Get("/all", handlers.GetTags)
+	api.Post("/apply", handlers.TagBooks)
+	api.Post("/rename", handlers.RenameTag)
+	api.Post("/delete", handlers.DeleteTag)
+}
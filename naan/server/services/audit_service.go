@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// Audit records an action performed during the request. The actor is taken
+// from the JWT locals when the route is authenticated. Failures are only
+// logged so that auditing never breaks the request itself.
+func Audit(c *fiber.Ctx, action string, details bson.M) {
+	RecordAudit(auditEntry(c, action, details))
+}
+
+// AuditEach records one entry per details, for a request acting on many
+// records at once such as a bulk move.
+func AuditEach(c *fiber.Ctx, action string, details []bson.M) {
+	if len(details) == 0 {
+		return
+	}
+	now := time.Now()
+	entries := make([]models.AuditLog, 0, len(details))
+	for _, d := range details {
+		entry := auditEntry(c, action, d)
+		entry.CreatedAt = now
+		entries = append(entries, entry)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := config.GetAuditLogCollection().InsertMany(ctx, entries); err != nil {
+		log.Printf("audit log insert error (%s): %v", action, err)
+	}
+}
+
+func auditEntry(c *fiber.Ctx, action string, details bson.M) models.AuditLog {
+	entry := models.AuditLog{
+		Action:  action,
+		IP:      c.IP(),
+		Details: details,
+	}
+	if userType, ok := c.Locals("user_type").(string); ok {
+		entry.ActorType = userType
+	}
+	if userID, ok := c.Locals("user_id").(string); ok {
+		entry.ActorID = userID
+	}
+	return entry
+}
+
+func RecordAudit(entry models.AuditLog) {
+	entry.CreatedAt = time.Now()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := config.GetAuditLogCollection().InsertOne(ctx, entry); err != nil {
+		log.Printf("audit log insert error (%s): %v", entry.Action, err)
+	}
+}
@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// contributorRoles maps the role names and relator terms found in catalog
+// data ("ed.", "trans.", MARC $e) to a contributor role.
+var contributorRoles = map[string]string{
+	"":              models.RoleAuthor,
+	"author":        models.RoleAuthor,
+	"aut":           models.RoleAuthor,
+	"writer":        models.RoleAuthor,
+	"editor":        models.RoleEditor,
+	"edt":           models.RoleEditor,
+	"ed":            models.RoleEditor,
+	"eds":           models.RoleEditor,
+	"translator":    models.RoleTranslator,
+	"trl":           models.RoleTranslator,
+	"trans":         models.RoleTranslator,
+	"tr":            models.RoleTranslator,
+	"illustrator":   models.RoleIllustrator,
+	"ill":           models.RoleIllustrator,
+	"illus":         models.RoleIllustrator,
+	"illustrations": models.RoleIllustrator,
+}
+
+// ContributorRole resolves a role name or relator term.
+func ContributorRole(term string) (string, error) {
+	key := strings.Trim(strings.ToLower(strings.TrimSpace(term)), ".,;: ")
+	if role, ok := contributorRoles[key]; ok {
+		return role, nil
+	}
+	return "", fmt.Errorf("unknown contributor role %q", term)
+}
+
+// NormalizeAuthorName puts a name in "Given Family" order with single spaces
+// and spaced initials: "Tolkien, J.R.R." becomes "J. R. R. Tolkien".
+func NormalizeAuthorName(name string) string {
+	name = invertedName(strings.Join(strings.Fields(name), " "))
+	// matches can't overlap, so "J.R.R." takes two passes
+	for spaced := ""; spaced != name; {
+		spaced = name
+		name = initialsPattern.ReplaceAllString(name, "$1 $2")
+	}
+	return name
+}
+
+var initialsPattern = regexp.MustCompile(`(\p{Lu}\.)(\p{L})`)
+
+// AuthorKey identifies an author regardless of how the name was written.
+func AuthorKey(name string) string {
+	return FoldText(NormalizeAuthorName(name))
+}
+
+// NormalizeContributors cleans names and roles, drops empty entries and
+// repeats, and puts authors first.
+func NormalizeContributors(contributors []models.Contributor) ([]models.Contributor, error) {
+	seen := map[string]bool{}
+	var authors, others []models.Contributor
+	for _, contributor := range contributors {
+		name := NormalizeAuthorName(contributor.Name)
+		if name == "" {
+			continue
+		}
+		role, err := ContributorRole(contributor.Role)
+		if err != nil {
+			return nil, err
+		}
+		key := role + "\x00" + AuthorKey(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		contributor.Name, contributor.Role = name, role
+		if role == models.RoleAuthor {
+			authors = append(authors, contributor)
+		} else {
+			others = append(others, contributor)
+		}
+	}
+	return append(authors, others...), nil
+}
+
+// ContributorsFromAuthorLine credits every name in an author line such as
+// "Andrew Hunt & David Thomas" as an author.
+func ContributorsFromAuthorLine(line string) []models.Contributor {
+	var contributors []models.Contributor
+	for _, name := range SplitAuthors(line) {
+		contributors = append(contributors, models.Contributor{Name: name, Role: models.RoleAuthor})
+	}
+	contributors, _ = NormalizeContributors(contributors)
+	return contributors
+}
+
+// BookContributors settles who is credited on a book being saved: the
+// contributor list when one is given, otherwise the names in the author
+// line.
+func BookContributors(contributors []models.Contributor, authorLine string) ([]models.Contributor, error) {
+	if len(contributors) == 0 {
+		return ContributorsFromAuthorLine(authorLine), nil
+	}
+	return NormalizeContributors(contributors)
+}
+
+// ParseContributors reads a contributor list as written in CSV imports:
+// "Name (role); Name". A name without a role is an author.
+func ParseContributors(spec string) ([]models.Contributor, error) {
+	var contributors []models.Contributor
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		contributor := models.Contributor{Name: part}
+		if match := contributorRolePattern.FindStringSubmatch(part); match != nil {
+			contributor.Name, contributor.Role = match[1], match[2]
+		}
+		contributors = append(contributors, contributor)
+	}
+	return NormalizeContributors(contributors)
+}
+
+var contributorRolePattern = regexp.MustCompile(`^(.*?)\s*\(([^()]*)\)$`)
+
+// FormatContributors is the inverse of ParseContributors.
+func FormatContributors(contributors []models.Contributor) string {
+	parts := make([]string, 0, len(contributors))
+	for _, contributor := range contributors {
+		if contributor.Role == models.RoleAuthor || contributor.Role == "" {
+			parts = append(parts, contributor.Name)
+		} else {
+			parts = append(parts, contributor.Name+" ("+contributor.Role+")")
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ContributorNames lists the names credited in one of the roles, or every
+// name when no role is given.
+func ContributorNames(contributors []models.Contributor, roles ...string) []string {
+	var names []string
+	for _, contributor := range contributors {
+		if len(roles) == 0 || containsString(roles, contributor.Role) {
+			names = append(names, contributor.Name)
+		}
+	}
+	return names
+}
+
+// ContributorAuthorLine is the author line shown for a book: its authors, or
+// for an edited collection its editors.
+func ContributorAuthorLine(contributors []models.Contributor) string {
+	if authors := ContributorNames(contributors, models.RoleAuthor); len(authors) > 0 {
+		return AuthorLine(authors)
+	}
+	return AuthorLine(ContributorNames(contributors, models.RoleEditor))
+}
+
+// BookAuthors returns a book's authors, reading the author line of books
+// that have not been migrated to contributor lists.
+func BookAuthors(book models.Book) []string {
+	if len(book.Contributors) == 0 {
+		return SplitAuthors(book.Author)
+	}
+	return ContributorNames(book.Contributors, models.RoleAuthor)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// LinkContributors points every contributor at their author document,
+// creating the ones not seen before.
+func LinkContributors(ctx context.Context, contributors []models.Contributor) ([]models.Contributor, error) {
+	collection := config.GetAuthorCollection()
+	linked := make([]models.Contributor, len(contributors))
+	for i, contributor := range contributors {
+		key := AuthorKey(contributor.Name)
+		var author models.Author
+		err := collection.FindOneAndUpdate(ctx, bson.M{"key": key}, bson.M{
+			"$setOnInsert": bson.M{
+				"name":       contributor.Name,
+				"sort_name":  invertName(contributor.Name),
+				"key":        key,
+				"created_at": time.Now(),
+			},
+		}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&author)
+		if err != nil {
+			return nil, err
+		}
+		contributor.AuthorID = author.ID
+		contributor.Name = author.Name
+		linked[i] = contributor
+	}
+	return linked, nil
+}
+
+// ListAuthors returns authors whose name has a word starting with prefix, in
+// sort name order, with the number of books crediting them.
+func ListAuthors(ctx context.Context, prefix string, skip, limit int64) ([]models.Author, int64, error) {
+	filter := bson.M{}
+	if key := FoldText(prefix); key != "" {
+		filter["key"] = bson.Regex{Pattern: `(^|\s)` + regexp.QuoteMeta(key)}
+	}
+	collection := config.GetAuthorCollection()
+	total, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$sort", Value: bson.D{{Key: "sort_name", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$skip", Value: skip}},
+		{{Key: "$limit", Value: limit}},
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "books"},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "contributors.author_id"},
+			{Key: "pipeline", Value: bson.A{bson.D{{Key: "$project", Value: bson.D{{Key: "_id", Value: 1}}}}}},
+			{Key: "as", Value: "books"},
+		}}},
+		{{Key: "$addFields", Value: bson.D{{Key: "book_count", Value: bson.D{{Key: "$size", Value: "$books"}}}}}},
+		{{Key: "$project", Value: bson.D{{Key: "books", Value: 0}}}},
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	authors := []models.Author{}
+	err = cursor.All(ctx, &authors)
+	return authors, total, err
+}
+
+type ContributorSplit struct {
+	BookID  bson.ObjectID `json:"book_id"`
+	Title   string        `json:"title"`
+	Author  string        `json:"author"`
+	Authors []string      `json:"authors"`
+}
+
+type ContributorReport struct {
+	Checked  int64              `json:"checked"`
+	Migrated int64              `json:"migrated"`
+	Missing  int64              `json:"missing"`
+	Split    []ContributorSplit `json:"split"`
+}
+
+// MigrateContributors gives books saved with only an author line a
+// contributor list, splitting lines that name several authors. Books are
+// only counted unless apply is set; the books whose line was split into
+// more than one author are listed for review either way.
+func MigrateContributors(ctx context.Context, apply bool) (ContributorReport, error) {
+	report := ContributorReport{Split: []ContributorSplit{}}
+	collection := config.GetBookCollection()
+	cursor, err := collection.Find(ctx, bson.M{"contributors.0": bson.M{"$exists": false}})
+	if err != nil {
+		return report, err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var book models.Book
+		if err := cursor.Decode(&book); err != nil {
+			return report, err
+		}
+		report.Checked++
+		contributors := ContributorsFromAuthorLine(book.Author)
+		if len(contributors) == 0 {
+			report.Missing++
+			continue
+		}
+		if len(contributors) > 1 {
+			report.Split = append(report.Split, ContributorSplit{
+				BookID:  book.ID,
+				Title:   book.Title,
+				Author:  book.Author,
+				Authors: ContributorNames(contributors),
+			})
+		}
+		report.Migrated++
+		if !apply {
+			continue
+		}
+		contributors, err := LinkContributors(ctx, contributors)
+		if err != nil {
+			return report, err
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": book.ID}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"contributors": contributors,
+				"author":       ContributorAuthorLine(contributors),
+				"author_key":   SortKey(ContributorAuthorLine(contributors)),
+			}}))
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+	if len(writes) > 0 {
+		if _, err := collection.BulkWrite(ctx, writes); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
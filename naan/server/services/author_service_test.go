@@ -0,0 +1,97 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+)
+
+func TestNormalizeAuthorName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Tolkien, J.R.R.", "J. R. R. Tolkien"},
+		{"Tolkien, J. R. R.", "J. R. R. Tolkien"},
+		{"J.R.R. Tolkien", "J. R. R. Tolkien"},
+		{"  George   Orwell ", "George Orwell"},
+		{"Orwell, George", "George Orwell"},
+		{"Le Guin, Ursula K.", "Ursula K. Le Guin"},
+		{"Plato", "Plato"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeAuthorName(tt.name); got != tt.want {
+			t.Errorf("NormalizeAuthorName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAuthorKey(t *testing.T) {
+	if a, b := AuthorKey("Tolkien, J.R.R."), AuthorKey("j. r. r. tolkien"); a != b {
+		t.Errorf("AuthorKey gave %q and %q for the same author", a, b)
+	}
+}
+
+func TestSplitAuthors(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"Andrew Hunt & David Thomas", []string{"Andrew Hunt", "David Thomas"}},
+		{"Andrew Hunt and David Thomas", []string{"Andrew Hunt", "David Thomas"}},
+		{"Hunt And Thomas", []string{"Hunt", "Thomas"}},
+		{"Kernighan; Ritchie; ", []string{"Kernighan", "Ritchie"}},
+		{"Tolkien, J.R.R.", []string{"Tolkien, J.R.R."}},
+		{"Alexander Andersen", []string{"Alexander Andersen"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := SplitAuthors(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitAuthors(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestContributorsFromAuthorLine(t *testing.T) {
+	got := ContributorsFromAuthorLine("Hunt, Andrew & Andrew Hunt & Thomas, David")
+	want := []models.Contributor{
+		{Name: "Andrew Hunt", Role: models.RoleAuthor},
+		{Name: "David Thomas", Role: models.RoleAuthor},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ContributorsFromAuthorLine = %v, want %v", got, want)
+	}
+}
+
+func TestParseContributors(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []models.Contributor
+		wantErr bool
+	}{
+		{"Tolkien, J.R.R.", []models.Contributor{{Name: "J. R. R. Tolkien", Role: models.RoleAuthor}}, false},
+		{"Christopher Tolkien (ed.); Tolkien, J.R.R.", []models.Contributor{
+			{Name: "J. R. R. Tolkien", Role: models.RoleAuthor},
+			{Name: "Christopher Tolkien", Role: models.RoleEditor},
+		}, false},
+		{"Homer; Robert Fagles (trans.); Homer (author)", []models.Contributor{
+			{Name: "Homer", Role: models.RoleAuthor},
+			{Name: "Robert Fagles", Role: models.RoleTranslator},
+		}, false},
+		{"Pauline Baynes (Illustrator)", []models.Contributor{{Name: "Pauline Baynes", Role: models.RoleIllustrator}}, false},
+		{" ; ", nil, false},
+		{"Someone (publisher)", nil, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseContributors(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseContributors(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseContributors(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+	}
+}
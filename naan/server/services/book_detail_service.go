@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const maxOtherCopies = 50
+
+// BookCopy is another copy of the same title, with where to find it.
+type BookCopy struct {
+	ID               bson.ObjectID          `json:"id"`
+	ShelfAddress     string                 `json:"shelf_address"`
+	LocationPath     []models.LocationCrumb `json:"location_path"`
+	Row              int                    `json:"row"`
+	Column           int                    `json:"column"`
+	CallNumber       string                 `json:"call_number,omitempty"`
+	Availability     string                 `json:"availability"`
+	ExpectedReturnAt *time.Time             `json:"expected_return_at,omitempty"`
+	HoldQueueLength  int64                  `json:"hold_queue_length"`
+}
+
+// BookDetail is everything a patron's book page shows: the record, where
+// it stands, whether it can be borrowed now and the other copies.
+type BookDetail struct {
+	models.Book
+	ShelfAddress     string                 `json:"shelf_address"`
+	LocationPath     []models.LocationCrumb `json:"location_path"`
+	Availability     string                 `json:"availability"`
+	ExpectedReturnAt *time.Time             `json:"expected_return_at,omitempty"`
+	HoldQueueLength  int64                  `json:"hold_queue_length"`
+	CoverURLs        map[string]string      `json:"cover_urls,omitempty"`
+	OtherCopies      []BookCopy             `json:"other_copies"`
+}
+
+// sameTitle matches the other copies of a book: those with its ISBN, or
+// with its exact title and author when it has none.
+func sameTitle(book models.Book) bson.M {
+	if book.ISBN != "" {
+		return bson.M{"_id": bson.M{"$ne": book.ID}, "isbn": book.ISBN}
+	}
+	return bson.M{"_id": bson.M{"$ne": book.ID}, "title": book.Title, "author": book.Author}
+}
+
+func shelvesByID(ctx context.Context, shelfIDs []bson.ObjectID) (map[bson.ObjectID]models.Shelf, error) {
+	cursor, err := config.GetShelfCollection().Find(ctx, bson.M{"_id": bson.M{"$in": shelfIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var shelves []models.Shelf
+	if err := cursor.All(ctx, &shelves); err != nil {
+		return nil, err
+	}
+	byID := make(map[bson.ObjectID]models.Shelf, len(shelves))
+	for _, shelf := range shelves {
+		byID[shelf.ID] = shelf
+	}
+	return byID, nil
+}
+
+// shelfLocation is the address and breadcrumb of a shelf, both empty for a
+// shelf that no longer exists.
+func shelfLocation(shelves map[bson.ObjectID]models.Shelf, shelfID bson.ObjectID) (string, []models.LocationCrumb) {
+	shelf, ok := shelves[shelfID]
+	if !ok {
+		return "", []models.LocationCrumb{}
+	}
+	return shelf.Address, LocationPath(shelf)
+}
+
+func bookAvailability(book models.Book) string {
+	if book.TakenByUserID != nil {
+		return AvailabilityOnLoan
+	}
+	return AvailabilityAvailable
+}
+
+// expectedReturn is when a book out on loan is due back, or nil if it is
+// on the shelf.
+func expectedReturn(bookID bson.ObjectID, onLoan bool, loans map[bson.ObjectID]time.Time) *time.Time {
+	issuedAt, ok := loans[bookID]
+	if !onLoan || !ok {
+		return nil
+	}
+	due := issuedAt.Add(LoanPeriod())
+	return &due
+}
+
+// GetBookDetail builds a book's detail page. The borrower is only shown to
+// admins.
+func GetBookDetail(ctx context.Context, bookID bson.ObjectID, admin bool) (BookDetail, error) {
+	var detail BookDetail
+	err := config.GetBookCollection().FindOne(ctx, bson.M{"_id": bookID}).Decode(&detail.Book)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return detail, ErrBookNotFound
+	}
+	if err != nil {
+		return detail, err
+	}
+
+	cursor, err := config.GetBookCollection().Find(ctx, sameTitle(detail.Book), options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetLimit(maxOtherCopies))
+	if err != nil {
+		return detail, err
+	}
+	var copies []models.Book
+	if err := cursor.All(ctx, &copies); err != nil {
+		return detail, err
+	}
+
+	books := append([]models.Book{detail.Book}, copies...)
+	bookIDs := make([]bson.ObjectID, 0, len(books))
+	shelfIDs := make([]bson.ObjectID, 0, len(books))
+	for _, book := range books {
+		bookIDs = append(bookIDs, book.ID)
+		shelfIDs = append(shelfIDs, book.ShelfID)
+	}
+	shelves, err := shelvesByID(ctx, shelfIDs)
+	if err != nil {
+		return detail, err
+	}
+	loans, err := OpenLoans(ctx, bookIDs)
+	if err != nil {
+		return detail, err
+	}
+	holds, err := HoldQueueLengths(ctx, bookIDs)
+	if err != nil {
+		return detail, err
+	}
+
+	detail.ShelfAddress, detail.LocationPath = shelfLocation(shelves, detail.ShelfID)
+	detail.Availability = bookAvailability(detail.Book)
+	detail.ExpectedReturnAt = expectedReturn(detail.ID, detail.TakenByUserID != nil, loans)
+	detail.HoldQueueLength = holds[detail.ID]
+	detail.OtherCopies = make([]BookCopy, 0, len(copies))
+	for _, book := range copies {
+		address, path := shelfLocation(shelves, book.ShelfID)
+		detail.OtherCopies = append(detail.OtherCopies, BookCopy{
+			ID:               book.ID,
+			ShelfAddress:     address,
+			LocationPath:     path,
+			Row:              book.Row,
+			Column:           book.Column,
+			CallNumber:       book.CallNumber,
+			Availability:     bookAvailability(book),
+			ExpectedReturnAt: expectedReturn(book.ID, book.TakenByUserID != nil, loans),
+			HoldQueueLength:  holds[book.ID],
+		})
+	}
+	if !admin {
+		detail.TakenByUserID = nil
+	}
+	return detail, nil
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	CallNumberDewey = "dewey"
+	CallNumberLC    = "lc"
+)
+
+var ErrCallNumber = errors.New("call number is neither a Dewey nor a Library of Congress number")
+
+// CallNumber is a parsed Dewey or Library of Congress call number. Class is
+// the classification number and Item the cutters, dates and volumes after
+// it. Key sorts call numbers in shelf order when compared as plain strings,
+// so Mongo can sort on it too.
+type CallNumber struct {
+	Scheme     string `json:"scheme"`
+	Normalized string `json:"normalized"`
+	Class      string `json:"class"`
+	Item       string `json:"item"`
+	Key        string `json:"-"`
+}
+
+var (
+	// "823.912 T649h", with the prime marks of "823/.912" already removed
+	deweyPattern = regexp.MustCompile(`^(\d{1,3})(?:\.(\d+))?\s*(.*)$`)
+	// "QA76.73.J38 H86 2010", "PR6039 .O32 H6 1937"
+	lcPattern     = regexp.MustCompile(`^([A-Z]{1,3})\s*(\d{1,4})(?:\.(\d+))?(\s*\..*|\s+.*)?$`)
+	itemTokens    = regexp.MustCompile(`[A-Z]+\d+[A-Z]*|[A-Z]+|\d+`)
+	cutterPattern = regexp.MustCompile(`^[A-Z]+\d+[A-Z]*$`)
+	numberPattern = regexp.MustCompile(`^\d+$`)
+	primeMarks    = strings.NewReplacer("/", "", "'", "")
+)
+
+// ParseCallNumber reads a Dewey number, which starts with digits, or a
+// Library of Congress number, which starts with class letters.
+func ParseCallNumber(raw string) (CallNumber, error) {
+	normalized := strings.Join(strings.Fields(raw), " ")
+	if normalized == "" {
+		return CallNumber{}, ErrCallNumber
+	}
+	upper := strings.ToUpper(normalized)
+	if upper[0] >= '0' && upper[0] <= '9' {
+		// prime marks only segment the class number
+		class, item, _ := strings.Cut(upper, " ")
+		match := deweyPattern.FindStringSubmatch(strings.TrimSpace(primeMarks.Replace(class) + " " + item))
+		if match == nil {
+			return CallNumber{}, ErrCallNumber
+		}
+		class = zeroPad(match[1], 3)
+		if match[2] != "" {
+			class += "." + match[2]
+		}
+		return CallNumber{
+			Scheme:     CallNumberDewey,
+			Normalized: normalized,
+			Class:      class,
+			Item:       itemPart(normalized, match[3]),
+			Key:        "D " + class + itemKey(match[3]),
+		}, nil
+	}
+	match := lcPattern.FindStringSubmatch(upper)
+	if match == nil {
+		return CallNumber{}, ErrCallNumber
+	}
+	class := match[1] + match[2]
+	// letters and number are separate parts of the key, so Q sorts before QA
+	key := "L " + match[1] + " " + zeroPad(match[2], 4)
+	if match[3] != "" {
+		class += "." + match[3]
+		key += "." + match[3]
+	}
+	return CallNumber{
+		Scheme:     CallNumberLC,
+		Normalized: normalized,
+		Class:      class,
+		Item:       itemPart(normalized, strings.TrimSpace(match[4])),
+		Key:        key + itemKey(match[4]),
+	}, nil
+}
+
+// itemPart takes the item part from the end of the call number as written,
+// keeping the cataloguer's case.
+func itemPart(normalized, item string) string {
+	if item == "" || len(item) > len(normalized) {
+		return item
+	}
+	return strings.TrimSpace(normalized[len(normalized)-len(item):])
+}
+
+// itemKey turns cutters, dates and volumes into key parts. Cutters are
+// decimal fractions and compare as written, so J38 comes before J4; plain
+// numbers are padded so v. 2 comes before v. 10. Every part starts with a
+// space, which sorts below letters and digits: a call number comes before
+// the same call number with more parts.
+func itemKey(item string) string {
+	var key strings.Builder
+	for _, token := range itemTokens.FindAllString(strings.ToUpper(item), -1) {
+		key.WriteByte(' ')
+		switch {
+		case cutterPattern.MatchString(token):
+			key.WriteString(token)
+		case numberPattern.MatchString(token):
+			key.WriteString(zeroPad(strings.TrimLeft(token, "0"), 6))
+		default:
+			key.WriteString(token)
+		}
+	}
+	return key.String()
+}
+
+func zeroPad(digits string, width int) string {
+	if len(digits) >= width {
+		return digits
+	}
+	return strings.Repeat("0", width-len(digits)) + digits
+}
+
+// CompareCallNumbers orders two call numbers as they stand on a shelf.
+func CompareCallNumbers(a, b CallNumber) int {
+	return strings.Compare(a.Key, b.Key)
+}
+
+// ShelvedBook is a book as seen when reading along a shelf.
+type ShelvedBook struct {
+	ID         bson.ObjectID `bson:"_id" json:"id"`
+	Title      string        `bson:"title" json:"title"`
+	Author     string        `bson:"author" json:"author"`
+	CallNumber string        `bson:"call_number,omitempty" json:"call_number,omitempty"`
+	Key        string        `bson:"call_number_key,omitempty" json:"-"`
+	Row        int           `bson:"row" json:"row"`
+	Column     int           `bson:"column" json:"column"`
+}
+
+func shelvedBooks(ctx context.Context, shelfID bson.ObjectID) ([]ShelvedBook, error) {
+	cursor, err := config.GetBookCollection().Find(ctx, bson.M{"shelf_id": shelfID}, options.Find().
+		SetProjection(bson.M{"title": 1, "author": 1, "call_number": 1, "call_number_key": 1, "row": 1, "column": 1}).
+		SetSort(bson.D{{Key: "row", Value: 1}, {Key: "column", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	books := []ShelvedBook{}
+	err = cursor.All(ctx, &books)
+	return books, err
+}
+
+// ShelfList returns the books on a shelf in call number order, with
+// unclassified books after them by title.
+func ShelfList(ctx context.Context, shelfID bson.ObjectID) ([]ShelvedBook, error) {
+	books, err := shelvedBooks(ctx, shelfID)
+	if err != nil {
+		return nil, err
+	}
+	sortShelfOrder(books)
+	return books, nil
+}
+
+func sortShelfOrder(books []ShelvedBook) {
+	sort.SliceStable(books, func(i, j int) bool {
+		a, b := books[i], books[j]
+		if (a.Key == "") != (b.Key == "") {
+			return b.Key == ""
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Title < b.Title
+	})
+}
+
+// ShelfOrderIssue is a book standing out of call number order. Previous
+// and Next are its neighbours on the shelf; BelongsAfter is the book it
+// should be moved after, or nil if it belongs at the start of the shelf.
+type ShelfOrderIssue struct {
+	Book         ShelvedBook  `json:"book"`
+	Previous     *ShelvedBook `json:"previous,omitempty"`
+	Next         *ShelvedBook `json:"next,omitempty"`
+	BelongsAfter *ShelvedBook `json:"belongs_after,omitempty"`
+}
+
+type ShelfOrderReport struct {
+	ShelfID      bson.ObjectID     `json:"shelf_id"`
+	Checked      int               `json:"checked"`
+	Unclassified int               `json:"unclassified"`
+	OutOfOrder   []ShelfOrderIssue `json:"out_of_order"`
+}
+
+// CheckShelfOrder reads a shelf left to right, row by row, and flags the
+// books shelved out of call number order. The longest run of books already
+// in order is taken as correct, so one misplaced book is flagged rather
+// than every book it displaced.
+func CheckShelfOrder(ctx context.Context, shelfID bson.ObjectID) (ShelfOrderReport, error) {
+	report := ShelfOrderReport{ShelfID: shelfID, OutOfOrder: []ShelfOrderIssue{}}
+	all, err := shelvedBooks(ctx, shelfID)
+	if err != nil {
+		return report, err
+	}
+	var books []ShelvedBook
+	for _, book := range all {
+		if book.Key == "" {
+			report.Unclassified++
+			continue
+		}
+		books = append(books, book)
+	}
+	report.Checked = len(books)
+
+	inOrder := longestOrderedRun(books)
+	var ordered []ShelvedBook
+	for i, book := range books {
+		if inOrder[i] {
+			ordered = append(ordered, book)
+		}
+	}
+	for i, book := range books {
+		if inOrder[i] {
+			continue
+		}
+		issue := ShelfOrderIssue{Book: book}
+		if i > 0 {
+			issue.Previous = &books[i-1]
+		}
+		if i+1 < len(books) {
+			issue.Next = &books[i+1]
+		}
+		// the last correctly shelved book that sorts no later than this one
+		at := sort.Search(len(ordered), func(j int) bool { return ordered[j].Key > book.Key })
+		if at > 0 {
+			issue.BelongsAfter = &ordered[at-1]
+		}
+		report.OutOfOrder = append(report.OutOfOrder, issue)
+	}
+	return report, nil
+}
+
+// longestOrderedRun marks a longest subsequence of books whose keys never
+// decrease.
+func longestOrderedRun(books []ShelvedBook) []bool {
+	// tails[k] is the index of the smallest last book of a run of length k+1
+	var tails []int
+	previous := make([]int, len(books))
+	for i, book := range books {
+		k := sort.Search(len(tails), func(j int) bool { return books[tails[j]].Key > book.Key })
+		previous[i] = -1
+		if k > 0 {
+			previous[i] = tails[k-1]
+		}
+		if k == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[k] = i
+		}
+	}
+	inOrder := make([]bool, len(books))
+	if len(tails) > 0 {
+		for i := tails[len(tails)-1]; i >= 0; i = previous[i] {
+			inOrder[i] = true
+		}
+	}
+	return inOrder
+}
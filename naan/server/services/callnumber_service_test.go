@@ -0,0 +1,76 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseCallNumber(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want CallNumber
+	}{
+		{"823.912 T649h", CallNumber{CallNumberDewey, "823.912 T649h", "823.912", "T649h", "D 823.912 T649H"}},
+		{"823/.912  T649h", CallNumber{CallNumberDewey, "823/.912 T649h", "823.912", "T649h", "D 823.912 T649H"}},
+		{"92 Smi", CallNumber{CallNumberDewey, "92 Smi", "092", "Smi", "D 092 SMI"}},
+		{"5", CallNumber{CallNumberDewey, "5", "005", "", "D 005"}},
+		{"QA76.73.J38 H86 2010", CallNumber{CallNumberLC, "QA76.73.J38 H86 2010", "QA76.73", ".J38 H86 2010", "L QA 0076.73 J38 H86 002010"}},
+		{"PR6039 .O32 H6 1937", CallNumber{CallNumberLC, "PR6039 .O32 H6 1937", "PR6039", ".O32 H6 1937", "L PR 6039 O32 H6 001937"}},
+		{"qa76 .j38", CallNumber{CallNumberLC, "qa76 .j38", "QA76", ".j38", "L QA 0076 J38"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseCallNumber(tt.raw)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseCallNumber(%q) = %+v, %v, want %+v", tt.raw, got, err, tt.want)
+		}
+	}
+
+	for _, raw := range []string{"", "   ", "Fiction", "ABCD12", "QA"} {
+		if _, err := ParseCallNumber(raw); err != ErrCallNumber {
+			t.Errorf("ParseCallNumber(%q) err = %v, want ErrCallNumber", raw, err)
+		}
+	}
+}
+
+func TestCallNumberShelfOrder(t *testing.T) {
+	// each list is in the order the books stand on the shelf
+	for _, shelf := range [][]string{
+		{"5 A", "92 Smi", "823.9", "823.912 T649h", "823.912 T649h v.2", "823.912 T649h v.10", "Q1"},
+		{"Q1", "QA76.73.J38 1999", "QA76.73.J38 H86 2010", "QA76.73.J4", "QA76.8", "QA100", "QB5"},
+	} {
+		for i := 1; i < len(shelf); i++ {
+			a, errA := ParseCallNumber(shelf[i-1])
+			b, errB := ParseCallNumber(shelf[i])
+			if errA != nil || errB != nil {
+				t.Fatalf("ParseCallNumber: %v, %v", errA, errB)
+			}
+			if CompareCallNumbers(a, b) >= 0 {
+				t.Errorf("%q (%s) should shelve before %q (%s)", shelf[i-1], a.Key, shelf[i], b.Key)
+			}
+		}
+	}
+}
+
+func TestLongestOrderedRun(t *testing.T) {
+	tests := []struct {
+		keys []string
+		want []bool
+	}{
+		{nil, []bool{}},
+		{[]string{"a", "b", "c"}, []bool{true, true, true}},
+		{[]string{"a", "a"}, []bool{true, true}},
+		{[]string{"b", "a"}, []bool{false, true}},
+		{[]string{"a", "b", "z", "c", "d"}, []bool{true, true, false, true, true}},
+		{[]string{"a", "c", "b", "d"}, []bool{true, false, true, true}},
+		{[]string{"d", "a", "b", "c"}, []bool{false, true, true, true}},
+	}
+	for _, tt := range tests {
+		books := make([]ShelvedBook, len(tt.keys))
+		for i, key := range tt.keys {
+			books[i].Key = key
+		}
+		if got := longestOrderedRun(books); !slices.Equal(got, tt.want) {
+			t.Errorf("longestOrderedRun(%v) = %v, want %v", tt.keys, got, tt.want)
+		}
+	}
+}
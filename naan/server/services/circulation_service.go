@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const defaultLoanPeriodDays = 14
+
+var ErrBookNotFound = errors.New("book not found")
+
+// LoanPeriod is how long a book is lent for, set in days by
+// LOAN_PERIOD_DAYS.
+func LoanPeriod() time.Duration {
+	days, err := strconv.Atoi(config.Env("LOAN_PERIOD_DAYS", strconv.Itoa(defaultLoanPeriodDays)))
+	if err != nil || days < 1 {
+		days = defaultLoanPeriodDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// OpenLoans finds when each of the given books that is out on loan was
+// issued, keyed by book ID.
+func OpenLoans(ctx context.Context, bookIDs []bson.ObjectID) (map[bson.ObjectID]time.Time, error) {
+	issued := map[bson.ObjectID]time.Time{}
+	if len(bookIDs) == 0 {
+		return issued, nil
+	}
+	cursor, err := config.GetHistoryCollection().Find(ctx, bson.M{
+		"book_id":     bson.M{"$in": bookIDs},
+		"returned_at": nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var loans []models.History
+	if err := cursor.All(ctx, &loans); err != nil {
+		return nil, err
+	}
+	for _, loan := range loans {
+		if loan.IssuedAt.After(issued[loan.BookID]) {
+			issued[loan.BookID] = loan.IssuedAt
+		}
+	}
+	return issued, nil
+}
+
+// HoldQueueLengths counts the active holds on each of the given books.
+// Books without holds are left out.
+func HoldQueueLengths(ctx context.Context, bookIDs []bson.ObjectID) (map[bson.ObjectID]int64, error) {
+	lengths := map[bson.ObjectID]int64{}
+	if len(bookIDs) == 0 {
+		return lengths, nil
+	}
+	cursor, err := config.GetHoldCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"book_id": bson.M{"$in": bookIDs}, "status": models.HoldActive}}},
+		{{Key: "$group", Value: bson.M{"_id": "$book_id", "count": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var counts []struct {
+		BookID bson.ObjectID `bson:"_id"`
+		Count  int64         `bson:"count"`
+	}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		lengths[count.BookID] = count.Count
+	}
+	return lengths, nil
+}
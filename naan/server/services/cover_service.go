@@ -0,0 +1,261 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	MaxCoverFileSize  = 3 << 20
+	maxCoverDimension = 4096
+	minCoverDimension = 64
+	CoverOriginal     = "original"
+)
+
+var (
+	ErrCoverTooLarge  = errors.New("cover image must be at most 3 MB")
+	ErrCoverType      = errors.New("cover image must be a JPEG, PNG or GIF")
+	ErrCoverDimension = errors.New("cover image must be between 64 and 4096 pixels on each side")
+	ErrCoverBook      = errors.New("book not found")
+)
+
+// CoverSizes are the widths thumbnails are made in. Images narrower than a
+// size are not scaled up.
+var CoverSizes = map[string]int{
+	"small":  120,
+	"medium": 320,
+	"large":  640,
+}
+
+var coverTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+func coverKey(bookID bson.ObjectID, version, size string) string {
+	return bookID.Hex() + "/" + version + "/" + size
+}
+
+// CoverPath is where a size of an uploaded cover is served.
+func CoverPath(bookID bson.ObjectID, cover *models.BookCover, size string) string {
+	return "/cover/" + bookID.Hex() + "/" + cover.Version + "/" + size
+}
+
+// CoverURLs lists a book's cover image in every size. Books without an
+// uploaded cover fall back to the cover URL found by metadata enrichment,
+// which then stands in for every size.
+func CoverURLs(base string, book models.Book) map[string]string {
+	urls := map[string]string{}
+	for size := range CoverSizes {
+		urls[size] = book.CoverURL
+	}
+	urls[CoverOriginal] = book.CoverURL
+	if book.Cover != nil {
+		for size := range urls {
+			urls[size] = base + CoverPath(book.ID, book.Cover, size)
+		}
+	} else if book.CoverURL == "" {
+		return nil
+	}
+	return urls
+}
+
+// CoverContentType is the type a stored size is served with: the uploaded
+// type for the original, JPEG for thumbnails.
+func CoverContentType(cover *models.BookCover, size string) string {
+	if size == CoverOriginal {
+		return cover.ContentType
+	}
+	return "image/jpeg"
+}
+
+// SaveCover checks an uploaded image, stores it with its thumbnails and
+// makes it the book's cover. The previous cover's files are removed.
+func SaveCover(ctx context.Context, bookID bson.ObjectID, data []byte) (models.BookCover, error) {
+	var cover models.BookCover
+	if len(data) > MaxCoverFileSize {
+		return cover, ErrCoverTooLarge
+	}
+	// the bytes decide the type, not the name or header the client sent
+	contentType := http.DetectContentType(data)
+	if !coverTypes[contentType] {
+		return cover, ErrCoverType
+	}
+	// check the size before decoding, so a huge image can't exhaust memory
+	dimensions, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return cover, ErrCoverType
+	}
+	if dimensions.Width < minCoverDimension || dimensions.Height < minCoverDimension ||
+		dimensions.Width > maxCoverDimension || dimensions.Height > maxCoverDimension {
+		return cover, ErrCoverDimension
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return cover, ErrCoverType
+	}
+
+	var book models.Book
+	err = config.GetBookCollection().FindOne(ctx, bson.M{"_id": bookID}, options.FindOne().
+		SetProjection(bson.M{"cover": 1})).Decode(&book)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return cover, ErrCoverBook
+	}
+	if err != nil {
+		return cover, err
+	}
+
+	sum := sha256.Sum256(data)
+	cover = models.BookCover{
+		Version:     hex.EncodeToString(sum[:6]),
+		ContentType: contentType,
+		Width:       dimensions.Width,
+		Height:      dimensions.Height,
+		Size:        int64(len(data)),
+		UploadedAt:  time.Now(),
+	}
+	if book.Cover != nil && book.Cover.Version == cover.Version {
+		return *book.Cover, nil
+	}
+	if err := coverStorage.Put(ctx, coverKey(bookID, cover.Version, CoverOriginal), contentType, data); err != nil {
+		return cover, err
+	}
+	flat := flattenImage(img)
+	for size, width := range CoverSizes {
+		var thumbnail bytes.Buffer
+		if err := jpeg.Encode(&thumbnail, resizeImage(flat, width), &jpeg.Options{Quality: 85}); err != nil {
+			return cover, err
+		}
+		if err := coverStorage.Put(ctx, coverKey(bookID, cover.Version, size), "image/jpeg", thumbnail.Bytes()); err != nil {
+			return cover, err
+		}
+	}
+
+	if _, err := config.GetBookCollection().UpdateOne(ctx, bson.M{"_id": bookID}, bson.M{"$set": bson.M{"cover": cover}}); err != nil {
+		return cover, err
+	}
+	if book.Cover != nil {
+		deleteCoverFiles(ctx, bookID, book.Cover.Version)
+	}
+	return cover, nil
+}
+
+// DeleteCover removes a book's uploaded cover. The enrichment cover URL, if
+// any, is shown again.
+func DeleteCover(ctx context.Context, bookID bson.ObjectID) error {
+	var book models.Book
+	err := config.GetBookCollection().FindOneAndUpdate(ctx, bson.M{"_id": bookID}, bson.M{"$unset": bson.M{"cover": ""}},
+		options.FindOneAndUpdate().SetProjection(bson.M{"cover": 1})).Decode(&book)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrCoverBook
+	}
+	if err != nil {
+		return err
+	}
+	if book.Cover != nil {
+		deleteCoverFiles(ctx, bookID, book.Cover.Version)
+	}
+	return nil
+}
+
+// deleteCoverFiles removes every size of one cover version. Failures only
+// leave unused files behind, so they are logged rather than returned.
+func deleteCoverFiles(ctx context.Context, bookID bson.ObjectID, version string) {
+	sizes := []string{CoverOriginal}
+	for size := range CoverSizes {
+		sizes = append(sizes, size)
+	}
+	for _, size := range sizes {
+		if err := coverStorage.Delete(ctx, coverKey(bookID, version, size)); err != nil {
+			log.Printf("⚠️ failed to delete cover %s: %v", coverKey(bookID, version, size), err)
+		}
+	}
+}
+
+// OpenCover opens a stored size of a book's current cover, returning the
+// cover with the image and its length.
+func OpenCover(ctx context.Context, bookID bson.ObjectID, version, size string) (*models.BookCover, io.ReadCloser, int64, error) {
+	if _, ok := CoverSizes[size]; !ok && size != CoverOriginal {
+		return nil, nil, 0, ErrCoverNotFound
+	}
+	var book models.Book
+	err := config.GetBookCollection().FindOne(ctx, bson.M{"_id": bookID, "cover.version": version}, options.FindOne().
+		SetProjection(bson.M{"cover": 1})).Decode(&book)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && book.Cover == nil) {
+		return nil, nil, 0, ErrCoverNotFound
+	}
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	body, length, err := coverStorage.Get(ctx, coverKey(bookID, version, size))
+	return book.Cover, body, length, err
+}
+
+// flattenImage copies an image onto white, so transparent PNGs don't come
+// out black as JPEG thumbnails.
+func flattenImage(src image.Image) *image.RGBA {
+	bounds := src.Bounds()
+	flat := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Over)
+	return flat
+}
+
+// resizeImage scales an image down to width, keeping its aspect ratio. Each
+// pixel is the average of the source pixels it covers, which keeps text on
+// covers readable where picking single pixels would alias.
+func resizeImage(src *image.RGBA, width int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if width >= sw {
+		return src
+	}
+	height := sh * width / sw
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*sh/height, (y+1)*sh/height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0, x1 := x*sw/width, (x+1)*sw/width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			var r, g, b, n int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					r += int(row[sx*4])
+					g += int(row[sx*4+1])
+					b += int(row[sx*4+2])
+					n++
+				}
+			}
+			i := y*dst.Stride + x*4
+			dst.Pix[i], dst.Pix[i+1], dst.Pix[i+2], dst.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), 255
+		}
+	}
+	return dst
+}
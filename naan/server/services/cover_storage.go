@@ -0,0 +1,315 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrCoverNotFound = errors.New("cover image not found")
+
+// CoverStorage keeps cover images under keys such as
+// "<book id>/<version>/small". Get returns ErrCoverNotFound for unknown keys.
+type CoverStorage interface {
+	Name() string
+	Put(ctx context.Context, key, contentType string, data []byte) error
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var coverStorage CoverStorage
+
+// LoadCoverStorage sets up the backend named by COVER_STORAGE: local (files
+// under COVER_DIR), gridfs (the "covers" bucket of the database) or s3 (any
+// S3-compatible service, see COVER_S3_*). GridFS needs the database to be
+// connected first.
+func LoadCoverStorage() error {
+	switch name := strings.ToLower(config.Env("COVER_STORAGE", "local")); name {
+	case "local":
+		coverStorage = localCoverStorage{dir: config.Env("COVER_DIR", "covers")}
+	case "gridfs":
+		coverStorage = gridFSCoverStorage{bucket: config.DB.Database(config.Env("DB_NAME", "my_db")).
+			GridFSBucket(options.GridFSBucket().SetName("covers"))}
+	case "s3":
+		storage := s3CoverStorage{
+			endpoint:  strings.TrimRight(config.Env("COVER_S3_ENDPOINT", "https://s3.amazonaws.com"), "/"),
+			bucket:    config.Env("COVER_S3_BUCKET", ""),
+			region:    config.Env("COVER_S3_REGION", "us-east-1"),
+			accessKey: config.Env("COVER_S3_ACCESS_KEY", ""),
+			secretKey: config.Env("COVER_S3_SECRET_KEY", ""),
+			client:    &http.Client{Timeout: 30 * time.Second},
+		}
+		if storage.bucket == "" || storage.accessKey == "" || storage.secretKey == "" {
+			return errors.New("COVER_S3_BUCKET, COVER_S3_ACCESS_KEY and COVER_S3_SECRET_KEY are required for s3 cover storage")
+		}
+		coverStorage = storage
+	default:
+		return fmt.Errorf("unknown cover storage %s", name)
+	}
+	return nil
+}
+
+type localCoverStorage struct {
+	dir string
+}
+
+func (localCoverStorage) Name() string { return "local" }
+
+func (s localCoverStorage) path(key string) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.dir)+string(filepath.Separator)) {
+		return "", ErrCoverNotFound
+	}
+	return path, nil
+}
+
+func (s localCoverStorage) Put(_ context.Context, key, _ string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// write then rename, so a half written image is never served
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s localCoverStorage) Get(_ context.Context, key string) (io.ReadCloser, int64, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, ErrCoverNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+func (s localCoverStorage) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	// drop the version directory once it is empty
+	os.Remove(filepath.Dir(path))
+	return err
+}
+
+type gridFSCoverStorage struct {
+	bucket *mongo.GridFSBucket
+}
+
+func (gridFSCoverStorage) Name() string { return "gridfs" }
+
+func (s gridFSCoverStorage) Put(ctx context.Context, key, contentType string, data []byte) error {
+	stream, err := s.bucket.OpenUploadStream(ctx, key,
+		options.GridFSUpload().SetMetadata(bson.M{"content_type": contentType}))
+	if err != nil {
+		return err
+	}
+	if _, err := stream.Write(data); err != nil {
+		stream.Abort()
+		return err
+	}
+	return stream.Close()
+}
+
+func (s gridFSCoverStorage) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	stream, err := s.bucket.OpenDownloadStreamByName(ctx, key)
+	if errors.Is(err, mongo.ErrFileNotFound) {
+		return nil, 0, ErrCoverNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return stream, stream.GetFile().Length, nil
+}
+
+func (s gridFSCoverStorage) Delete(ctx context.Context, key string) error {
+	cursor, err := s.bucket.Find(ctx, bson.M{"filename": key})
+	if err != nil {
+		return err
+	}
+	var files []struct {
+		ID bson.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &files); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := s.bucket.Delete(ctx, file.ID); err != nil && !errors.Is(err, mongo.ErrFileNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// s3CoverStorage talks to S3 or a compatible service (MinIO, R2, Spaces)
+// with path style URLs and AWS Signature Version 4.
+type s3CoverStorage struct {
+	endpoint  string
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+func (s3CoverStorage) Name() string { return "s3" }
+
+func (s s3CoverStorage) do(ctx context.Context, method, key, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.endpoint+"/"+s.bucket+"/"+key, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	signS3Request(req, body, s.region, s.accessKey, s.secretKey, time.Now())
+	return s.client.Do(req)
+}
+
+func (s s3CoverStorage) Put(ctx context.Context, key, contentType string, data []byte) error {
+	resp, err := s.do(ctx, http.MethodPut, key, contentType, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3 put %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+func (s s3CoverStorage) Get(ctx context.Context, key string) (io.ReadCloser, int64, error) {
+	resp, err := s.do(ctx, http.MethodGet, key, "", nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.ContentLength, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, 0, ErrCoverNotFound
+	}
+	resp.Body.Close()
+	return nil, 0, fmt.Errorf("s3 get %s: %s", key, resp.Status)
+}
+
+func (s s3CoverStorage) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, key, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("s3 delete %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// signS3Request adds AWS Signature Version 4 headers to a request without a
+// query string, signing the host, every x-amz-* header and any range.
+func signS3Request(req *http.Request, body []byte, region, accessKey, secretKey string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payload[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3EscapePath(req.URL.Path),
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath escapes each path segment the way S3 expects: everything but
+// unreserved characters.
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,354 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// CQLError is a query SRU reports back as a diagnostic: Code is the number
+// in info:srw/diagnostic/1/<code>.
+type CQLError struct {
+	Code    int
+	Details string
+	Message string
+}
+
+func (e *CQLError) Error() string {
+	return e.Message + ": " + e.Details
+}
+
+const (
+	CQLSyntaxError          = 10
+	CQLUnsupportedIndex     = 16
+	CQLUnsupportedRelation  = 19
+	CQLUnsupportedBoolean   = 37
+	CQLTooComplex           = 27
+	cqlMaxClauses           = 32
+	cqlServerChoice         = "cql.serverchoice"
+	cqlRelationServerChoice = "="
+)
+
+// cqlIndexes maps the CQL indexes we understand, with or without their
+// context set prefix, to the book fields they search.
+var cqlIndexes = map[string][]string{
+	"cql.serverchoice": {"title", "contributors.name", "series", "genre", "subjects", "publisher", "isbn"},
+	"cql.anywhere":     {"title", "contributors.name", "series", "genre", "subjects", "publisher", "isbn"},
+	"title":            {"title"},
+	"dc.title":         {"title"},
+	"author":           {"contributors.name"},
+	"creator":          {"contributors.name"},
+	"dc.creator":       {"contributors.name"},
+	"bath.author":      {"contributors.name"},
+	"dc.contributor":   {"contributors.name"},
+	"series":           {"series"},
+	"bath.seriestitle": {"series"},
+	"subject":          {"genre", "subjects"},
+	"dc.subject":       {"genre", "subjects"},
+	"bath.subject":     {"genre", "subjects"},
+	"isbn":             {"isbn"},
+	"bath.isbn":        {"isbn"},
+	"dc.identifier":    {"isbn"},
+	"publisher":        {"publisher"},
+	"dc.publisher":     {"publisher"},
+}
+
+// CQLIndexes lists the index names explain advertises.
+var CQLIndexes = []struct{ Set, Name, Title string }{
+	{"dc", "title", "Title"},
+	{"dc", "creator", "Author"},
+	{"dc", "subject", "Subject"},
+	{"dc", "publisher", "Publisher"},
+	{"bath", "seriesTitle", "Series"},
+	{"bath", "isbn", "ISBN"},
+	{"cql", "serverChoice", "Any field"},
+}
+
+type cqlToken struct {
+	text   string
+	quoted bool
+}
+
+func tokenizeCQL(query string) ([]cqlToken, error) {
+	var tokens []cqlToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, cqlToken{text: string(r)})
+			i++
+		case r == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != '"'; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				b.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, &CQLError{CQLSyntaxError, query, "unterminated quoted string"}
+			}
+			i++
+			tokens = append(tokens, cqlToken{text: b.String(), quoted: true})
+		case r == '=' || r == '<' || r == '>':
+			j := i + 1
+			for j < len(runes) && (runes[j] == '=' || runes[j] == '>') {
+				j++
+			}
+			tokens = append(tokens, cqlToken{text: string(runes[i:j])})
+			i = j
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()"=<>`, runes[j]) {
+				j++
+			}
+			tokens = append(tokens, cqlToken{text: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type cqlParser struct {
+	query   string
+	tokens  []cqlToken
+	pos     int
+	clauses int
+}
+
+// ParseCQL translates a CQL query into a books filter. It supports the
+// indexes in cqlIndexes, the relations =, ==, adj, all, any and <>, the
+// booleans AND, OR and NOT, parentheses and * and ? wildcards.
+func ParseCQL(query string) (bson.M, error) {
+	tokens, err := tokenizeCQL(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, &CQLError{CQLSyntaxError, query, "empty query"}
+	}
+	p := &cqlParser{query: query, tokens: tokens}
+	filter, err := p.parseBoolean()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, p.syntaxError("unexpected " + p.tokens[p.pos].text)
+	}
+	return filter, nil
+}
+
+func (p *cqlParser) syntaxError(message string) error {
+	return &CQLError{CQLSyntaxError, p.query, message}
+}
+
+func (p *cqlParser) peek() (cqlToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return cqlToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *cqlParser) parseBoolean() (bson.M, error) {
+	left, err := p.parseClause()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		token, ok := p.peek()
+		if !ok || token.quoted {
+			return left, nil
+		}
+		op, _, _ := strings.Cut(strings.ToLower(token.text), "/")
+		if op != "and" && op != "or" && op != "not" && op != "prox" {
+			return left, nil
+		}
+		if op == "prox" {
+			return nil, &CQLError{CQLUnsupportedBoolean, token.text, "unsupported boolean operator"}
+		}
+		p.pos++
+		p.skipModifiers(strings.Contains(token.text, "/"))
+		right, err := p.parseClause()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "and":
+			left = bson.M{"$and": bson.A{left, right}}
+		case "or":
+			left = bson.M{"$or": bson.A{left, right}}
+		case "not":
+			left = bson.M{"$and": bson.A{left, bson.M{"$nor": bson.A{right}}}}
+		}
+	}
+}
+
+// skipModifiers steps over a boolean's modifiers, such as the /rel.combine=sum
+// in or/rel.combine=sum, which don't change matching. The tokenizer splits
+// a modifier's comparison and value off into tokens of their own.
+func (p *cqlParser) skipModifiers(modified bool) {
+	for {
+		next, ok := p.peek()
+		switch {
+		case ok && !next.quoted && strings.HasPrefix(next.text, "/"):
+			modified = true
+			p.pos++
+		case ok && modified && !next.quoted && strings.ContainsAny(next.text[:1], "=<>") && p.pos+1 < len(p.tokens):
+			p.pos += 2
+		default:
+			return
+		}
+	}
+}
+
+func (p *cqlParser) parseClause() (bson.M, error) {
+	token, ok := p.peek()
+	if !ok {
+		return nil, p.syntaxError("query ends early")
+	}
+	if !token.quoted && token.text == "(" {
+		p.pos++
+		inner, err := p.parseBoolean()
+		if err != nil {
+			return nil, err
+		}
+		if closing, ok := p.peek(); !ok || closing.quoted || closing.text != ")" {
+			return nil, p.syntaxError("missing )")
+		}
+		p.pos++
+		return inner, nil
+	}
+	if !token.quoted && token.text == ")" {
+		return nil, p.syntaxError("unexpected )")
+	}
+
+	p.clauses++
+	if p.clauses > cqlMaxClauses {
+		return nil, &CQLError{CQLTooComplex, p.query, "query has too many terms"}
+	}
+
+	index, relation := cqlServerChoice, cqlRelationServerChoice
+	if p.pos+1 < len(p.tokens) && !token.quoted && isCQLRelation(p.tokens[p.pos+1]) {
+		index = strings.ToLower(token.text)
+		relation = strings.ToLower(p.tokens[p.pos+1].text)
+		p.pos += 2
+		if p.pos >= len(p.tokens) {
+			return nil, p.syntaxError("missing search term")
+		}
+	}
+	term := p.tokens[p.pos]
+	if !term.quoted && (term.text == "(" || term.text == ")") {
+		return nil, p.syntaxError("missing search term")
+	}
+	p.pos++
+	return cqlTermFilter(index, relation, term.text)
+}
+
+func isCQLRelation(token cqlToken) bool {
+	if token.quoted {
+		return false
+	}
+	switch strings.ToLower(token.text) {
+	case "=", "==", "<>", "adj", "all", "any", "exact", "<", ">", "<=", ">=", "within", "encloses":
+		return true
+	}
+	return false
+}
+
+// cqlTermFilter matches a term against every field of the index.
+func cqlTermFilter(index, relation, term string) (bson.M, error) {
+	fields, ok := cqlIndexes[index]
+	if !ok {
+		return nil, &CQLError{CQLUnsupportedIndex, index, "unsupported index"}
+	}
+
+	var matchers []func(field string) bson.M
+	words := strings.Fields(term)
+	switch relation {
+	case "==", "exact":
+		matchers = append(matchers, func(field string) bson.M {
+			return bson.M{field: bson.Regex{Pattern: "^" + cqlPattern(term) + "$", Options: "i"}}
+		})
+	case "=", "adj":
+		// a phrase, so its words must appear in order
+		matchers = append(matchers, func(field string) bson.M {
+			return bson.M{field: bson.Regex{Pattern: cqlPhrasePattern(words), Options: "i"}}
+		})
+	case "all", "any":
+		for _, word := range words {
+			word := word
+			matchers = append(matchers, func(field string) bson.M {
+				return bson.M{field: bson.Regex{Pattern: cqlPattern(word), Options: "i"}}
+			})
+		}
+	case "<>":
+		return bson.M{"$nor": bson.A{cqlFieldsFilter(fields, func(field string) bson.M {
+			return bson.M{field: bson.Regex{Pattern: "^" + cqlPattern(term) + "$", Options: "i"}}
+		})}}, nil
+	default:
+		return nil, &CQLError{CQLUnsupportedRelation, relation, "unsupported relation"}
+	}
+	if len(matchers) == 0 {
+		// an empty term matches every record
+		return bson.M{}, nil
+	}
+
+	if len(fields) == 1 && fields[0] == "isbn" && !strings.ContainsAny(term, "*?") {
+		if isbn, err := NormalizeISBN(term); err == nil {
+			return bson.M{"isbn": isbn}, nil
+		}
+	}
+
+	clauses := bson.A{}
+	for _, matcher := range matchers {
+		clauses = append(clauses, cqlFieldsFilter(fields, matcher))
+	}
+	if len(clauses) == 1 {
+		return clauses[0].(bson.M), nil
+	}
+	if relation == "any" {
+		return bson.M{"$or": clauses}, nil
+	}
+	return bson.M{"$and": clauses}, nil
+}
+
+func cqlFieldsFilter(fields []string, matcher func(field string) bson.M) bson.M {
+	if len(fields) == 1 {
+		return matcher(fields[0])
+	}
+	alternatives := bson.A{}
+	for _, field := range fields {
+		alternatives = append(alternatives, matcher(field))
+	}
+	return bson.M{"$or": alternatives}
+}
+
+// cqlPattern escapes a term for a regex, keeping CQL's * and ? wildcards.
+func cqlPattern(term string) string {
+	pattern := regexp.QuoteMeta(term)
+	pattern = strings.ReplaceAll(pattern, `\*`, `.*`)
+	return strings.ReplaceAll(pattern, `\?`, `.`)
+}
+
+func cqlPhrasePattern(words []string) string {
+	parts := make([]string, len(words))
+	for i, word := range words {
+		parts[i] = cqlPattern(word)
+	}
+	return strings.Join(parts, `\W+`)
+}
+
+// DescribeCQLError gives the diagnostic URI for an error from ParseCQL.
+func DescribeCQLError(err error) (string, string, string) {
+	if cqlErr, ok := err.(*CQLError); ok {
+		return fmt.Sprintf("info:srw/diagnostic/1/%d", cqlErr.Code), cqlErr.Details, cqlErr.Message
+	}
+	return "info:srw/diagnostic/1/1", "", err.Error()
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestParseCQL(t *testing.T) {
+	re := func(field, pattern string) bson.M {
+		return bson.M{field: bson.Regex{Pattern: pattern, Options: "i"}}
+	}
+	tests := []struct {
+		query string
+		want  bson.M
+	}{
+		{`dc.title = dune`, re("title", "dune")},
+		{`title = "left hand of darkness"`, re("title", `left\W+hand\W+of\W+darkness`)},
+		{`TITLE == "Dune"`, re("title", "^Dune$")},
+		{`title = dun*`, re("title", "dun.*")},
+		{`title = "c++ ?"`, re("title", `c\+\+\W+.`)},
+		{`author all "ursula guin"`, bson.M{"$and": bson.A{re("contributors.name", "ursula"), re("contributors.name", "guin")}}},
+		{`author any "le guin"`, bson.M{"$or": bson.A{re("contributors.name", "le"), re("contributors.name", "guin")}}},
+		{`subject = poetry`, bson.M{"$or": bson.A{re("genre", "poetry"), re("subjects", "poetry")}}},
+		{`publisher <> tor`, bson.M{"$nor": bson.A{re("publisher", "^tor$")}}},
+		{`bath.isbn = 0-306-40615-2`, bson.M{"isbn": "9780306406157"}},
+		{`isbn = 978030640*`, re("isbn", "978030640.*")},
+		{`title any ""`, bson.M{}},
+		{`title = dune and author = herbert`, bson.M{"$and": bson.A{re("title", "dune"), re("contributors.name", "herbert")}}},
+		{`title = dune OR title = emma`, bson.M{"$or": bson.A{re("title", "dune"), re("title", "emma")}}},
+		{`title = dune not series = messiah`, bson.M{"$and": bson.A{re("title", "dune"), bson.M{"$nor": bson.A{re("series", "messiah")}}}}},
+		{`title = dune or/rel.combine=sum title = emma`, bson.M{"$or": bson.A{re("title", "dune"), re("title", "emma")}}},
+		{`title = dune or /rel.combine=sum /x title = emma`, bson.M{"$or": bson.A{re("title", "dune"), re("title", "emma")}}},
+		{`(title = a or title = b) and title = c`, bson.M{"$and": bson.A{bson.M{"$or": bson.A{re("title", "a"), re("title", "b")}}, re("title", "c")}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseCQL(tt.query)
+		if err != nil {
+			t.Errorf("ParseCQL(%q): %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCQL(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseCQLServerChoice(t *testing.T) {
+	got, err := ParseCQL(`dune`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alternatives, ok := got["$or"].(bson.A)
+	if !ok || len(alternatives) != len(cqlIndexes[cqlServerChoice]) {
+		t.Fatalf("ParseCQL(dune) = %v, want a match on every server choice field", got)
+	}
+	for i, field := range cqlIndexes[cqlServerChoice] {
+		want := bson.M{field: bson.Regex{Pattern: "dune", Options: "i"}}
+		if !reflect.DeepEqual(alternatives[i], want) {
+			t.Errorf("alternative %d = %v, want %v", i, alternatives[i], want)
+		}
+	}
+}
+
+func TestParseCQLErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{``, CQLSyntaxError},
+		{`title = "dune`, CQLSyntaxError},
+		{`(title = dune`, CQLSyntaxError},
+		{`title = dune)`, CQLSyntaxError},
+		{`title =`, CQLSyntaxError},
+		{`title = dune and`, CQLSyntaxError},
+		{`shoe_size = 9`, CQLUnsupportedIndex},
+		{`title within dune`, CQLUnsupportedRelation},
+		{`title = a prox title = b`, CQLUnsupportedBoolean},
+		{strings.Repeat(`title = a or `, cqlMaxClauses) + `title = a`, CQLTooComplex},
+	}
+	for _, tt := range tests {
+		_, err := ParseCQL(tt.query)
+		var cqlErr *CQLError
+		if !errors.As(err, &cqlErr) || cqlErr.Code != tt.code {
+			t.Errorf("ParseCQL(%q) err = %v, want diagnostic %d", tt.query, err, tt.code)
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrMetadataNotFound = errors.New("no metadata found for ISBN")
+
+const (
+	metadataCacheTTL     = 30 * 24 * time.Hour
+	metadataMissCacheTTL = 24 * time.Hour
+	// EnrichTimeout bounds a whole lookup across all providers, so a request
+	// that enriches a book still has time left to save it.
+	EnrichTimeout = 5 * time.Second
+)
+
+// each provider gets a share of EnrichTimeout, a slow one can't use it all up
+var metadataHTTPClient = &http.Client{Timeout: 3 * time.Second}
+
+// MetadataProvider looks up a book by its canonical ISBN-13 and returns
+// ErrMetadataNotFound when it does not know it.
+type MetadataProvider interface {
+	Name() string
+	Lookup(ctx context.Context, isbn string) (models.BookMetadata, error)
+}
+
+var metadataProviders []MetadataProvider
+
+// LoadMetadataProviders reads the providers listed in METADATA_PROVIDERS, in
+// the order they are asked: openlibrary, googlebooks (GOOGLE_BOOKS_API_KEY is
+// optional) and fixture, which serves METADATA_FIXTURE_FILE for offline use.
+func LoadMetadataProviders() {
+	providers := []MetadataProvider{}
+	for _, name := range strings.Split(config.Env("METADATA_PROVIDERS", "openlibrary,googlebooks"), ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "openlibrary":
+			providers = append(providers, openLibraryProvider{})
+		case "googlebooks":
+			providers = append(providers, googleBooksProvider{apiKey: config.Env("GOOGLE_BOOKS_API_KEY", "")})
+		case "fixture":
+			provider, err := loadFixtureProvider(config.Env("METADATA_FIXTURE_FILE", "metadata_fixture.json"))
+			if err != nil {
+				log.Printf("⚠️ skipping metadata provider fixture: %v", err)
+				continue
+			}
+			providers = append(providers, provider)
+		default:
+			log.Printf("⚠️ skipping unknown metadata provider %s", name)
+		}
+	}
+	metadataProviders = providers
+}
+
+// EnrichOnCreate reports whether new books get their empty fields filled in
+// from their ISBN without the client asking for it.
+func EnrichOnCreate() bool {
+	return config.Env("ENRICH_ON_CREATE", "false") == "true"
+}
+
+type metadataCacheEntry struct {
+	ISBN      string               `bson:"isbn"`
+	Found     bool                 `bson:"found"`
+	Metadata  *models.BookMetadata `bson:"metadata,omitempty"`
+	FetchedAt time.Time            `bson:"fetched_at"`
+	ExpiresAt time.Time            `bson:"expires_at"`
+}
+
+// metadataCache keeps lookups by ISBN; entries are returned even once
+// expired, LookupMetadata checks ExpiresAt.
+type metadataCache interface {
+	get(ctx context.Context, isbn string) (metadataCacheEntry, bool)
+	put(ctx context.Context, entry metadataCacheEntry) error
+}
+
+type mongoMetadataCache struct{}
+
+func (mongoMetadataCache) get(ctx context.Context, isbn string) (metadataCacheEntry, bool) {
+	var entry metadataCacheEntry
+	err := config.GetMetadataCacheCollection().FindOne(ctx, bson.M{"isbn": isbn}).Decode(&entry)
+	return entry, err == nil
+}
+
+func (mongoMetadataCache) put(ctx context.Context, entry metadataCacheEntry) error {
+	_, err := config.GetMetadataCacheCollection().ReplaceOne(ctx, bson.M{"isbn": entry.ISBN}, entry,
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+var metadataLookupCache metadataCache = mongoMetadataCache{}
+
+// LookupMetadata fetches what the providers know about an ISBN. Providers are
+// asked in order and later ones only fill in fields earlier ones left
+// empty. Results, including misses, are cached.
+func LookupMetadata(ctx context.Context, rawISBN string) (models.BookMetadata, error) {
+	isbn, err := NormalizeISBN(rawISBN)
+	if err != nil {
+		return models.BookMetadata{}, err
+	}
+
+	if cached, ok := metadataLookupCache.get(ctx, isbn); ok && cached.ExpiresAt.After(time.Now()) {
+		if !cached.Found || cached.Metadata == nil {
+			return models.BookMetadata{}, ErrMetadataNotFound
+		}
+		return *cached.Metadata, nil
+	}
+
+	merged := models.BookMetadata{ISBN: isbn, Sources: []string{}}
+	var lookupErr error
+	for _, provider := range metadataProviders {
+		metadata, err := provider.Lookup(ctx, isbn)
+		if errors.Is(err, ErrMetadataNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("⚠️ metadata provider %s failed for %s: %v", provider.Name(), isbn, err)
+			lookupErr = err
+			continue
+		}
+		mergeMetadata(&merged, metadata)
+		merged.Sources = append(merged.Sources, provider.Name())
+	}
+
+	found := len(merged.Sources) > 0
+	if !found && lookupErr != nil {
+		// don't remember a miss that may only be an outage
+		return models.BookMetadata{}, lookupErr
+	}
+	entry := metadataCacheEntry{ISBN: isbn, Found: found, FetchedAt: time.Now()}
+	if found {
+		entry.Metadata = &merged
+		entry.ExpiresAt = entry.FetchedAt.Add(metadataCacheTTL)
+	} else {
+		entry.ExpiresAt = entry.FetchedAt.Add(metadataMissCacheTTL)
+	}
+	if err := metadataLookupCache.put(ctx, entry); err != nil {
+		log.Printf("⚠️ failed to cache metadata for %s: %v", isbn, err)
+	}
+	if !found {
+		return models.BookMetadata{}, ErrMetadataNotFound
+	}
+	return merged, nil
+}
+
+// AuthorLine joins authors the way single author strings are written.
+func AuthorLine(authors []string) string {
+	return strings.Join(authors, " & ")
+}
+
+func mergeMetadata(into *models.BookMetadata, from models.BookMetadata) {
+	if into.Title == "" {
+		into.Title = from.Title
+	}
+	if into.Subtitle == "" {
+		into.Subtitle = from.Subtitle
+	}
+	if len(into.Authors) == 0 {
+		into.Authors = from.Authors
+	}
+	if into.Publisher == "" {
+		into.Publisher = from.Publisher
+	}
+	if into.PublishedYear == 0 {
+		into.PublishedYear = from.PublishedYear
+	}
+	if len(into.Subjects) == 0 {
+		into.Subjects = from.Subjects
+	}
+	if into.PageCount == 0 {
+		into.PageCount = from.PageCount
+	}
+	if into.CoverURL == "" {
+		into.CoverURL = from.CoverURL
+	}
+	if into.Language == "" {
+		into.Language = from.Language
+	}
+}
+
+var yearPattern = regexp.MustCompile(`(?:^|\D)((?:1[5-9]|20)\d\d)(?:\D|$)`)
+
+// publishedYear picks the year out of dates like "2004", "2004-06-01",
+// "June 1, 2004" or "c1937.".
+func publishedYear(date string) int {
+	match := yearPattern.FindStringSubmatch(date)
+	if match == nil {
+		return 0
+	}
+	year, _ := strconv.Atoi(match[1])
+	return year
+}
+
+type openLibraryProvider struct{}
+
+func (openLibraryProvider) Name() string { return "openlibrary" }
+
+func (openLibraryProvider) Lookup(ctx context.Context, isbn string) (models.BookMetadata, error) {
+	type named struct {
+		Name string `json:"name"`
+	}
+	var body map[string]struct {
+		Title         string  `json:"title"`
+		Subtitle      string  `json:"subtitle"`
+		Authors       []named `json:"authors"`
+		Publishers    []named `json:"publishers"`
+		PublishDate   string  `json:"publish_date"`
+		Subjects      []named `json:"subjects"`
+		NumberOfPages int     `json:"number_of_pages"`
+		Cover         struct {
+			Large  string `json:"large"`
+			Medium string `json:"medium"`
+		} `json:"cover"`
+	}
+	query := url.Values{"bibkeys": {"ISBN:" + isbn}, "format": {"json"}, "jscmd": {"data"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://openlibrary.org/api/books?"+query.Encode(), nil)
+	if err != nil {
+		return models.BookMetadata{}, err
+	}
+	if err := doJSON(metadataHTTPClient, req, &body); err != nil {
+		return models.BookMetadata{}, err
+	}
+	record, ok := body["ISBN:"+isbn]
+	if !ok {
+		return models.BookMetadata{}, ErrMetadataNotFound
+	}
+
+	names := func(list []named) []string {
+		out := make([]string, 0, len(list))
+		for _, item := range list {
+			out = append(out, item.Name)
+		}
+		return out
+	}
+	metadata := models.BookMetadata{
+		ISBN:          isbn,
+		Title:         record.Title,
+		Subtitle:      record.Subtitle,
+		Authors:       names(record.Authors),
+		PublishedYear: publishedYear(record.PublishDate),
+		Subjects:      names(record.Subjects),
+		PageCount:     record.NumberOfPages,
+		CoverURL:      record.Cover.Large,
+	}
+	if len(record.Publishers) > 0 {
+		metadata.Publisher = record.Publishers[0].Name
+	}
+	if metadata.CoverURL == "" {
+		metadata.CoverURL = record.Cover.Medium
+	}
+	return metadata, nil
+}
+
+type googleBooksProvider struct {
+	apiKey string
+}
+
+func (googleBooksProvider) Name() string { return "googlebooks" }
+
+func (p googleBooksProvider) Lookup(ctx context.Context, isbn string) (models.BookMetadata, error) {
+	var body struct {
+		TotalItems int `json:"totalItems"`
+		Items      []struct {
+			VolumeInfo struct {
+				Title         string   `json:"title"`
+				Subtitle      string   `json:"subtitle"`
+				Authors       []string `json:"authors"`
+				Publisher     string   `json:"publisher"`
+				PublishedDate string   `json:"publishedDate"`
+				Categories    []string `json:"categories"`
+				PageCount     int      `json:"pageCount"`
+				Language      string   `json:"language"`
+				ImageLinks    struct {
+					Thumbnail string `json:"thumbnail"`
+				} `json:"imageLinks"`
+			} `json:"volumeInfo"`
+		} `json:"items"`
+	}
+	query := url.Values{"q": {"isbn:" + isbn}}
+	if p.apiKey != "" {
+		query.Set("key", p.apiKey)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://www.googleapis.com/books/v1/volumes?"+query.Encode(), nil)
+	if err != nil {
+		return models.BookMetadata{}, err
+	}
+	if err := doJSON(metadataHTTPClient, req, &body); err != nil {
+		return models.BookMetadata{}, err
+	}
+	if body.TotalItems == 0 || len(body.Items) == 0 {
+		return models.BookMetadata{}, ErrMetadataNotFound
+	}
+
+	info := body.Items[0].VolumeInfo
+	return models.BookMetadata{
+		ISBN:          isbn,
+		Title:         info.Title,
+		Subtitle:      info.Subtitle,
+		Authors:       info.Authors,
+		Publisher:     info.Publisher,
+		PublishedYear: publishedYear(info.PublishedDate),
+		Subjects:      info.Categories,
+		PageCount:     info.PageCount,
+		CoverURL:      strings.Replace(info.ImageLinks.Thumbnail, "http://", "https://", 1),
+		Language:      info.Language,
+	}, nil
+}
+
+// fixtureProvider serves records from a JSON object keyed by ISBN, for
+// working offline and for tests.
+type fixtureProvider struct {
+	records map[string]models.BookMetadata
+}
+
+func loadFixtureProvider(path string) (fixtureProvider, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fixtureProvider{}, err
+	}
+	var records map[string]models.BookMetadata
+	if err := json.Unmarshal(raw, &records); err != nil {
+		return fixtureProvider{}, fmt.Errorf("%s: %w", path, err)
+	}
+	provider := fixtureProvider{records: make(map[string]models.BookMetadata, len(records))}
+	for key, record := range records {
+		isbn, err := NormalizeISBN(key)
+		if err != nil {
+			return fixtureProvider{}, fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		record.ISBN = isbn
+		provider.records[isbn] = record
+	}
+	return provider, nil
+}
+
+func (fixtureProvider) Name() string { return "fixture" }
+
+func (p fixtureProvider) Lookup(ctx context.Context, isbn string) (models.BookMetadata, error) {
+	record, ok := p.records[isbn]
+	if !ok {
+		return models.BookMetadata{}, ErrMetadataNotFound
+	}
+	return record, nil
+}
+
+// DeleteCachedMetadata forgets the cached lookup for an ISBN.
+func DeleteCachedMetadata(ctx context.Context, rawISBN string) error {
+	isbn, err := NormalizeISBN(rawISBN)
+	if err != nil {
+		return err
+	}
+	_, err = config.GetMetadataCacheCollection().DeleteOne(ctx, bson.M{"isbn": isbn})
+	return err
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+)
+
+type memoryMetadataCache map[string]metadataCacheEntry
+
+func (c memoryMetadataCache) get(_ context.Context, isbn string) (metadataCacheEntry, bool) {
+	entry, ok := c[isbn]
+	return entry, ok
+}
+
+func (c memoryMetadataCache) put(_ context.Context, entry metadataCacheEntry) error {
+	c[entry.ISBN] = entry
+	return nil
+}
+
+// countingProvider counts its lookups and fails every one with err.
+type countingProvider struct {
+	calls *int
+	err   error
+}
+
+func (countingProvider) Name() string { return "counting" }
+
+func (p countingProvider) Lookup(context.Context, string) (models.BookMetadata, error) {
+	*p.calls++
+	return models.BookMetadata{}, p.err
+}
+
+// useMetadataProviders swaps in providers and an empty cache for one test.
+func useMetadataProviders(t *testing.T, providers ...MetadataProvider) memoryMetadataCache {
+	t.Helper()
+	previousProviders, previousCache := metadataProviders, metadataLookupCache
+	t.Cleanup(func() { metadataProviders, metadataLookupCache = previousProviders, previousCache })
+	cache := memoryMetadataCache{}
+	metadataProviders, metadataLookupCache = providers, cache
+	return cache
+}
+
+const dune = "9780441172719"
+
+func TestLookupMetadataMergeOrder(t *testing.T) {
+	calls := 0
+	first := fixtureProvider{records: map[string]models.BookMetadata{dune: {
+		Title:   "Dune",
+		Authors: []string{"Frank Herbert"},
+	}}}
+	second := fixtureProvider{records: map[string]models.BookMetadata{dune: {
+		Title:         "Dune (40th anniversary)",
+		Authors:       []string{"Herbert, Frank"},
+		Publisher:     "Ace",
+		PublishedYear: 2005,
+		Subjects:      []string{"Science fiction"},
+	}}}
+	empty := fixtureProvider{records: map[string]models.BookMetadata{}}
+	useMetadataProviders(t, empty, first, countingProvider{&calls, errors.New("down")}, second)
+
+	got, err := LookupMetadata(context.Background(), "0-441-17271-7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.BookMetadata{
+		ISBN:          dune,
+		Title:         "Dune",
+		Authors:       []string{"Frank Herbert"},
+		Publisher:     "Ace",
+		PublishedYear: 2005,
+		Subjects:      []string{"Science fiction"},
+		// a failing provider is skipped, the rest still count
+		Sources: []string{"fixture", "fixture"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupMetadata = %+v, want %+v", got, want)
+	}
+	if calls != 1 {
+		t.Errorf("failing provider asked %d times, want 1", calls)
+	}
+}
+
+func TestLookupMetadataCache(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	fixture := fixtureProvider{records: map[string]models.BookMetadata{dune: {Title: "Dune"}}}
+	cache := useMetadataProviders(t, fixture, countingProvider{&calls, ErrMetadataNotFound})
+
+	if _, err := LookupMetadata(ctx, dune); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LookupMetadata(ctx, dune)
+	if err != nil || got.Title != "Dune" {
+		t.Errorf("cached LookupMetadata = %+v, %v", got, err)
+	}
+	if calls != 1 {
+		t.Errorf("providers asked %d times for a cached ISBN, want 1", calls)
+	}
+
+	// misses are cached too, for a shorter time
+	unknown := "9780306406157"
+	for range 2 {
+		if _, err := LookupMetadata(ctx, unknown); err != ErrMetadataNotFound {
+			t.Errorf("LookupMetadata of an unknown ISBN: err = %v, want ErrMetadataNotFound", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("providers asked %d times, want 2", calls)
+	}
+	if entry := cache[unknown]; entry.Found || entry.ExpiresAt.Sub(entry.FetchedAt) != metadataMissCacheTTL {
+		t.Errorf("miss cached as %+v", entry)
+	}
+
+	// an expired entry is looked up again
+	cache[dune] = metadataCacheEntry{ISBN: dune, Found: true, Metadata: &models.BookMetadata{Title: "Stale"},
+		ExpiresAt: time.Now().Add(-time.Minute)}
+	if got, _ := LookupMetadata(ctx, dune); got.Title != "Dune" {
+		t.Errorf("expired entry served: %+v", got)
+	}
+}
+
+func TestLookupMetadataOutageNotCached(t *testing.T) {
+	calls := 0
+	cache := useMetadataProviders(t, countingProvider{&calls, errors.New("down")})
+	if _, err := LookupMetadata(context.Background(), dune); err == nil || err == ErrMetadataNotFound {
+		t.Errorf("err = %v, want the provider's error", err)
+	}
+	if _, ok := cache[dune]; ok {
+		t.Error("a failed lookup was cached as a miss")
+	}
+	if _, err := LookupMetadata(context.Background(), "978-0"); !errors.Is(err, ErrISBNLength) {
+		t.Errorf("invalid ISBN: err = %v, want ErrISBNLength", err)
+	}
+}
+
+func TestLoadFixtureProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fixture.json")
+	if err := os.WriteFile(path, []byte(`{"0-441-17271-7": {"title": "Dune"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider, err := loadFixtureProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := provider.Lookup(context.Background(), dune)
+	if err != nil || got.Title != "Dune" || got.ISBN != dune {
+		t.Errorf("Lookup = %+v, %v", got, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"12345": {"title": "Dune"}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadFixtureProvider(path); !errors.Is(err, ErrISBNLength) {
+		t.Errorf("fixture with a bad ISBN: err = %v", err)
+	}
+}
+
+func TestPublishedYear(t *testing.T) {
+	for date, want := range map[string]int{
+		"2004":         2004,
+		"2004-06-01":   2004,
+		"June 1, 2004": 2004,
+		"c1937.":       1937,
+		"12345":        0,
+		"":             0,
+	} {
+		if got := publishedYear(date); got != want {
+			t.Errorf("publishedYear(%q) = %d, want %d", date, got, want)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ExportedBook is a book with the address of its shelf.
+type ExportedBook struct {
+	models.Book  `bson:",inline"`
+	ShelfAddress string `bson:"shelf_address" json:"shelf_address"`
+}
+
+// ForEachBook streams the books matching filter in title order, one at a
+// time, so exports never hold the whole catalog in memory.
+func ForEachBook(ctx context.Context, filter bson.M, visit func(ExportedBook) error) error {
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: filter}}}
+	pipeline = append(pipeline, BookSorts["title"].Stage())
+	pipeline = append(pipeline, ShelfAddressStages()...)
+	cursor, err := config.GetBookCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var book ExportedBook
+		if err := cursor.Decode(&book); err != nil {
+			return err
+		}
+		if err := visit(book); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// ExportMARC writes the matching books as binary MARC ("marc") or a MARCXML
+// collection ("marcxml").
+func ExportMARC(ctx context.Context, filter bson.M, format string, w io.Writer) error {
+	switch format {
+	case "marc":
+		return ForEachBook(ctx, filter, func(book ExportedBook) error {
+			return WriteISO2709(w, BookToMARC(book.Book, book.ShelfAddress))
+		})
+	case "marcxml":
+		if _, err := io.WriteString(w, MARCXMLHeader); err != nil {
+			return err
+		}
+		err := ForEachBook(ctx, filter, func(book ExportedBook) error {
+			if err := WriteMARCXMLRecord(w, BookToMARC(book.Book, book.ShelfAddress), false); err != nil {
+				return err
+			}
+			_, err := io.WriteString(w, "\n")
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, MARCXMLFooter)
+		return err
+	}
+	return fmt.Errorf("unsupported MARC format %q", format)
+}
+
+const (
+	AvailabilityAvailable = "available"
+	AvailabilityOnLoan    = "on_loan"
+)
+
+// ExportFormats maps each export format to its content type and file
+// extension.
+var ExportFormats = map[string][2]string{
+	"csv":     {"text/csv; charset=utf-8", "csv"},
+	"jsonl":   {"application/x-ndjson", "jsonl"},
+	"bibtex":  {"application/x-bibtex; charset=utf-8", "bib"},
+	"marc":    {"application/marc", "mrc"},
+	"marcxml": {"application/marcxml+xml", "xml"},
+}
+
+// ExportRecord is a book as it appears in CSV and JSON Lines exports. The
+// CSV columns use the import field names, so an export can be imported
+// again.
+type ExportRecord struct {
+	ID            string               `json:"id"`
+	Title         string               `json:"title"`
+	Author        string               `json:"author"`
+	Contributors  []models.Contributor `json:"contributors,omitempty"`
+	Series        string               `json:"series,omitempty"`
+	SeriesNumber  float64              `json:"series_number,omitempty"`
+	Publisher     string               `json:"publisher"`
+	ISBN          string               `json:"isbn"`
+	Genre         string               `json:"genre"`
+	PublishedYear int                  `json:"published_year,omitempty"`
+	Subjects      []string             `json:"subjects,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	PageCount     int                  `json:"page_count,omitempty"`
+	CoverURL      string               `json:"cover_url,omitempty"`
+	CallNumber    string               `json:"call_number,omitempty"`
+	ShelfID       string               `json:"shelf_id"`
+	ShelfAddress  string               `json:"shelf_address"`
+	Row           int                  `json:"row"`
+	Column        int                  `json:"column"`
+	Availability  string               `json:"availability"`
+	AddedAt       time.Time            `json:"added_at"`
+}
+
+func NewExportRecord(book ExportedBook) ExportRecord {
+	availability := AvailabilityAvailable
+	if book.TakenByUserID != nil {
+		availability = AvailabilityOnLoan
+	}
+	return ExportRecord{
+		ID:            book.ID.Hex(),
+		Title:         book.Title,
+		Author:        book.Author,
+		Contributors:  book.Contributors,
+		Series:        book.Series,
+		SeriesNumber:  book.SeriesNumber,
+		Publisher:     book.Publisher,
+		ISBN:          book.ISBN,
+		Genre:         book.Genre,
+		PublishedYear: book.PublishedYear,
+		Subjects:      book.Subjects,
+		Tags:          book.Tags,
+		PageCount:     book.PageCount,
+		CoverURL:      book.CoverURL,
+		CallNumber:    book.CallNumber,
+		ShelfID:       book.ShelfID.Hex(),
+		ShelfAddress:  book.ShelfAddress,
+		Row:           book.Row,
+		Column:        book.Column,
+		Availability:  availability,
+		AddedAt:       book.AddedAt,
+	}
+}
+
+var exportCSVHeader = []string{
+	"id", "title", "author", "contributors", "series", "series_number", "publisher", "isbn", "genre",
+	"published_year", "subjects", "tags", "page_count", "cover_url", "call_number", "shelf_id", "shelf_address",
+	"row", "column", "availability", "added_at",
+}
+
+func (r ExportRecord) csvRow() []string {
+	optional := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	seriesNumber := ""
+	if r.SeriesNumber != 0 {
+		seriesNumber = strconv.FormatFloat(r.SeriesNumber, 'f', -1, 64)
+	}
+	return []string{
+		r.ID, r.Title, r.Author, FormatContributors(r.Contributors), r.Series, seriesNumber, r.Publisher,
+		r.ISBN, r.Genre, optional(r.PublishedYear), strings.Join(r.Subjects, "; "), strings.Join(r.Tags, "; "),
+		optional(r.PageCount), r.CoverURL, r.CallNumber, r.ShelfID, r.ShelfAddress, strconv.Itoa(r.Row),
+		strconv.Itoa(r.Column), r.Availability, r.AddedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// ExportBooks streams the books matching filter in one of ExportFormats.
+func ExportBooks(ctx context.Context, filter bson.M, format string, w io.Writer) error {
+	switch format {
+	case "csv":
+		out := csv.NewWriter(w)
+		if err := out.Write(exportCSVHeader); err != nil {
+			return err
+		}
+		err := ForEachBook(ctx, filter, func(book ExportedBook) error {
+			return out.Write(NewExportRecord(book).csvRow())
+		})
+		out.Flush()
+		if err != nil {
+			return err
+		}
+		return out.Error()
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		return ForEachBook(ctx, filter, func(book ExportedBook) error {
+			return encoder.Encode(NewExportRecord(book))
+		})
+	case "bibtex":
+		keys := map[string]int{}
+		return ForEachBook(ctx, filter, func(book ExportedBook) error {
+			return writeBibTeX(w, NewExportRecord(book), keys)
+		})
+	case "marc", "marcxml":
+		return ExportMARC(ctx, filter, format, w)
+	}
+	return fmt.Errorf("unsupported export format %q", format)
+}
+
+// writeBibTeX writes one @book entry. Keys are surname, year and first
+// title word, with a letter added when a key repeats.
+func writeBibTeX(w io.Writer, record ExportRecord, keys map[string]int) error {
+	authors := BookAuthors(models.Book{Author: record.Author, Contributors: record.Contributors})
+	editors := ContributorNames(record.Contributors, models.RoleEditor)
+	// edited collections are keyed by their first editor
+	named := authors
+	if len(named) == 0 {
+		named = editors
+	}
+	key := "anon"
+	if len(named) > 0 {
+		if names := strings.Fields(FoldText(named[0])); len(names) > 0 {
+			key = names[len(names)-1]
+		}
+	}
+	if record.PublishedYear > 0 {
+		key += strconv.Itoa(record.PublishedYear)
+	}
+	titleWords := strings.Fields(FoldText(record.Title))
+	for i, word := range titleWords {
+		// skip short words like "the" unless there is nothing else
+		if len(word) > 3 || i == len(titleWords)-1 {
+			key += word
+			break
+		}
+	}
+	key = bibTeXKeyChars.ReplaceAllString(key, "")
+	keys[key]++
+	if n := keys[key]; n > 1 {
+		key += string(rune('a' + (n-2)%26))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "@book{%s,\n", key)
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "  %-9s = {%s},\n", name, escapeBibTeX(value))
+		}
+	}
+	field("title", record.Title)
+	field("author", strings.Join(authors, " and "))
+	field("editor", strings.Join(editors, " and "))
+	field("series", record.Series)
+	if record.SeriesNumber != 0 {
+		field("volume", strconv.FormatFloat(record.SeriesNumber, 'f', -1, 64))
+	}
+	field("publisher", record.Publisher)
+	if record.PublishedYear > 0 {
+		field("year", strconv.Itoa(record.PublishedYear))
+	}
+	field("isbn", record.ISBN)
+	if record.PageCount > 0 {
+		field("pagetotal", strconv.Itoa(record.PageCount))
+	}
+	field("keywords", strings.Join(record.Subjects, ", "))
+	location := "Shelf " + record.ShelfAddress + ", row " + strconv.Itoa(record.Row) + ", column " + strconv.Itoa(record.Column)
+	if record.Availability == AvailabilityOnLoan {
+		location += " (on loan)"
+	}
+	if record.CallNumber != "" {
+		location = record.CallNumber + ", " + location
+	}
+	field("note", location)
+	b.WriteString("}\n\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var (
+	bibTeXKeyChars = regexp.MustCompile(`[^a-z0-9]`)
+	bibTeXEscaper  = strings.NewReplacer(
+		`\`, `\textbackslash{}`, "{", `\{`, "}", `\}`, "&", `\&`, "%", `\%`,
+		"$", `\$`, "#", `\#`, "_", `\_`, "~", `\textasciitilde{}`, "^", `\textasciicircum{}`,
+	)
+)
+
+func escapeBibTeX(value string) string {
+	return bibTeXEscaper.Replace(value)
+}
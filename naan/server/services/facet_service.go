@@ -0,0 +1,99 @@
+package services
+
+import (
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+const DefaultFacetLimit = 20
+
+type FacetBucket struct {
+	Value any    `bson:"_id" json:"value"`
+	Label string `bson:"label,omitempty" json:"label,omitempty"`
+	Count int64  `bson:"count" json:"count"`
+}
+
+type BookFacets struct {
+	Genre           []FacetBucket `bson:"genre" json:"genre"`
+	Author          []FacetBucket `bson:"author" json:"author"`
+	Series          []FacetBucket `bson:"series" json:"series"`
+	Subject         []FacetBucket `bson:"subject" json:"subject"`
+	Tag             []FacetBucket `bson:"tag" json:"tag"`
+	Publisher       []FacetBucket `bson:"publisher" json:"publisher"`
+	Shelf           []FacetBucket `bson:"shelf" json:"shelf"`
+	Availability    []FacetBucket `bson:"availability" json:"availability"`
+	PublicationYear []FacetBucket `bson:"publication_year" json:"publication_year"`
+}
+
+// FacetStage counts the books that reached it by each drill-down field. It
+// goes right after the $match of the current filter set.
+func FacetStage(limit int) bson.D {
+	if limit <= 0 {
+		limit = DefaultFacetLimit
+	}
+	return bson.D{{Key: "$facet", Value: bson.D{
+		{Key: "genre", Value: countBy("$genre", limit)},
+		{Key: "author", Value: append(bson.A{
+			bson.D{{Key: "$unwind", Value: "$contributors"}},
+			bson.D{{Key: "$match", Value: bson.D{{Key: "contributors.role", Value: models.RoleAuthor}}}},
+		}, countBy("$contributors.name", limit)...)},
+		{Key: "series", Value: countBy("$series", limit)},
+		{Key: "subject", Value: append(bson.A{
+			bson.D{{Key: "$unwind", Value: "$subject_ids"}},
+		}, append(countBy("$subject_ids", limit),
+			bson.D{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: "subjects"},
+				{Key: "localField", Value: "_id"},
+				{Key: "foreignField", Value: "_id"},
+				{Key: "as", Value: "subject"},
+			}}},
+			bson.D{{Key: "$addFields", Value: bson.D{
+				{Key: "label", Value: bson.D{{Key: "$first", Value: "$subject.name"}}},
+			}}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "subject", Value: 0}}}},
+		)...)},
+		{Key: "tag", Value: append(bson.A{
+			bson.D{{Key: "$unwind", Value: "$tags"}},
+		}, countBy("$tags", limit)...)},
+		{Key: "publisher", Value: countBy("$publisher", limit)},
+		{Key: "shelf", Value: append(countBy("$shelf_id", limit),
+			bson.D{{Key: "$lookup", Value: bson.D{
+				{Key: "from", Value: "shelves"},
+				{Key: "localField", Value: "_id"},
+				{Key: "foreignField", Value: "_id"},
+				{Key: "as", Value: "shelf"},
+			}}},
+			bson.D{{Key: "$addFields", Value: bson.D{
+				{Key: "label", Value: bson.D{{Key: "$first", Value: "$shelf.address"}}},
+			}}},
+			bson.D{{Key: "$project", Value: bson.D{{Key: "shelf", Value: 0}}}},
+		)},
+		{Key: "availability", Value: bson.A{
+			bson.D{{Key: "$group", Value: bson.D{
+				{Key: "_id", Value: bson.D{{Key: "$cond", Value: bson.A{
+					bson.D{{Key: "$ifNull", Value: bson.A{"$taken_by_user_id", false}}},
+					AvailabilityOnLoan,
+					AvailabilityAvailable,
+				}}}},
+				{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+			}}},
+			bson.D{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+		}},
+		{Key: "publication_year", Value: append(bson.A{
+			bson.D{{Key: "$match", Value: bson.D{{Key: "published_year", Value: bson.D{{Key: "$gt", Value: 0}}}}}},
+		}, countBy("$published_year", limit)...)},
+	}}}
+}
+
+// countBy groups on field, dropping empty values, most common first.
+func countBy(field string, limit int) bson.A {
+	return bson.A{
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: field},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "_id", Value: bson.D{{Key: "$nin", Value: bson.A{nil, ""}}}}}}},
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}}},
+		bson.D{{Key: "$limit", Value: limit}},
+	}
+}
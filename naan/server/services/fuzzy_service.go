@@ -0,0 +1,203 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	fuzzyMinWordLength = 3
+	fuzzyMaxCandidates = 50
+)
+
+// Vocabulary is an in-memory trigram index over every word in the catalog,
+// used to find what a misspelled search term was meant to be.
+type Vocabulary struct {
+	words    []string
+	freq     []int
+	index    map[string]int
+	trigrams map[string][]int
+}
+
+var vocabulary atomic.Pointer[Vocabulary]
+
+func newVocabulary() *Vocabulary {
+	return &Vocabulary{index: map[string]int{}, trigrams: map[string][]int{}}
+}
+
+func (v *Vocabulary) add(text string) {
+	for _, word := range strings.Fields(FoldText(text)) {
+		if len([]rune(word)) < fuzzyMinWordLength {
+			continue
+		}
+		if i, ok := v.index[word]; ok {
+			v.freq[i]++
+			continue
+		}
+		i := len(v.words)
+		v.words = append(v.words, word)
+		v.freq = append(v.freq, 1)
+		v.index[word] = i
+		for _, trigram := range trigramsOf(word) {
+			v.trigrams[trigram] = append(v.trigrams[trigram], i)
+		}
+	}
+}
+
+// Correct returns the closest known word to term, or "" if nothing is close
+// enough. Known words are returned unchanged.
+func (v *Vocabulary) Correct(term string) string {
+	if _, ok := v.index[term]; ok {
+		return term
+	}
+	length := len([]rune(term))
+	if length < fuzzyMinWordLength {
+		return ""
+	}
+	maxEdits := 1
+	if length > 4 {
+		maxEdits = 2
+	}
+
+	// candidates are words sharing trigrams with the term, best overlap first
+	shared := map[int]int{}
+	for _, trigram := range trigramsOf(term) {
+		for _, i := range v.trigrams[trigram] {
+			shared[i]++
+		}
+	}
+	candidates := make([]int, 0, len(shared))
+	for i := range shared {
+		candidates = append(candidates, i)
+	}
+	sort.Slice(candidates, func(a, b int) bool {
+		if shared[candidates[a]] != shared[candidates[b]] {
+			return shared[candidates[a]] > shared[candidates[b]]
+		}
+		return v.words[candidates[a]] < v.words[candidates[b]]
+	})
+	if len(candidates) > fuzzyMaxCandidates {
+		candidates = candidates[:fuzzyMaxCandidates]
+	}
+
+	best, bestDistance := -1, maxEdits+1
+	for _, i := range candidates {
+		distance := editDistance(term, v.words[i])
+		if distance < bestDistance || distance == bestDistance && best >= 0 && v.freq[i] > v.freq[best] {
+			best, bestDistance = i, distance
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return v.words[best]
+}
+
+// CorrectQuery spells every term of the query against the catalog. It
+// returns "" when no term could be corrected.
+func CorrectQuery(query string) string {
+	v := vocabulary.Load()
+	if v == nil {
+		return ""
+	}
+	terms := strings.Fields(FoldText(query))
+	corrected := make([]string, 0, len(terms))
+	changed := false
+	for _, term := range terms {
+		word := v.Correct(term)
+		switch word {
+		case "":
+			corrected = append(corrected, term)
+		case term:
+			corrected = append(corrected, term)
+		default:
+			corrected = append(corrected, word)
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+	return strings.Join(corrected, " ")
+}
+
+// RebuildVocabulary reloads the word list from the searchable book fields.
+func RebuildVocabulary(ctx context.Context) error {
+	cursor, err := config.GetBookCollection().Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{
+		"title": 1, "author": 1, "contributors": 1, "series": 1, "publisher": 1, "genre": 1,
+	}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	v := newVocabulary()
+	for cursor.Next(ctx) {
+		var book models.Book
+		if err := cursor.Decode(&book); err != nil {
+			return err
+		}
+		addBookWords(v, book)
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	vocabulary.Store(v)
+	return nil
+}
+
+func addBookWords(v *Vocabulary, book models.Book) {
+	v.add(book.Title)
+	if len(book.Contributors) == 0 {
+		v.add(book.Author)
+	}
+	for _, contributor := range book.Contributors {
+		v.add(contributor.Name)
+	}
+	v.add(book.Series)
+	v.add(book.Publisher)
+	v.add(book.Genre)
+}
+
+func trigramsOf(word string) []string {
+	runes := []rune("$" + word + "$")
+	trigrams := make([]string, 0, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		trigrams = append(trigrams, string(runes[i:i+3]))
+	}
+	return trigrams
+}
+
+// editDistance is the optimal string alignment distance: insertions,
+// deletions, substitutions and swaps of neighbours ("tolkein") cost one.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	rows := make([][]int, len(ra)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(rb)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				rows[i][j] = min(rows[i][j], rows[i-2][j-2]+1)
+			}
+		}
+	}
+	return rows[len(ra)][len(rb)]
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+)
+
+func testVocabulary() *Vocabulary {
+	v := newVocabulary()
+	for _, book := range []models.Book{
+		{Title: "The Hobbit", Author: "J.R.R. Tolkien"},
+		{Title: "Nineteen Eighty-Four", Contributors: []models.Contributor{{Name: "George Orwell", Role: models.RoleAuthor}}},
+		{Title: "Animal Farm", Author: "George Orwell"},
+		{Title: "Form and Function"},
+		{Title: "Form Follows Feeling"},
+		{Title: "Dune", Series: "Dune Chronicles", Publisher: "Chilton"},
+	} {
+		addBookWords(v, book)
+	}
+	return v
+}
+
+func TestVocabularyCorrect(t *testing.T) {
+	v := testVocabulary()
+	tests := []struct {
+		term string
+		want string
+	}{
+		{"tolkein", "tolkien"},
+		{"orwel", "orwell"},
+		{"hobit", "hobbit"},
+		{"chronicels", "chronicles"},
+		{"dune", "dune"},
+		// farm and form are one edit away, form is in more books
+		{"ferm", "form"},
+		// four letters allow a single edit
+		{"dine", "dune"},
+		{"xxne", ""},
+		{"xyzzy", ""},
+		{"th", ""},
+	}
+	for _, tt := range tests {
+		if got := v.Correct(tt.term); got != tt.want {
+			t.Errorf("Correct(%q) = %q, want %q", tt.term, got, tt.want)
+		}
+	}
+}
+
+func TestCorrectQuery(t *testing.T) {
+	previous := vocabulary.Load()
+	t.Cleanup(func() { vocabulary.Store(previous) })
+
+	vocabulary.Store(nil)
+	if got := CorrectQuery("tolkein"); got != "" {
+		t.Errorf("CorrectQuery without a vocabulary = %q, want \"\"", got)
+	}
+
+	vocabulary.Store(testVocabulary())
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"tolkein", "tolkien"},
+		{"Orwel", "orwell"},
+		{"the hobbit", ""},
+		{"George Orwell", ""},
+		{"animal farn orwell", "animal farm orwell"},
+		{"hobit by tolkein", "hobbit by tolkien"},
+		{"xyzzy", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := CorrectQuery(tt.query); got != tt.want {
+			t.Errorf("CorrectQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"dune", "dune", 0},
+		{"dune", "", 4},
+		{"tolkein", "tolkien", 1},
+		{"herbet", "herbert", 1},
+		{"kitten", "sitting", 3},
+		{"héllo", "hello", 1},
+		// a swapped pair can't be edited again, unlike full Damerau
+		{"ca", "abc", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := editDistance(tt.b, tt.a); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestTrigramsOf(t *testing.T) {
+	tests := []struct {
+		word string
+		want []string
+	}{
+		{"dune", []string{"$du", "dun", "une", "ne$"}},
+		{"a", []string{"$a$"}},
+		{"émi", []string{"$ém", "émi", "mi$"}},
+	}
+	for _, tt := range tests {
+		if got := trigramsOf(tt.word); !slices.Equal(got, tt.want) {
+			t.Errorf("trigramsOf(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,717 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	DefaultImportChunkSize = 500
+	MaxImportFileSize      = 4 << 20
+	importLease            = 2 * time.Minute
+)
+
+var (
+	ErrImportNotFound = errors.New("import job not found")
+	ErrImportBusy     = errors.New("import job is already running or finished")
+)
+
+// ImportFields are the book fields a CSV column can be mapped to. Subjects
+// and tags are separated by semicolons, contributors as "Name (role); Name";
+// a shelf is given by shelf_address or shelf_id.
+var ImportFields = []string{
+	"title", "author", "contributors", "series", "series_number", "publisher", "isbn", "genre",
+	"published_year", "subjects", "tags", "page_count", "cover_url", "call_number", "shelf_address", "shelf_id",
+	"row", "column",
+}
+
+// ParseImportMapping reads "field=Column Header" pairs separated by commas,
+// as given on the command line.
+func ParseImportMapping(spec string) (map[string]string, error) {
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(spec, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		field, column, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("mapping %q is not field=column", pair)
+		}
+		mapping[strings.TrimSpace(field)] = strings.TrimSpace(column)
+	}
+	return mapping, nil
+}
+
+// ImportRecord is one source row after it has been mapped onto book fields.
+// Extra is stored on the book as is.
+type ImportRecord struct {
+	Row    int64
+	Fields map[string]string
+	Extra  bson.M
+	Err    error
+}
+
+// csvColumns resolves the mapping against the header. Fields without a
+// mapping are looked up under their own name; headers match case-insensitively.
+func csvColumns(header []string, mapping map[string]string) (map[string]int, error) {
+	known := map[string]bool{}
+	for _, field := range ImportFields {
+		known[field] = true
+	}
+	for field := range mapping {
+		if !known[field] {
+			return nil, fmt.Errorf("unknown field %q in mapping", field)
+		}
+	}
+
+	positions := map[string]int{}
+	for i, name := range header {
+		positions[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	columns := map[string]int{}
+	for _, field := range ImportFields {
+		name := field
+		if mapped, ok := mapping[field]; ok {
+			name = mapped
+		}
+		i, ok := positions[strings.ToLower(name)]
+		if !ok {
+			if _, explicit := mapping[field]; explicit {
+				return nil, fmt.Errorf("column %q mapped to %s is not in the header", name, field)
+			}
+			continue
+		}
+		columns[field] = i
+	}
+	for _, required := range []string{"title", "row", "column"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("no column for required field %s", required)
+		}
+	}
+	_, byAddress := columns["shelf_address"]
+	_, byID := columns["shelf_id"]
+	if !byAddress && !byID {
+		return nil, errors.New("no column for shelf_address or shelf_id")
+	}
+	return columns, nil
+}
+
+// readCSV calls visit for each data row. Rows are numbered as a spreadsheet
+// shows them, so the header is row 1.
+func readCSV(data []byte, mapping map[string]string, visit func(ImportRecord) error) error {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("cannot read header: %w", err)
+	}
+	columns, err := csvColumns(header, mapping)
+	if err != nil {
+		return err
+	}
+
+	for row := int64(2); ; row++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		record := ImportRecord{Row: row, Fields: map[string]string{}}
+		if err != nil {
+			record.Err = err
+		} else {
+			for field, i := range columns {
+				if i < len(values) {
+					record.Fields[field] = strings.TrimSpace(values[i])
+				}
+			}
+		}
+		if err := visit(record); err != nil {
+			return err
+		}
+	}
+}
+
+// CreateImportJob checks the file can be read with the mapping and stores it
+// as a pending job.
+func CreateImportJob(ctx context.Context, job models.ImportJob) (models.ImportJob, error) {
+	if len(job.Data) > MaxImportFileSize {
+		return job, fmt.Errorf("file is larger than %d bytes", MaxImportFileSize)
+	}
+	if job.Format == "" {
+		job.Format = "csv"
+	}
+	if err := readImportRecords(job, func(ImportRecord) error { return io.EOF }); err != nil && err != io.EOF {
+		return job, err
+	}
+	if job.ShelfID != nil {
+		if _, err := GetShelf(ctx, *job.ShelfID); err != nil {
+			return job, err
+		}
+	}
+	if job.ChunkSize <= 0 {
+		job.ChunkSize = DefaultImportChunkSize
+	}
+	job.Status = models.ImportPending
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+	result, err := config.GetImportJobCollection().InsertOne(ctx, job)
+	if err != nil {
+		return job, err
+	}
+	job.ID = result.InsertedID.(bson.ObjectID)
+	return job, nil
+}
+
+func readImportRecords(job models.ImportJob, visit func(ImportRecord) error) error {
+	withDefaults := func(record ImportRecord) error {
+		for field, value := range job.Defaults {
+			if record.Fields[field] == "" {
+				record.Fields[field] = value
+			}
+		}
+		return visit(record)
+	}
+	switch job.Format {
+	case "csv":
+		return readCSV(job.Data, job.Mapping, withDefaults)
+	case "marc", "marcxml":
+		return readMARC(job.Format, job.Data, withDefaults)
+	}
+	return fmt.Errorf("unsupported import format %q", job.Format)
+}
+
+// readMARC numbers records from 1 in file order.
+func readMARC(format string, data []byte, visit func(ImportRecord) error) error {
+	row := int64(0)
+	read := ReadISO2709
+	if format == "marcxml" {
+		read = ReadMARCXML
+	}
+	return read(bytes.NewReader(data), func(marc models.MARCRecord, err error) error {
+		row++
+		record := ImportRecord{Row: row, Fields: map[string]string{}, Err: err}
+		if err == nil {
+			record.Fields = MARCToRecord(marc)
+			record.Extra = bson.M{"marc_leader": marc.Leader, "marc_control": marc.ControlFields}
+		}
+		return visit(record)
+	})
+}
+
+func GetImportJob(ctx context.Context, id bson.ObjectID) (models.ImportJob, error) {
+	var job models.ImportJob
+	err := config.GetImportJobCollection().FindOne(ctx, bson.M{"_id": id},
+		options.FindOne().SetProjection(bson.M{"data": 0})).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return job, ErrImportNotFound
+	}
+	return job, err
+}
+
+// claimImportJob takes the lease on a job that is not finished and not being
+// worked on. A crashed worker's lease runs out, so its job can be resumed.
+func claimImportJob(ctx context.Context, id bson.ObjectID) (models.ImportJob, error) {
+	now := time.Now()
+	lease := now.Add(importLease)
+	var job models.ImportJob
+	err := config.GetImportJobCollection().FindOneAndUpdate(ctx, bson.M{
+		"_id":    id,
+		"status": bson.M{"$ne": models.ImportCompleted},
+		"$or": bson.A{
+			bson.M{"lease_until": bson.M{"$exists": false}},
+			bson.M{"lease_until": bson.M{"$lt": now}},
+		},
+	}, bson.M{
+		"$set":   bson.M{"status": models.ImportRunning, "lease_until": lease, "updated_at": now},
+		"$unset": bson.M{"error": ""},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		if _, getErr := GetImportJob(ctx, id); getErr != nil {
+			return job, getErr
+		}
+		return job, ErrImportBusy
+	}
+	return job, err
+}
+
+type slotKey struct {
+	shelf  bson.ObjectID
+	row    int
+	column int
+}
+
+// slotOwner identifies the book in a slot; rows written by an earlier run
+// of the same import are not collisions when it resumes.
+type slotOwner struct {
+	importID bson.ObjectID
+	row      int64
+}
+
+// importState is what row validation needs to know about the catalog.
+type importState struct {
+	jobID       bson.ObjectID
+	targetShelf *bson.ObjectID
+	shelves     map[string]bson.ObjectID
+	shelfIDs    map[bson.ObjectID]models.Shelf
+	slots       map[slotKey]slotOwner
+	// occupied holds the same slots by shelf, and placed where earlier runs
+	// of this import put each of its rows.
+	occupied map[bson.ObjectID]map[gridSlot]bool
+	placed   map[int64]slotKey
+}
+
+func loadImportState(ctx context.Context, job models.ImportJob) (*importState, error) {
+	state := &importState{
+		jobID:       job.ID,
+		targetShelf: job.ShelfID,
+		shelves:     map[string]bson.ObjectID{},
+		shelfIDs:    map[bson.ObjectID]models.Shelf{},
+		slots:       map[slotKey]slotOwner{},
+		occupied:    map[bson.ObjectID]map[gridSlot]bool{},
+		placed:      map[int64]slotKey{},
+	}
+	cursor, err := config.GetShelfCollection().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var shelves []models.Shelf
+	if err := cursor.All(ctx, &shelves); err != nil {
+		return nil, err
+	}
+	for _, shelf := range shelves {
+		state.shelves[strings.ToLower(strings.TrimSpace(shelf.Address))] = shelf.ID
+		state.shelfIDs[shelf.ID] = shelf
+	}
+
+	cursor, err = config.GetBookCollection().Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{
+		"shelf_id": 1, "row": 1, "column": 1, "import_id": 1, "import_row": 1,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var book struct {
+			ShelfID   bson.ObjectID `bson:"shelf_id"`
+			Row       int           `bson:"row"`
+			Column    int           `bson:"column"`
+			ImportID  bson.ObjectID `bson:"import_id"`
+			ImportRow int64         `bson:"import_row"`
+		}
+		if err := cursor.Decode(&book); err != nil {
+			return nil, err
+		}
+		slot := slotKey{book.ShelfID, book.Row, book.Column}
+		state.claim(slot, slotOwner{book.ImportID, book.ImportRow})
+		if book.ImportID == job.ID {
+			state.placed[book.ImportRow] = slot
+		}
+	}
+	return state, cursor.Err()
+}
+
+func (s *importState) claim(slot slotKey, owner slotOwner) {
+	s.slots[slot] = owner
+	if s.occupied[slot.shelf] == nil {
+		s.occupied[slot.shelf] = map[gridSlot]bool{}
+	}
+	s.occupied[slot.shelf][gridSlot{slot.row, slot.column}] = true
+}
+
+// freeSlot places a record that names no row and column: where an earlier
+// run of this import put it, or else in the shelf's first free slot.
+func (s *importState) freeSlot(shelf models.Shelf, row int64) (gridSlot, error) {
+	if slot, ok := s.placed[row]; ok && slot.shelf == shelf.ID {
+		return gridSlot{slot.row, slot.column}, nil
+	}
+	slots, err := assignSlots(shelf, s.occupied[shelf.ID], []ShelvedBook{{}})
+	if err != nil {
+		return gridSlot{}, err
+	}
+	return slots[0], nil
+}
+
+// validate turns a record into a book document, or the reasons it can't be
+// imported. Valid rows claim their slot so later rows can't reuse it.
+func (s *importState) validate(record ImportRecord) (bson.M, []models.ImportRowError) {
+	var problems []models.ImportRowError
+	fail := func(field, value, message string) {
+		problems = append(problems, models.ImportRowError{
+			JobID: s.jobID, Row: record.Row, Field: field, Value: value, Message: message,
+		})
+	}
+	if record.Err != nil {
+		fail("", "", record.Err.Error())
+		return nil, problems
+	}
+	f := record.Fields
+	if s.targetShelf != nil {
+		f["shelf_id"], f["shelf_address"] = s.targetShelf.Hex(), ""
+		f["row"], f["column"] = "", ""
+	}
+	number := func(field string, required bool) int {
+		value := f[field]
+		if value == "" {
+			if required {
+				fail(field, "", field+" is required")
+			}
+			return 0
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || (required && n == 0) {
+			fail(field, value, field+" must be a positive whole number")
+		}
+		return n
+	}
+
+	if f["title"] == "" {
+		fail("title", "", "title is required")
+	}
+	isbn := f["isbn"]
+	if isbn != "" {
+		normalized, err := NormalizeISBN(isbn)
+		if err != nil {
+			fail("isbn", isbn, err.Error())
+		}
+		isbn = normalized
+	}
+	contributors := ContributorsFromAuthorLine(f["author"])
+	if f["contributors"] != "" {
+		parsed, err := ParseContributors(f["contributors"])
+		if err != nil {
+			fail("contributors", f["contributors"], err.Error())
+		}
+		contributors = parsed
+	}
+	var callNumber CallNumber
+	if value := f["call_number"]; value != "" {
+		parsed, err := ParseCallNumber(value)
+		if err != nil {
+			fail("call_number", value, err.Error())
+		}
+		callNumber = parsed
+	}
+	var seriesNumber float64
+	if value := f["series_number"]; value != "" {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || n <= 0 {
+			fail("series_number", value, "series_number must be a positive number")
+		}
+		seriesNumber = n
+	}
+	publishedYear := number("published_year", false)
+	pageCount := number("page_count", false)
+	// records without a position, as most from other catalogs are, are
+	// given a free slot once their shelf is known
+	autoPlace := f["row"] == "" && f["column"] == ""
+	var row, column int
+	if !autoPlace {
+		row = number("row", true)
+		column = number("column", true)
+	}
+
+	var shelfID bson.ObjectID
+	switch {
+	case f["shelf_id"] != "":
+		id, err := bson.ObjectIDFromHex(f["shelf_id"])
+		if _, ok := s.shelfIDs[id]; err != nil || !ok {
+			fail("shelf_id", f["shelf_id"], "no shelf with this ID")
+		}
+		shelfID = id
+	case f["shelf_address"] != "":
+		id, ok := s.shelves[strings.ToLower(f["shelf_address"])]
+		if !ok {
+			fail("shelf_address", f["shelf_address"], "no shelf with this address")
+		}
+		shelfID = id
+	default:
+		fail("shelf_address", "", "shelf_address or shelf_id is required")
+	}
+
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	shelf := s.shelfIDs[shelfID]
+	if autoPlace {
+		slot, err := s.freeSlot(shelf, record.Row)
+		if err != nil {
+			fail("shelf_id", shelfID.Hex(), "the shelf has no free slot left")
+			return nil, problems
+		}
+		row, column = slot.row, slot.column
+	}
+	if err := CheckSlot(shelf, row, 1); err != nil {
+		fail("row", f["row"], fmt.Sprintf("the shelf has %d rows", shelf.Rows))
+	}
+	if err := CheckSlot(shelf, 1, column); err != nil {
+		fail("column", f["column"], fmt.Sprintf("the shelf has %d columns", shelf.Columns))
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	slot := slotKey{shelfID, row, column}
+	if owner, taken := s.slots[slot]; taken && (owner.importID != s.jobID || owner.row != record.Row) {
+		message := "another book is already at this row and column"
+		if owner.importID == s.jobID {
+			message = fmt.Sprintf("row %d already places a book at this row and column", owner.row)
+		}
+		fail("column", f["column"], message)
+		return nil, problems
+	}
+	s.claim(slot, slotOwner{s.jobID, record.Row})
+
+	var subjects []string
+	for _, subject := range strings.Split(f["subjects"], ";") {
+		if subject = strings.TrimSpace(subject); subject != "" {
+			subjects = append(subjects, subject)
+		}
+	}
+	book := bson.M{
+		"title":           f["title"],
+		"author":          ContributorAuthorLine(contributors),
+		"title_key":       SortKey(f["title"]),
+		"author_key":      SortKey(ContributorAuthorLine(contributors)),
+		"contributors":    contributors,
+		"series":          f["series"],
+		"series_number":   seriesNumber,
+		"publisher":       f["publisher"],
+		"isbn":            isbn,
+		"genre":           f["genre"],
+		"published_year":  publishedYear,
+		"subjects":        subjects,
+		"tags":            NormalizeTags(strings.Split(f["tags"], ";")),
+		"page_count":      pageCount,
+		"cover_url":       f["cover_url"],
+		"shelf_id":        shelfID,
+		"row":             row,
+		"column":          column,
+		"added_at":        time.Now(),
+		"loan_count":      0,
+		"import_id":       s.jobID,
+		"import_row":      record.Row,
+		"call_number_key": callNumber.Key,
+	}
+	if callNumber.Key != "" {
+		book["call_number"] = callNumber.Normalized
+	}
+	for key, value := range record.Extra {
+		book[key] = value
+	}
+	return book, nil
+}
+
+// RunImportJob works through a job chunk by chunk, continuing after the last
+// checkpoint. Books are upserted by (import_id, import_row), so a chunk that
+// was half written before a crash is not duplicated. Dry runs validate
+// everything and write nothing but the error report.
+func RunImportJob(ctx context.Context, id bson.ObjectID) (models.ImportJob, error) {
+	job, err := claimImportJob(ctx, id)
+	if err != nil {
+		return job, err
+	}
+	if job.DryRun {
+		job.ProcessedRows, job.CheckpointRow, job.Imported, job.Failed = 0, 0, 0, 0
+	}
+
+	runErr := runImportChunks(ctx, &job)
+	now := time.Now()
+	update := bson.M{
+		"updated_at":     now,
+		"processed_rows": job.ProcessedRows,
+		"checkpoint_row": job.CheckpointRow,
+		"imported":       job.Imported,
+		"failed":         job.Failed,
+	}
+	if runErr != nil {
+		job.Status = models.ImportFailed
+		job.Error = runErr.Error()
+		update["error"] = job.Error
+	} else {
+		job.Status = models.ImportCompleted
+		job.FinishedAt = &now
+		update["finished_at"] = now
+	}
+	update["status"] = job.Status
+	if _, err := config.GetImportJobCollection().UpdateOne(context.Background(), bson.M{"_id": job.ID}, bson.M{
+		"$set":   update,
+		"$unset": bson.M{"lease_until": ""},
+	}); err != nil {
+		return job, err
+	}
+
+	if runErr == nil && !job.DryRun && job.Imported > 0 {
+		if err := RebuildSuggestions(ctx); err != nil {
+			log.Printf("⚠️ failed to rebuild suggestions after import: %v", err)
+		}
+		if err := RebuildVocabulary(ctx); err != nil {
+			log.Printf("⚠️ failed to rebuild search vocabulary after import: %v", err)
+		}
+	}
+	job.Data = nil
+	return job, runErr
+}
+
+func runImportChunks(ctx context.Context, job *models.ImportJob) error {
+	state, err := loadImportState(ctx, *job)
+	if err != nil {
+		return err
+	}
+	errorCollection := config.GetImportErrorCollection()
+	// errors past the checkpoint are reported again by this run
+	if _, err := errorCollection.DeleteMany(ctx, bson.M{"job_id": job.ID, "row": bson.M{"$gt": job.CheckpointRow}}); err != nil {
+		return err
+	}
+
+	var writes []mongo.WriteModel
+	var problems []any
+	var seen, last int64
+	var chunkFailed int64
+	flush := func() error {
+		if len(writes) > 0 && !job.DryRun {
+			if _, err := config.GetBookCollection().BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+				return err
+			}
+		}
+		if len(problems) > 0 {
+			if _, err := errorCollection.InsertMany(ctx, problems); err != nil {
+				return err
+			}
+		}
+		job.Imported += int64(len(writes))
+		job.Failed += chunkFailed
+		job.ProcessedRows = seen
+		job.CheckpointRow = last
+		writes, problems, chunkFailed = nil, nil, 0
+		// the checkpoint and the lease move on together
+		_, err := config.GetImportJobCollection().UpdateOne(ctx, bson.M{"_id": job.ID}, bson.M{"$set": bson.M{
+			"processed_rows": job.ProcessedRows,
+			"checkpoint_row": job.CheckpointRow,
+			"imported":       job.Imported,
+			"failed":         job.Failed,
+			"lease_until":    time.Now().Add(importLease),
+			"updated_at":     time.Now(),
+		}})
+		return err
+	}
+
+	err = readImportRecords(*job, func(record ImportRecord) error {
+		seen++
+		last = record.Row
+		if seen <= job.ProcessedRows {
+			// rows before the checkpoint still hold their slots
+			state.validate(record)
+			return nil
+		}
+		book, rowProblems := state.validate(record)
+		if rowProblems != nil {
+			chunkFailed++
+			for _, problem := range rowProblems {
+				problems = append(problems, problem)
+			}
+		} else {
+			if !job.DryRun {
+				contributors, err := LinkContributors(ctx, book["contributors"].([]models.Contributor))
+				if err != nil {
+					return err
+				}
+				book["contributors"] = contributors
+				fields, err := BookSubjects(ctx, append([]string{book["genre"].(string)}, book["subjects"].([]string)...))
+				if err != nil {
+					return err
+				}
+				for field, value := range fields {
+					book[field] = value
+				}
+			}
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"import_id": job.ID, "import_row": record.Row}).
+				SetUpdate(bson.M{"$setOnInsert": book}).
+				SetUpsert(true))
+		}
+		if seen-job.ProcessedRows >= int64(job.ChunkSize) {
+			return flush()
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return fmt.Errorf("stopped after row %d: %w", last, err)
+	}
+	return flush()
+}
+
+// ListImportErrors returns a job's row errors in row order.
+func ListImportErrors(ctx context.Context, id bson.ObjectID, limit int64) ([]models.ImportRowError, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "row", Value: 1}, {Key: "_id", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	cursor, err := config.GetImportErrorCollection().Find(ctx, bson.M{"job_id": id}, opts)
+	if err != nil {
+		return nil, err
+	}
+	problems := []models.ImportRowError{}
+	err = cursor.All(ctx, &problems)
+	return problems, err
+}
+
+// WriteImportErrorsCSV streams a job's error report.
+func WriteImportErrorsCSV(ctx context.Context, id bson.ObjectID, w io.Writer) error {
+	cursor, err := config.GetImportErrorCollection().Find(ctx, bson.M{"job_id": id},
+		options.Find().SetSort(bson.D{{Key: "row", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"row", "field", "value", "error"}); err != nil {
+		return err
+	}
+	for cursor.Next(ctx) {
+		var problem models.ImportRowError
+		if err := cursor.Decode(&problem); err != nil {
+			return err
+		}
+		if err := out.Write([]string{strconv.FormatInt(problem.Row, 10), problem.Field, problem.Value, problem.Message}); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return err
+	}
+	return cursor.Err()
+}
+
+// ImportJobBusy reports whether a job can't be started or resumed right now.
+func ImportJobBusy(job models.ImportJob) bool {
+	return job.Status == models.ImportCompleted || (job.LeaseUntil != nil && job.LeaseUntil.After(time.Now()))
+}
+
+// StartImportJob runs a job in the background, for callers that report
+// progress through GetImportJob.
+func StartImportJob(id bson.ObjectID) {
+	go func() {
+		job, err := RunImportJob(context.Background(), id)
+		if err != nil {
+			log.Printf("⚠️ import %s failed: %v", id.Hex(), err)
+			return
+		}
+		log.Printf("import %s finished: %d imported, %d failed", id.Hex(), job.Imported, job.Failed)
+	}()
+}
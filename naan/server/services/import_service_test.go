@@ -0,0 +1,114 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func newTestImportState(job models.ImportJob, shelves ...models.Shelf) *importState {
+	state := &importState{
+		jobID:       job.ID,
+		targetShelf: job.ShelfID,
+		shelves:     map[string]bson.ObjectID{},
+		shelfIDs:    map[bson.ObjectID]models.Shelf{},
+		slots:       map[slotKey]slotOwner{},
+		occupied:    map[bson.ObjectID]map[gridSlot]bool{},
+		placed:      map[int64]slotKey{},
+	}
+	for _, shelf := range shelves {
+		state.shelves[strings.ToLower(shelf.Address)] = shelf.ID
+		state.shelfIDs[shelf.ID] = shelf
+	}
+	return state
+}
+
+func importRecord(row int64, fields map[string]string) ImportRecord {
+	record := ImportRecord{Row: row, Fields: map[string]string{"title": "Book"}}
+	for field, value := range fields {
+		record.Fields[field] = value
+	}
+	return record
+}
+
+func placedAt(t *testing.T, state *importState, record ImportRecord) (bson.ObjectID, int, int) {
+	t.Helper()
+	book, problems := state.validate(record)
+	if problems != nil {
+		t.Fatalf("row %d: %+v", record.Row, problems)
+	}
+	return book["shelf_id"].(bson.ObjectID), book["row"].(int), book["column"].(int)
+}
+
+func TestImportPlacesRecordsWithoutPosition(t *testing.T) {
+	shelf := models.Shelf{ID: bson.NewObjectID(), Address: "A1", Rows: 2, Columns: 2}
+	job := models.ImportJob{ID: bson.NewObjectID()}
+	state := newTestImportState(job, shelf)
+	state.claim(slotKey{shelf.ID, 1, 1}, slotOwner{})
+
+	want := [][2]int{{1, 2}, {2, 1}}
+	for i, slot := range want {
+		_, row, column := placedAt(t, state, importRecord(int64(i+1), map[string]string{"shelf_address": "a1"}))
+		if row != slot[0] || column != slot[1] {
+			t.Errorf("record %d placed at %d,%d, want %v", i+1, row, column, slot)
+		}
+	}
+	// an explicit position still has to be free
+	if _, problems := state.validate(importRecord(3, map[string]string{"shelf_address": "A1", "row": "1", "column": "2"})); problems == nil {
+		t.Error("record placed on a taken slot")
+	}
+	// one of row and column alone is not enough
+	if _, problems := state.validate(importRecord(4, map[string]string{"shelf_address": "A1", "row": "2"})); problems == nil {
+		t.Error("record with a row but no column was accepted")
+	}
+	_, _, column := placedAt(t, state, importRecord(5, map[string]string{"shelf_address": "A1"}))
+	if column != 2 {
+		t.Errorf("last free slot not used, got column %d", column)
+	}
+	if _, problems := state.validate(importRecord(6, map[string]string{"shelf_address": "A1"})); problems == nil {
+		t.Error("record placed on a full shelf")
+	}
+}
+
+func TestImportTargetShelf(t *testing.T) {
+	named := models.Shelf{ID: bson.NewObjectID(), Address: "A1", Rows: 5, Columns: 5}
+	target := models.Shelf{ID: bson.NewObjectID(), Address: "B1", Rows: 1, Columns: 3}
+	job := models.ImportJob{ID: bson.NewObjectID(), ShelfID: &target.ID}
+	state := newTestImportState(job, named, target)
+
+	for i := int64(1); i <= 3; i++ {
+		shelfID, row, column := placedAt(t, state, importRecord(i, map[string]string{
+			"shelf_address": "A1", "row": "4", "column": "4",
+		}))
+		if shelfID != target.ID || row != 1 || column != int(i) {
+			t.Errorf("record %d placed on %s at %d,%d", i, shelfID.Hex(), row, column)
+		}
+	}
+}
+
+func TestImportResumeKeepsSlots(t *testing.T) {
+	shelf := models.Shelf{ID: bson.NewObjectID(), Address: "A1", Rows: 3, Columns: 1}
+	job := models.ImportJob{ID: bson.NewObjectID()}
+	state := newTestImportState(job, shelf)
+	// the first run wrote record 1 to row 2 before stopping
+	slot := slotKey{shelf.ID, 2, 1}
+	state.claim(slot, slotOwner{job.ID, 1})
+	state.placed[1] = slot
+
+	if _, row, _ := placedAt(t, state, importRecord(1, map[string]string{"shelf_address": "A1"})); row != 2 {
+		t.Errorf("resumed record 1 moved to row %d", row)
+	}
+	if _, row, _ := placedAt(t, state, importRecord(2, map[string]string{"shelf_address": "A1"})); row != 1 {
+		t.Errorf("record 2 placed at row %d, want the free row 1", row)
+	}
+}
+
+func TestImportRequiresShelf(t *testing.T) {
+	state := newTestImportState(models.ImportJob{ID: bson.NewObjectID()})
+	_, problems := state.validate(importRecord(1, nil))
+	if len(problems) != 1 || problems[0].Field != "shelf_address" {
+		t.Errorf("problems = %+v", problems)
+	}
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var (
+	ErrISBNLength       = errors.New("ISBN must have 10 or 13 digits")
+	ErrISBNChecksum     = errors.New("ISBN check digit does not match")
+	ErrISBNNotBookland  = errors.New("ISBN-13 must start with 978 or 979")
+	ErrISBNNoShortForm  = errors.New("only 978 ISBNs have an ISBN-10 form")
+	ErrISBNInvalidDigit = errors.New("ISBN contains characters other than digits")
+)
+
+// CleanISBN drops hyphens and spaces and upper-cases a trailing x, without
+// checking anything else.
+func CleanISBN(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.TrimSpace(raw) {
+		switch {
+		case r == '-' || r == ' ':
+		case r == 'x':
+			b.WriteRune('X')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// NormalizeISBN validates an ISBN-10 or ISBN-13 in any hyphenation and
+// returns the canonical ISBN-13 books are stored under.
+func NormalizeISBN(raw string) (string, error) {
+	isbn := CleanISBN(raw)
+	switch len(isbn) {
+	case 10:
+		if err := checkISBN10(isbn); err != nil {
+			return "", err
+		}
+		return ISBN10To13(isbn)
+	case 13:
+		if err := checkISBN13(isbn); err != nil {
+			return "", err
+		}
+		return isbn, nil
+	}
+	return "", ErrISBNLength
+}
+
+// ISBN10To13 converts a valid ISBN-10 to its 978 ISBN-13.
+func ISBN10To13(isbn10 string) (string, error) {
+	isbn10 = CleanISBN(isbn10)
+	if err := checkISBN10(isbn10); err != nil {
+		return "", err
+	}
+	return CompleteISBN13("978" + isbn10[:9]), nil
+}
+
+// ISBN13To10 converts a valid 978 ISBN-13 to its ISBN-10.
+func ISBN13To10(isbn13 string) (string, error) {
+	isbn13 = CleanISBN(isbn13)
+	if err := checkISBN13(isbn13); err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(isbn13, "978") {
+		return "", ErrISBNNoShortForm
+	}
+	body := isbn13[3:12]
+	sum := 0
+	for i, r := range body {
+		sum += (10 - i) * int(r-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return body + "X", nil
+	}
+	return body + string(rune('0'+check)), nil
+}
+
+// CompleteISBN13 appends the check digit to the first twelve digits of an
+// ISBN-13.
+func CompleteISBN13(first12 string) string {
+	sum := 0
+	for i, r := range first12 {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += weight * int(r-'0')
+	}
+	return first12 + string(rune('0'+(10-sum%10)%10))
+}
+
+func checkISBN10(isbn string) error {
+	sum := 0
+	for i, r := range isbn {
+		var digit int
+		switch {
+		case r >= '0' && r <= '9':
+			digit = int(r - '0')
+		case r == 'X' && i == 9:
+			digit = 10
+		default:
+			return ErrISBNInvalidDigit
+		}
+		sum += (10 - i) * digit
+	}
+	if sum%11 != 0 {
+		return ErrISBNChecksum
+	}
+	return nil
+}
+
+func checkISBN13(isbn string) error {
+	for _, r := range isbn {
+		if r < '0' || r > '9' {
+			return ErrISBNInvalidDigit
+		}
+	}
+	if !strings.HasPrefix(isbn, "978") && !strings.HasPrefix(isbn, "979") {
+		return ErrISBNNotBookland
+	}
+	if CompleteISBN13(isbn[:12]) != isbn {
+		return ErrISBNChecksum
+	}
+	return nil
+}
+
+type ISBNIssue struct {
+	BookID bson.ObjectID `json:"book_id"`
+	Title  string        `json:"title"`
+	ISBN   string        `json:"isbn"`
+	Reason string        `json:"reason"`
+}
+
+type ISBNReport struct {
+	Checked    int64       `json:"checked"`
+	Canonical  int64       `json:"canonical"`
+	Normalized int64       `json:"normalized"`
+	Missing    int64       `json:"missing"`
+	Invalid    []ISBNIssue `json:"invalid"`
+}
+
+// MigrateISBNs checks every stored ISBN. Valid ones not yet in canonical
+// form are rewritten when apply is set (and only counted otherwise);
+// invalid ones are left alone and listed in the report.
+func MigrateISBNs(ctx context.Context, apply bool) (ISBNReport, error) {
+	report := ISBNReport{Invalid: []ISBNIssue{}}
+	collection := config.GetBookCollection()
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return report, err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var book models.Book
+		if err := cursor.Decode(&book); err != nil {
+			return report, err
+		}
+		report.Checked++
+		if strings.TrimSpace(book.ISBN) == "" {
+			report.Missing++
+			continue
+		}
+		isbn, err := NormalizeISBN(book.ISBN)
+		if err != nil {
+			report.Invalid = append(report.Invalid, ISBNIssue{
+				BookID: book.ID,
+				Title:  book.Title,
+				ISBN:   book.ISBN,
+				Reason: err.Error(),
+			})
+			continue
+		}
+		if isbn == book.ISBN {
+			report.Canonical++
+			continue
+		}
+		report.Normalized++
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": book.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"isbn": isbn}}))
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+	if apply && len(writes) > 0 {
+		if _, err := collection.BulkWrite(ctx, writes); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import "testing"
+
+func TestNormalizeISBN(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr error
+	}{
+		{"0-306-40615-2", "9780306406157", nil},
+		{"978-0-306-40615-7", "9780306406157", nil},
+		{" 9780306406157 ", "9780306406157", nil},
+		{"080442957X", "9780804429573", nil},
+		{"0 8044 2957 x", "9780804429573", nil},
+		{"979-10-90636-07-1", "9791090636071", nil},
+		{"0-306-40615-3", "", ErrISBNChecksum},
+		{"978-0-306-40615-8", "", ErrISBNChecksum},
+		{"9771234567003", "", ErrISBNNotBookland},
+		{"03064061X2", "", ErrISBNInvalidDigit},
+		{"978030640615A", "", ErrISBNInvalidDigit},
+		{"12345", "", ErrISBNLength},
+		{"", "", ErrISBNLength},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeISBN(tt.raw)
+		if got != tt.want || err != tt.wantErr {
+			t.Errorf("NormalizeISBN(%q) = %q, %v, want %q, %v", tt.raw, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestISBN13To10(t *testing.T) {
+	tests := []struct {
+		isbn13  string
+		want    string
+		wantErr error
+	}{
+		{"9780306406157", "0306406152", nil},
+		{"978-0-8044-2957-3", "080442957X", nil},
+		{"9791090636071", "", ErrISBNNoShortForm},
+		{"9780306406158", "", ErrISBNChecksum},
+	}
+	for _, tt := range tests {
+		got, err := ISBN13To10(tt.isbn13)
+		if got != tt.want || err != tt.wantErr {
+			t.Errorf("ISBN13To10(%q) = %q, %v, want %q, %v", tt.isbn13, got, err, tt.want, tt.wantErr)
+		}
+		if err == nil {
+			if back, _ := ISBN10To13(got); back != CleanISBN(tt.isbn13) {
+				t.Errorf("ISBN10To13(%q) = %q, want %q", got, back, CleanISBN(tt.isbn13))
+			}
+		}
+	}
+}
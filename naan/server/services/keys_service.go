@@ -0,0 +1,254 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+)
+
+// devKeyPrefix marks keys generated automatically in dev mode. They are
+// ignored outside dev mode the same way a default secret would be refused.
+const devKeyPrefix = "dev-"
+
+type signingKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	Signer crypto.Signer // nil for keys that are only kept for verification
+	Public crypto.PublicKey
+}
+
+var (
+	activeKey       *signingKey
+	verificationKey = map[string]*signingKey{}
+)
+
+// LoadSigningKeys reads every PEM file in JWT_KEYS_DIR. The file name without
+// .pem is the kid. Private keys can sign and verify, public keys only verify,
+// which is how a retired key is kept around until its tokens expire. The
+// signing key is JWT_ACTIVE_KID, or the last private key by name.
+func LoadSigningKeys() error {
+	dir := config.Env("JWT_KEYS_DIR", "keys")
+	keys, err := readKeyDir(dir)
+	if err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		if !config.IsDevMode() {
+			return fmt.Errorf("no signing keys found in %s, generate one with cmd/generate_key", dir)
+		}
+		key, err := generateDevKey(dir)
+		if err != nil {
+			return err
+		}
+		keys = []*signingKey{key}
+	}
+
+	var active *signingKey
+	verify := map[string]*signingKey{}
+	activeKID := config.Env("JWT_ACTIVE_KID", "")
+	for _, key := range keys {
+		if strings.HasPrefix(key.ID, devKeyPrefix) && !config.IsDevMode() {
+			log.Printf("⚠️ ignoring dev key %s outside dev mode", key.ID)
+			continue
+		}
+		verify[key.ID] = key
+		if key.Signer == nil {
+			continue
+		}
+		if activeKID == "" || key.ID == activeKID {
+			active = key
+		}
+	}
+	if active == nil {
+		return fmt.Errorf("no usable private key for active kid %q in %s", activeKID, dir)
+	}
+
+	activeKey = active
+	verificationKey = verify
+	log.Printf("signing tokens with %s key %s (%d verification keys)", activeKey.Method.Alg(), activeKey.ID, len(verificationKey))
+	return nil
+}
+
+func SignToken(claims jwt.MapClaims) (string, error) {
+	if activeKey == nil {
+		return "", errors.New("signing keys not loaded")
+	}
+	claims["iss"] = config.Env("JWT_ISSUER", "naan")
+	token := jwt.NewWithClaims(activeKey.Method, claims)
+	token.Header["kid"] = activeKey.ID
+	return token.SignedString(activeKey.Signer)
+}
+
+// VerificationKey is the jwt.Keyfunc for tokens issued by SignToken.
+func VerificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := verificationKey[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for kid %q", token.Method.Alg(), kid)
+	}
+	return key.Public, nil
+}
+
+func ParseToken(raw string) (*jwt.Token, error) {
+	return jwt.Parse(raw, VerificationKey, jwt.WithValidMethods([]string{"RS256", "EdDSA"}))
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS lists every verification key so that other services can check
+// naan tokens without holding a signing key.
+func PublicJWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range verificationKey {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// GenerateSigningKey writes a new PKCS8 private key to dir/<kid>.pem.
+func GenerateSigningKey(dir, kid, keyType string) (string, error) {
+	var private crypto.Signer
+	var err error
+	switch keyType {
+	case "ed25519":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case "rsa":
+		private, err = rsa.GenerateKey(rand.Reader, 3072)
+	default:
+		return "", fmt.Errorf("unsupported key type %q", keyType)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, kid+".pem")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return path, pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func generateDevKey(dir string) (*signingKey, error) {
+	kid := devKeyPrefix + time.Now().Format("20060102")
+	path, err := GenerateSigningKey(dir, kid, "ed25519")
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate dev signing key: %w", err)
+	}
+	log.Printf("⚠️ dev mode: generated signing key %s", path)
+	return readKeyFile(path)
+}
+
+func readKeyDir(dir string) ([]*signingKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	keys := make([]*signingKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := readKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func readKeyFile(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key := &signingKey{ID: strings.TrimSuffix(filepath.Base(path), ".pem")}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.Signer = signer
+		key.Public = signer.Public()
+	} else {
+		key.Public = parsed
+	}
+	switch key.Public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s: only RSA and Ed25519 keys are supported", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,383 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	ErrLocationNotFound = errors.New("location not found")
+	ErrLocationName     = errors.New("location name is required")
+	ErrLocationExists   = errors.New("a location with this name is already there")
+	ErrLocationParent   = errors.New("a location goes in the level above it: branch, floor, room, shelf unit")
+	ErrLocationNotEmpty = errors.New("location still holds locations or shelves, move or delete them first")
+	ErrShelfNotFound    = errors.New("shelf not found")
+	ErrShelfUnit        = errors.New("shelves can only be placed in a shelf unit")
+	ErrShelfGrid        = errors.New("shelves in a shelf unit need positive rows and columns")
+	ErrShelfGridInUse   = errors.New("books stand beyond the new rows or columns, move them first")
+	ErrSlotOutOfRange   = errors.New("row and column must be within the shelf's rows and columns")
+)
+
+// childKinds is the level each kind of location holds. Shelf units hold
+// shelves, which live in their own collection.
+var childKinds = map[string]string{
+	"":                    models.LocationBranch,
+	models.LocationBranch: models.LocationFloor,
+	models.LocationFloor:  models.LocationRoom,
+	models.LocationRoom:   models.LocationUnit,
+}
+
+func GetLocation(ctx context.Context, id bson.ObjectID) (models.Location, error) {
+	var location models.Location
+	err := config.GetLocationCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&location)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return location, ErrLocationNotFound
+	}
+	return location, err
+}
+
+func GetShelf(ctx context.Context, id bson.ObjectID) (models.Shelf, error) {
+	var shelf models.Shelf
+	err := config.GetShelfCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&shelf)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return shelf, ErrShelfNotFound
+	}
+	return shelf, err
+}
+
+// CreateLocation adds a location under parent, or a branch when parentID
+// is nil. Its kind follows from the parent's.
+func CreateLocation(ctx context.Context, name string, parentID *bson.ObjectID) (models.Location, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return models.Location{}, ErrLocationName
+	}
+	location := models.Location{
+		Kind:      models.LocationBranch,
+		Name:      name,
+		Key:       FoldText(name),
+		Ancestors: []bson.ObjectID{},
+		Path:      []models.LocationCrumb{},
+	}
+	if parentID != nil {
+		parent, err := GetLocation(ctx, *parentID)
+		if err != nil {
+			return location, err
+		}
+		kind, ok := childKinds[parent.Kind]
+		if !ok {
+			return location, ErrLocationParent
+		}
+		location.Kind = kind
+		location.ParentID = parentID
+		location.Ancestors = append(append([]bson.ObjectID{}, parent.Ancestors...), parent.ID)
+		location.Path = append([]models.LocationCrumb{}, parent.Path...)
+	}
+	now := time.Now()
+	location.CreatedAt, location.UpdatedAt = now, now
+	location.ID = bson.NewObjectID()
+	location.Path = append(location.Path, models.LocationCrumb{ID: location.ID, Kind: location.Kind, Name: name})
+
+	_, err := config.GetLocationCollection().InsertOne(ctx, location)
+	if mongo.IsDuplicateKeyError(err) {
+		return location, ErrLocationExists
+	}
+	return location, err
+}
+
+// RenameLocation renames a location and the breadcrumbs below it.
+func RenameLocation(ctx context.Context, id bson.ObjectID, name string) (models.Location, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return models.Location{}, ErrLocationName
+	}
+	_, err := config.GetLocationCollection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"name":       name,
+		"key":        FoldText(name),
+		"updated_at": time.Now(),
+	}})
+	if mongo.IsDuplicateKeyError(err) {
+		return models.Location{}, ErrLocationExists
+	}
+	if err != nil {
+		return models.Location{}, err
+	}
+	if err := refreshLocationPaths(ctx); err != nil {
+		return models.Location{}, err
+	}
+	return GetLocation(ctx, id)
+}
+
+// MoveLocation places a location, with everything in it, under a new
+// parent of the level above, such as a room on another floor.
+func MoveLocation(ctx context.Context, id, parentID bson.ObjectID) (models.Location, error) {
+	location, err := GetLocation(ctx, id)
+	if err != nil {
+		return location, err
+	}
+	parent, err := GetLocation(ctx, parentID)
+	if err != nil {
+		return location, err
+	}
+	if childKinds[parent.Kind] != location.Kind {
+		return location, ErrLocationParent
+	}
+	_, err = config.GetLocationCollection().UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"parent_id":  parentID,
+		"updated_at": time.Now(),
+	}})
+	if mongo.IsDuplicateKeyError(err) {
+		return location, ErrLocationExists
+	}
+	if err != nil {
+		return location, err
+	}
+	if err := refreshLocationPaths(ctx); err != nil {
+		return location, err
+	}
+	return GetLocation(ctx, id)
+}
+
+// DeleteLocation removes an empty location.
+func DeleteLocation(ctx context.Context, id bson.ObjectID) error {
+	if _, err := GetLocation(ctx, id); err != nil {
+		return err
+	}
+	children, err := config.GetLocationCollection().CountDocuments(ctx, bson.M{"parent_id": id})
+	if err != nil {
+		return err
+	}
+	shelves, err := config.GetShelfCollection().CountDocuments(ctx, bson.M{"location_id": id})
+	if err != nil {
+		return err
+	}
+	if children > 0 || shelves > 0 {
+		return ErrLocationNotEmpty
+	}
+	_, err = config.GetLocationCollection().DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+func allLocations(ctx context.Context) ([]models.Location, error) {
+	cursor, err := config.GetLocationCollection().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var locations []models.Location
+	if err := cursor.All(ctx, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+// refreshLocationPaths rebuilds the ancestors and breadcrumbs of every
+// location from the parent links, then the paths of the shelves in the
+// units that changed. The tree is small enough to rebuild whole.
+func refreshLocationPaths(ctx context.Context) error {
+	locations, err := allLocations(ctx)
+	if err != nil {
+		return err
+	}
+	byID := make(map[bson.ObjectID]*models.Location, len(locations))
+	for i := range locations {
+		byID[locations[i].ID] = &locations[i]
+	}
+	built := map[bson.ObjectID][]models.LocationCrumb{}
+	var pathOf func(location *models.Location) []models.LocationCrumb
+	pathOf = func(location *models.Location) []models.LocationCrumb {
+		if path, ok := built[location.ID]; ok {
+			return path
+		}
+		var path []models.LocationCrumb
+		if location.ParentID != nil {
+			if parent, ok := byID[*location.ParentID]; ok {
+				path = append(path, pathOf(parent)...)
+			}
+		}
+		path = append(path, models.LocationCrumb{ID: location.ID, Kind: location.Kind, Name: location.Name})
+		built[location.ID] = path
+		return path
+	}
+
+	var writes []mongo.WriteModel
+	var changedUnits []*models.Location
+	for i := range locations {
+		location := &locations[i]
+		path := pathOf(location)
+		if sameCrumbs(path, location.Path) {
+			continue
+		}
+		ancestors := make([]bson.ObjectID, 0, len(path)-1)
+		for _, crumb := range path[:len(path)-1] {
+			ancestors = append(ancestors, crumb.ID)
+		}
+		location.Path, location.Ancestors = path, ancestors
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": location.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"path": path, "ancestors": ancestors}}))
+		if location.Kind == models.LocationUnit {
+			changedUnits = append(changedUnits, location)
+		}
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	if _, err := config.GetLocationCollection().BulkWrite(ctx, writes); err != nil {
+		return err
+	}
+	for _, unit := range changedUnits {
+		_, err := config.GetShelfCollection().UpdateMany(ctx, bson.M{"location_id": unit.ID},
+			bson.M{"$set": bson.M{"path": unit.Path}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameCrumbs(a, b []models.LocationCrumb) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// LocationTree returns every branch with the locations below it and the
+// shelves of each shelf unit, plus the shelves not placed in the tree.
+func LocationTree(ctx context.Context) ([]models.LocationNode, []models.Shelf, error) {
+	locations, err := allLocations(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	cursor, err := config.GetShelfCollection().Find(ctx, bson.M{}, options.Find().
+		SetSort(bson.D{{Key: "address", Value: 1}}))
+	if err != nil {
+		return nil, nil, err
+	}
+	var shelves []models.Shelf
+	if err := cursor.All(ctx, &shelves); err != nil {
+		return nil, nil, err
+	}
+
+	unitShelves := map[bson.ObjectID][]models.Shelf{}
+	unplaced := []models.Shelf{}
+	for _, shelf := range shelves {
+		if shelf.LocationID == nil {
+			unplaced = append(unplaced, shelf)
+		} else {
+			unitShelves[*shelf.LocationID] = append(unitShelves[*shelf.LocationID], shelf)
+		}
+	}
+	children := map[bson.ObjectID][]models.Location{}
+	var roots []models.Location
+	for _, location := range locations {
+		if location.ParentID == nil {
+			roots = append(roots, location)
+		} else {
+			children[*location.ParentID] = append(children[*location.ParentID], location)
+		}
+	}
+	var build func([]models.Location) []models.LocationNode
+	build = func(level []models.Location) []models.LocationNode {
+		sort.Slice(level, func(i, j int) bool { return level[i].Key < level[j].Key })
+		nodes := make([]models.LocationNode, 0, len(level))
+		for _, location := range level {
+			node := models.LocationNode{Location: location, Children: build(children[location.ID])}
+			if location.Kind == models.LocationUnit {
+				node.Shelves = unitShelves[location.ID]
+				if node.Shelves == nil {
+					node.Shelves = []models.Shelf{}
+				}
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+	return build(roots), unplaced, nil
+}
+
+// ShelfPath checks that a shelf can be placed in locationID and returns the
+// breadcrumb it gets there. Shelves in the tree need a declared grid.
+func ShelfPath(ctx context.Context, locationID *bson.ObjectID, rows, columns int) ([]models.LocationCrumb, error) {
+	if rows < 0 || columns < 0 {
+		return nil, ErrShelfGrid
+	}
+	if locationID == nil {
+		return nil, nil
+	}
+	unit, err := GetLocation(ctx, *locationID)
+	if err != nil {
+		return nil, err
+	}
+	if unit.Kind != models.LocationUnit {
+		return nil, ErrShelfUnit
+	}
+	if rows == 0 || columns == 0 {
+		return nil, ErrShelfGrid
+	}
+	return unit.Path, nil
+}
+
+// CheckShelfGrid refuses to shrink a shelf's grid past books standing on it.
+func CheckShelfGrid(ctx context.Context, shelfID bson.ObjectID, rows, columns int) error {
+	var outside bson.A
+	if rows > 0 {
+		outside = append(outside, bson.M{"row": bson.M{"$gt": rows}})
+	}
+	if columns > 0 {
+		outside = append(outside, bson.M{"column": bson.M{"$gt": columns}})
+	}
+	if len(outside) == 0 {
+		return nil
+	}
+	count, err := config.GetBookCollection().CountDocuments(ctx, bson.M{"shelf_id": shelfID, "$or": outside})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrShelfGridInUse
+	}
+	return nil
+}
+
+// CheckSlot tells whether a row and column lie on a shelf's declared grid.
+// Shelves without one take any position.
+func CheckSlot(shelf models.Shelf, row, column int) error {
+	if shelf.Rows > 0 && (row < 1 || row > shelf.Rows) {
+		return ErrSlotOutOfRange
+	}
+	if shelf.Columns > 0 && (column < 1 || column > shelf.Columns) {
+		return ErrSlotOutOfRange
+	}
+	return nil
+}
+
+// CheckPlacement is CheckSlot for a shelf known by ID.
+func CheckPlacement(ctx context.Context, shelfID bson.ObjectID, row, column int) error {
+	shelf, err := GetShelf(ctx, shelfID)
+	if err != nil {
+		return err
+	}
+	return CheckSlot(shelf, row, column)
+}
+
+// LocationPath is the breadcrumb shown for a book: the shelf's path with
+// the shelf itself at the end.
+func LocationPath(shelf models.Shelf) []models.LocationCrumb {
+	return append(append([]models.LocationCrumb{}, shelf.Path...),
+		models.LocationCrumb{ID: shelf.ID, Kind: models.LocationShelf, Name: shelf.Address})
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	LoginKindUsername = "username"
+	LoginKindIP       = "ip"
+
+	loginBaseLockout = 30 * time.Second
+	loginMaxLockout  = time.Hour
+)
+
+// number of failures tolerated before a key gets locked. IPs get more room
+// since a whole hostel can sit behind the same address.
+var loginFreeAttempts = map[string]int{
+	LoginKindUsername: 5,
+	LoginKindIP:       20,
+}
+
+func LoginAttemptKey(kind, value string) string {
+	return kind + ":" + value
+}
+
+// loginLockout doubles the lockout for every failure past the free attempts.
+func loginLockout(kind string, failures int) time.Duration {
+	free := loginFreeAttempts[kind]
+	if failures < free {
+		return 0
+	}
+	lockout := loginBaseLockout
+	for i := free; i < failures && lockout < loginMaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, loginMaxLockout)
+}
+
+// LoginLockedFor returns how long the longest running lock on any of the
+// given keys still has left, or zero if none of them are locked.
+func LoginLockedFor(ctx context.Context, keys ...string) (time.Duration, error) {
+	now := time.Now()
+	cursor, err := config.GetLoginAttemptCollection().Find(ctx, bson.M{
+		"key":          bson.M{"$in": keys},
+		"locked_until": bson.M{"$gt": now},
+	})
+	if err != nil {
+		return 0, err
+	}
+	var attempts []models.LoginAttempt
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return 0, err
+	}
+
+	var wait time.Duration
+	for _, attempt := range attempts {
+		wait = max(wait, attempt.LockedUntil.Sub(now))
+	}
+	return wait, nil
+}
+
+// RecordLoginFailure bumps the failure counter for kind/value and locks it
+// once it runs out of free attempts. The returned attempt reflects the lock.
+func RecordLoginFailure(ctx context.Context, kind, value string) (models.LoginAttempt, error) {
+	collection := config.GetLoginAttemptCollection()
+	key := LoginAttemptKey(kind, value)
+	now := time.Now()
+
+	var attempt models.LoginAttempt
+	err := collection.FindOneAndUpdate(ctx, bson.M{"key": key}, bson.M{
+		"$inc": bson.M{"failures": 1},
+		"$set": bson.M{
+			"kind":            kind,
+			"value":           value,
+			"last_failure_at": now,
+		},
+	}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&attempt)
+	if err != nil {
+		return attempt, err
+	}
+
+	lockout := loginLockout(kind, attempt.Failures)
+	if lockout == 0 {
+		return attempt, nil
+	}
+	lockedUntil := now.Add(lockout)
+	_, err = collection.UpdateOne(ctx, bson.M{"key": key}, bson.M{
+		"$set": bson.M{"locked_until": lockedUntil},
+	})
+	attempt.LockedUntil = &lockedUntil
+	return attempt, err
+}
+
+// ClearLoginFailures forgets the counter and any lock for the key.
+func ClearLoginFailures(ctx context.Context, key string) (bool, error) {
+	result, err := config.GetLoginAttemptCollection().DeleteOne(ctx, bson.M{"key": key})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+func ListLockedLogins(ctx context.Context) ([]models.LoginAttempt, error) {
+	cursor, err := config.GetLoginAttemptCollection().Find(ctx, bson.M{
+		"locked_until": bson.M{"$gt": time.Now()},
+	}, options.Find().SetSort(bson.D{{Key: "locked_until", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	attempts := []models.LoginAttempt{}
+	if err := cursor.All(ctx, &attempts); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
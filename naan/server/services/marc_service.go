@@ -0,0 +1,557 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+)
+
+const (
+	marcFieldTerminator  = 0x1E
+	marcRecordTerminator = 0x1D
+	marcSubfieldDelim    = 0x1F
+	marcLeaderLength     = 24
+	marcDirectoryEntry   = 12
+	MARCXMLNamespace     = "http://www.loc.gov/MARC21/slim"
+)
+
+var ErrInvalidMARC = errors.New("invalid MARC record")
+
+// ReadISO2709 calls visit with each record of a binary MARC file.
+func ReadISO2709(r io.Reader, visit func(models.MARCRecord, error) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		// skip line breaks some tools put between records
+		for {
+			b, err := reader.Peek(1)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if b[0] != '\n' && b[0] != '\r' {
+				break
+			}
+			reader.ReadByte()
+		}
+
+		prefix, err := reader.Peek(5)
+		if err != nil {
+			return fmt.Errorf("%w: truncated record", ErrInvalidMARC)
+		}
+		length, err := strconv.Atoi(string(prefix))
+		if err != nil || length < marcLeaderLength+1 {
+			return fmt.Errorf("%w: bad record length %q", ErrInvalidMARC, prefix)
+		}
+		raw := make([]byte, length)
+		if _, err := io.ReadFull(reader, raw); err != nil {
+			return fmt.Errorf("%w: truncated record", ErrInvalidMARC)
+		}
+		record, err := ParseISO2709(raw)
+		if err := visit(record, err); err != nil {
+			return err
+		}
+	}
+}
+
+// ParseISO2709 decodes a single binary MARC record.
+func ParseISO2709(raw []byte) (models.MARCRecord, error) {
+	var record models.MARCRecord
+	if len(raw) < marcLeaderLength+1 || raw[len(raw)-1] != marcRecordTerminator {
+		return record, fmt.Errorf("%w: missing record terminator", ErrInvalidMARC)
+	}
+	record.Leader = string(raw[:marcLeaderLength])
+	base, err := strconv.Atoi(string(raw[12:17]))
+	if err != nil || base <= marcLeaderLength || base > len(raw) {
+		return record, fmt.Errorf("%w: bad base address", ErrInvalidMARC)
+	}
+	directory := raw[marcLeaderLength : base-1]
+	if len(directory)%marcDirectoryEntry != 0 {
+		return record, fmt.Errorf("%w: bad directory", ErrInvalidMARC)
+	}
+
+	for i := 0; i < len(directory); i += marcDirectoryEntry {
+		entry := directory[i : i+marcDirectoryEntry]
+		tag := string(entry[:3])
+		length, err1 := strconv.Atoi(string(entry[3:7]))
+		start, err2 := strconv.Atoi(string(entry[7:12]))
+		if err1 != nil || err2 != nil || base+start+length > len(raw) || length < 1 {
+			return record, fmt.Errorf("%w: bad directory entry for %s", ErrInvalidMARC, tag)
+		}
+		data := bytes.TrimSuffix(raw[base+start:base+start+length], []byte{marcFieldTerminator})
+		if isMARCControlTag(tag) {
+			record.ControlFields = append(record.ControlFields, models.MARCControlField{Tag: tag, Value: string(data)})
+			continue
+		}
+		if len(data) < 2 {
+			return record, fmt.Errorf("%w: field %s has no indicators", ErrInvalidMARC, tag)
+		}
+		field := models.MARCDataField{Tag: tag, Ind1: string(data[0]), Ind2: string(data[1])}
+		for _, sub := range bytes.Split(data[2:], []byte{marcSubfieldDelim}) {
+			if len(sub) == 0 {
+				continue
+			}
+			field.Subfields = append(field.Subfields, models.MARCSubfield{Code: string(sub[0]), Value: string(sub[1:])})
+		}
+		record.DataFields = append(record.DataFields, field)
+	}
+	return record, nil
+}
+
+// WriteISO2709 encodes a record as binary MARC, computing the leader's
+// record length and base address.
+func WriteISO2709(w io.Writer, record models.MARCRecord) error {
+	var directory, data bytes.Buffer
+	add := func(tag string, body []byte) {
+		body = append(body, marcFieldTerminator)
+		fmt.Fprintf(&directory, "%3s%04d%05d", tag, len(body), data.Len())
+		data.Write(body)
+	}
+	for _, field := range record.ControlFields {
+		add(field.Tag, []byte(field.Value))
+	}
+	for _, field := range record.DataFields {
+		body := []byte(marcIndicator(field.Ind1) + marcIndicator(field.Ind2))
+		for _, sub := range field.Subfields {
+			body = append(body, marcSubfieldDelim)
+			body = append(body, sub.Code...)
+			body = append(body, sub.Value...)
+		}
+		add(field.Tag, body)
+	}
+	directory.WriteByte(marcFieldTerminator)
+
+	base := marcLeaderLength + directory.Len()
+	length := base + data.Len() + 1
+	if length > 99999 {
+		return fmt.Errorf("%w: record longer than 99999 bytes", ErrInvalidMARC)
+	}
+	leader := []byte(normalizeLeader(record.Leader))
+	copy(leader[0:5], fmt.Sprintf("%05d", length))
+	copy(leader[12:17], fmt.Sprintf("%05d", base))
+
+	out := make([]byte, 0, length)
+	out = append(out, leader...)
+	out = append(out, directory.Bytes()...)
+	out = append(out, data.Bytes()...)
+	out = append(out, marcRecordTerminator)
+	_, err := w.Write(out)
+	return err
+}
+
+// normalizeLeader fills in what a MARC 21 leader must contain: UTF-8
+// encoding, indicator and subfield code counts and the entry map.
+func normalizeLeader(leader string) string {
+	out := []byte("00000nam a2200000 i 4500")
+	if len(leader) == marcLeaderLength {
+		copy(out, leader)
+	}
+	out[9] = 'a'
+	out[10], out[11] = '2', '2'
+	copy(out[20:], "4500")
+	return string(out)
+}
+
+func marcIndicator(value string) string {
+	if len(value) != 1 {
+		return " "
+	}
+	return value
+}
+
+func isMARCControlTag(tag string) bool {
+	return strings.HasPrefix(tag, "00")
+}
+
+type marcXMLCollection struct {
+	XMLName xml.Name        `xml:"collection"`
+	Xmlns   string          `xml:"xmlns,attr,omitempty"`
+	Records []marcXMLRecord `xml:"record"`
+}
+
+type marcXMLRecord struct {
+	XMLName       xml.Name `xml:"record"`
+	Xmlns         string   `xml:"xmlns,attr,omitempty"`
+	Leader        string   `xml:"leader"`
+	ControlFields []struct {
+		Tag   string `xml:"tag,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"controlfield"`
+	DataFields []struct {
+		Tag       string `xml:"tag,attr"`
+		Ind1      string `xml:"ind1,attr"`
+		Ind2      string `xml:"ind2,attr"`
+		Subfields []struct {
+			Code  string `xml:"code,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"subfield"`
+	} `xml:"datafield"`
+}
+
+// ReadMARCXML calls visit with each <record> of a MARCXML document, whether
+// the records sit in a <collection> or stand alone.
+func ReadMARCXML(r io.Reader, visit func(models.MARCRecord, error) error) error {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidMARC, err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+		var raw marcXMLRecord
+		if err := decoder.DecodeElement(&raw, &start); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidMARC, err)
+		}
+		record := models.MARCRecord{Leader: raw.Leader}
+		for _, field := range raw.ControlFields {
+			record.ControlFields = append(record.ControlFields, models.MARCControlField{Tag: field.Tag, Value: field.Value})
+		}
+		for _, field := range raw.DataFields {
+			data := models.MARCDataField{Tag: field.Tag, Ind1: field.Ind1, Ind2: field.Ind2}
+			for _, sub := range field.Subfields {
+				data.Subfields = append(data.Subfields, models.MARCSubfield{Code: sub.Code, Value: sub.Value})
+			}
+			record.DataFields = append(record.DataFields, data)
+		}
+		if err := visit(record, nil); err != nil {
+			return err
+		}
+	}
+}
+
+// WriteMARCXMLRecord writes one <record> element; wrap records in
+// MARCXMLHeader and MARCXMLFooter for a collection.
+func WriteMARCXMLRecord(w io.Writer, record models.MARCRecord, xmlns bool) error {
+	encoder := xml.NewEncoder(w)
+	start := xml.StartElement{Name: xml.Name{Local: "record"}}
+	if xmlns {
+		start.Attr = []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: MARCXMLNamespace}}
+	}
+	encoder.EncodeToken(start)
+	encoder.EncodeElement(normalizeLeader(record.Leader), xml.StartElement{Name: xml.Name{Local: "leader"}})
+	for _, field := range record.ControlFields {
+		encoder.EncodeElement(field.Value, xml.StartElement{
+			Name: xml.Name{Local: "controlfield"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "tag"}, Value: field.Tag}},
+		})
+	}
+	for _, field := range record.DataFields {
+		fieldStart := xml.StartElement{Name: xml.Name{Local: "datafield"}, Attr: []xml.Attr{
+			{Name: xml.Name{Local: "tag"}, Value: field.Tag},
+			{Name: xml.Name{Local: "ind1"}, Value: marcIndicator(field.Ind1)},
+			{Name: xml.Name{Local: "ind2"}, Value: marcIndicator(field.Ind2)},
+		}}
+		encoder.EncodeToken(fieldStart)
+		for _, sub := range field.Subfields {
+			encoder.EncodeElement(sub.Value, xml.StartElement{
+				Name: xml.Name{Local: "subfield"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "code"}, Value: sub.Code}},
+			})
+		}
+		encoder.EncodeToken(fieldStart.End())
+	}
+	encoder.EncodeToken(start.End())
+	return encoder.Flush()
+}
+
+const (
+	MARCXMLHeader = xml.Header + `<collection xmlns="` + MARCXMLNamespace + `">` + "\n"
+	MARCXMLFooter = "</collection>\n"
+)
+
+// subfields returns the values of the given codes across every field with
+// this tag, in record order.
+func marcSubfields(record models.MARCRecord, tag string, codes string) []string {
+	var values []string
+	for _, field := range record.DataFields {
+		if field.Tag != tag {
+			continue
+		}
+		for _, sub := range field.Subfields {
+			if strings.Contains(codes, sub.Code) {
+				values = append(values, sub.Value)
+			}
+		}
+	}
+	return values
+}
+
+func firstMARCSubfield(record models.MARCRecord, tag string, code string) string {
+	if values := marcSubfields(record, tag, code); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// trimISBD drops the punctuation cataloguers put between subfields, as in
+// "The hobbit :" or "Allen & Unwin,".
+func trimISBD(value string) string {
+	value = strings.TrimRight(strings.TrimSpace(value), " /:;,=")
+	// keep the full stop of a trailing initial, as in "Tolkien, J. R. R."
+	if strings.HasSuffix(value, ".") && !trailingInitial.MatchString(value) {
+		value = strings.TrimSuffix(value, ".")
+	}
+	return strings.Trim(value, "[] ")
+}
+
+var trailingInitial = regexp.MustCompile(`(^|[\s.])\p{Lu}\.$`)
+
+// invertedName turns "Tolkien, J. R. R." into "J. R. R. Tolkien".
+func invertedName(value string) string {
+	value = trimISBD(value)
+	family, given, ok := strings.Cut(value, ", ")
+	if !ok {
+		return value
+	}
+	return strings.TrimSpace(given) + " " + strings.TrimSpace(family)
+}
+
+var (
+	pageCountPattern    = regexp.MustCompile(`(\d+)\s*(p\b|pages)`)
+	seriesNumberPattern = regexp.MustCompile(`\d+(\.\d+)?`)
+)
+
+// MARCToRecord maps a MARC record onto import fields. The local 949 field
+// carries the shelf address in $a, the row in $r and the column in $c, as
+// written by BookToMARC. Records from elsewhere have no 949; the import puts
+// them on a shelf the caller gives, in its free slots.
+func MARCToRecord(record models.MARCRecord) map[string]string {
+	fields := map[string]string{}
+	for _, value := range marcSubfields(record, "020", "a") {
+		// "0261102214 (pbk.)"
+		isbn := strings.Fields(value)
+		if len(isbn) > 0 {
+			if normalized, err := NormalizeISBN(isbn[0]); err == nil {
+				fields["isbn"] = normalized
+				break
+			}
+			if fields["isbn"] == "" {
+				fields["isbn"] = isbn[0]
+			}
+		}
+	}
+
+	title := trimISBD(firstMARCSubfield(record, "245", "a"))
+	if subtitle := trimISBD(firstMARCSubfield(record, "245", "b")); subtitle != "" {
+		title += ": " + subtitle
+	}
+	fields["title"] = title
+
+	// names are authors unless $e or $4 gives another role
+	var contributors []models.Contributor
+	for _, field := range record.DataFields {
+		if field.Tag != "100" && field.Tag != "110" && field.Tag != "700" && field.Tag != "710" {
+			continue
+		}
+		contributor := models.Contributor{Role: models.RoleAuthor}
+		for _, sub := range field.Subfields {
+			switch sub.Code {
+			case "a":
+				contributor.Name = invertedName(sub.Value)
+			case "e", "4":
+				if role, err := ContributorRole(sub.Value); err == nil {
+					contributor.Role = role
+				}
+			}
+		}
+		contributors = append(contributors, contributor)
+	}
+	contributors, _ = NormalizeContributors(contributors)
+	fields["contributors"] = FormatContributors(contributors)
+	fields["author"] = ContributorAuthorLine(contributors)
+
+	// 830 holds the controlled series title, 490 the one on the book
+	for _, tag := range []string{"830", "490"} {
+		if series := trimISBD(firstMARCSubfield(record, tag, "a")); series != "" {
+			fields["series"] = series
+			if match := seriesNumberPattern.FindString(firstMARCSubfield(record, tag, "v")); match != "" {
+				fields["series_number"] = match
+			}
+			break
+		}
+	}
+
+	// RDA records use 264 with second indicator 1, older ones 260
+	for _, field := range record.DataFields {
+		if field.Tag != "260" && !(field.Tag == "264" && field.Ind2 == "1") {
+			continue
+		}
+		for _, sub := range field.Subfields {
+			switch {
+			case sub.Code == "b" && fields["publisher"] == "":
+				fields["publisher"] = trimISBD(sub.Value)
+			case sub.Code == "c" && fields["published_year"] == "":
+				if year := publishedYear(sub.Value); year > 0 {
+					fields["published_year"] = strconv.Itoa(year)
+				}
+			}
+		}
+	}
+	if fields["published_year"] == "" {
+		for _, field := range record.ControlFields {
+			// 008/07-10 is Date 1
+			if field.Tag == "008" && len(field.Value) >= 11 {
+				if year, err := strconv.Atoi(field.Value[7:11]); err == nil && year > 0 {
+					fields["published_year"] = strconv.Itoa(year)
+				}
+			}
+		}
+	}
+
+	if match := pageCountPattern.FindStringSubmatch(firstMARCSubfield(record, "300", "a")); match != nil {
+		fields["page_count"] = match[1]
+	}
+
+	var subjects []string
+	for _, tag := range []string{"650", "651"} {
+		for _, subject := range marcSubfields(record, tag, "a") {
+			subjects = append(subjects, trimISBD(subject))
+		}
+	}
+	fields["subjects"] = strings.Join(subjects, ";")
+	if genre := trimISBD(firstMARCSubfield(record, "655", "a")); genre != "" {
+		fields["genre"] = genre
+	} else if len(subjects) > 0 {
+		fields["genre"] = subjects[0]
+	}
+
+	// local call numbers (09X) come before the ones assigned by LC (050) or
+	// in a Dewey edition (082)
+	for _, tag := range []string{"090", "092", "050", "082"} {
+		raw := strings.TrimSpace(firstMARCSubfield(record, tag, "a") + " " + firstMARCSubfield(record, tag, "b"))
+		if callNumber, err := ParseCallNumber(raw); err == nil {
+			fields["call_number"] = callNumber.Normalized
+			break
+		}
+	}
+
+	fields["shelf_address"] = firstMARCSubfield(record, "949", "a")
+	fields["row"] = firstMARCSubfield(record, "949", "r")
+	fields["column"] = firstMARCSubfield(record, "949", "c")
+	return fields
+}
+
+// BookToMARC builds a record for a book, reusing the leader and control
+// fields it was imported with.
+func BookToMARC(book models.Book, shelfAddress string) models.MARCRecord {
+	record := models.MARCRecord{Leader: book.MARCLeader}
+	hasID := false
+	for _, field := range book.MARCControl {
+		if field.Tag == "001" {
+			hasID = true
+		}
+		record.ControlFields = append(record.ControlFields, field)
+	}
+	if !hasID {
+		record.ControlFields = append([]models.MARCControlField{{Tag: "001", Value: book.ID.Hex()}}, record.ControlFields...)
+	}
+
+	data := func(tag, ind1, ind2 string, subfields ...string) {
+		field := models.MARCDataField{Tag: tag, Ind1: ind1, Ind2: ind2}
+		for i := 0; i+1 < len(subfields); i += 2 {
+			if subfields[i+1] != "" {
+				field.Subfields = append(field.Subfields, models.MARCSubfield{Code: subfields[i], Value: subfields[i+1]})
+			}
+		}
+		if len(field.Subfields) > 0 {
+			record.DataFields = append(record.DataFields, field)
+		}
+	}
+
+	data("020", " ", " ", "a", book.ISBN)
+	if callNumber, err := ParseCallNumber(book.CallNumber); err == nil {
+		// second indicator 4: assigned by this library
+		if callNumber.Scheme == CallNumberLC {
+			data("050", " ", "4", "a", callNumber.Class, "b", callNumber.Item)
+		} else {
+			data("082", "0", "4", "a", callNumber.Class, "b", callNumber.Item)
+		}
+	}
+	contributors := book.Contributors
+	if len(contributors) == 0 {
+		contributors = ContributorsFromAuthorLine(book.Author)
+	}
+	// the first author is the main entry, everyone else an added entry
+	mainEntry := false
+	var addedEntries []models.Contributor
+	for _, contributor := range contributors {
+		if contributor.Role == models.RoleAuthor && !mainEntry {
+			mainEntry = true
+			data("100", "1", " ", "a", invertName(contributor.Name), "e", contributor.Role)
+			continue
+		}
+		addedEntries = append(addedEntries, contributor)
+	}
+	titleInd1 := "0"
+	if mainEntry {
+		titleInd1 = "1"
+	}
+	data("245", titleInd1, "0", "a", book.Title)
+	year := ""
+	if book.PublishedYear > 0 {
+		year = strconv.Itoa(book.PublishedYear)
+	}
+	data("264", " ", "1", "b", book.Publisher, "c", year)
+	if book.PageCount > 0 {
+		data("300", " ", " ", "a", strconv.Itoa(book.PageCount)+" pages")
+	}
+	seriesNumber := ""
+	if book.SeriesNumber != 0 {
+		seriesNumber = strconv.FormatFloat(book.SeriesNumber, 'f', -1, 64)
+	}
+	data("490", "0", " ", "a", book.Series, "v", seriesNumber)
+	for _, subject := range book.Subjects {
+		data("650", " ", "4", "a", subject)
+	}
+	data("655", " ", "4", "a", book.Genre)
+	for _, contributor := range addedEntries {
+		data("700", "1", " ", "a", invertName(contributor.Name), "e", contributor.Role)
+	}
+	if book.CoverURL != "" {
+		data("856", "4", "2", "3", "Cover image", "u", book.CoverURL)
+	}
+	data("949", " ", " ", "a", shelfAddress, "r", strconv.Itoa(book.Row), "c", strconv.Itoa(book.Column))
+	return record
+}
+
+// invertName turns "J. R. R. Tolkien" into the "Tolkien, J. R. R." form
+// MARC headings use.
+func invertName(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.Contains(name, ",") {
+		return name
+	}
+	i := strings.LastIndex(name, " ")
+	if i < 0 {
+		return name
+	}
+	return name[i+1:] + ", " + name[:i]
+}
+
+// SplitAuthors splits an author line such as "Andrew Hunt & David Thomas".
+func SplitAuthors(line string) []string {
+	var authors []string
+	for _, part := range authorSeparators.Split(line, -1) {
+		if part = strings.TrimSpace(part); part != "" {
+			authors = append(authors, part)
+		}
+	}
+	return authors
+}
+
+var authorSeparators = regexp.MustCompile(`(?i)\s*(?:&|;|\band\b)\s*`)
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+)
+
+func testMARCRecords() []models.MARCRecord {
+	return []models.MARCRecord{
+		{
+			Leader: "00000cam a2200000 i 4500",
+			ControlFields: []models.MARCControlField{
+				{Tag: "001", Value: "ocm12345"},
+				{Tag: "008", Value: "850101s1965    nyu           000 1 eng d"},
+			},
+			DataFields: []models.MARCDataField{
+				{Tag: "020", Ind1: " ", Ind2: " ", Subfields: []models.MARCSubfield{{Code: "a", Value: "9780441172719"}}},
+				{Tag: "100", Ind1: "1", Ind2: " ", Subfields: []models.MARCSubfield{{Code: "a", Value: "Herbert, Frank,"}, {Code: "e", Value: "author."}}},
+				{Tag: "245", Ind1: "1", Ind2: "0", Subfields: []models.MARCSubfield{{Code: "a", Value: "Dune /"}, {Code: "c", Value: "Frank Herbert."}}},
+			},
+		},
+		{
+			Leader: "00000nam a2200000 i 4500",
+			DataFields: []models.MARCDataField{
+				{Tag: "245", Ind1: "0", Ind2: "0", Subfields: []models.MARCSubfield{{Code: "a", Value: "Les Misérables : <roman> & suite"}}},
+				{Tag: "650", Ind1: " ", Ind2: "0", Subfields: []models.MARCSubfield{{Code: "a", Value: "Révolutions"}, {Code: "z", Value: "France"}}},
+			},
+		},
+	}
+}
+
+func readAllMARC(t *testing.T, read func(io.Reader, func(models.MARCRecord, error) error) error, data []byte) []models.MARCRecord {
+	t.Helper()
+	var records []models.MARCRecord
+	err := read(bytes.NewReader(data), func(record models.MARCRecord, err error) error {
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func TestISO2709RoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	for _, record := range testMARCRecords() {
+		start := out.Len()
+		if err := WriteISO2709(&out, record); err != nil {
+			t.Fatal(err)
+		}
+		written := out.Bytes()[start:]
+		if length, _ := strconv.Atoi(string(written[:5])); length != len(written) {
+			t.Errorf("leader gives length %d, record is %d bytes", length, len(written))
+		}
+		// some tools put a line break between records
+		out.WriteString("\r\n")
+	}
+
+	got := readAllMARC(t, ReadISO2709, out.Bytes())
+	want := testMARCRecords()
+	for i := range want {
+		want[i].Leader = normalizeLeader(want[i].Leader)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		// the leader read back carries the computed length and base address
+		if got[i].Leader[5:12] != want[i].Leader[5:12] || got[i].Leader[17:] != want[i].Leader[17:] {
+			t.Errorf("record %d leader = %q, want %q", i, got[i].Leader, want[i].Leader)
+		}
+		got[i].Leader = want[i].Leader
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("record %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestReadISO2709Invalid(t *testing.T) {
+	var valid bytes.Buffer
+	if err := WriteISO2709(&valid, testMARCRecords()[0]); err != nil {
+		t.Fatal(err)
+	}
+	record := valid.Bytes()
+	tests := map[string][]byte{
+		"truncated":         record[:len(record)-10],
+		"bad length":        append([]byte("abcde"), record[5:]...),
+		"no terminator":     append(append([]byte{}, record[:len(record)-1]...), ' '),
+		"bad base address":  append(append(append([]byte{}, record[:12]...), "99999"...), record[17:]...),
+		"short length word": []byte("0001"),
+	}
+	for name, data := range tests {
+		err := ReadISO2709(bytes.NewReader(data), func(_ models.MARCRecord, err error) error { return err })
+		if !errors.Is(err, ErrInvalidMARC) {
+			t.Errorf("%s: err = %v, want ErrInvalidMARC", name, err)
+		}
+	}
+}
+
+func TestMARCXMLRoundTrip(t *testing.T) {
+	want := testMARCRecords()
+	for i := range want {
+		want[i].Leader = normalizeLeader(want[i].Leader)
+	}
+
+	var collection bytes.Buffer
+	collection.WriteString(MARCXMLHeader)
+	for _, record := range testMARCRecords() {
+		if err := WriteMARCXMLRecord(&collection, record, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collection.WriteString(MARCXMLFooter)
+
+	var single bytes.Buffer
+	if err := WriteMARCXMLRecord(&single, testMARCRecords()[1], true); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readAllMARC(t, ReadMARCXML, collection.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("collection read back as %+v, want %+v", got, want)
+	}
+	if got := readAllMARC(t, ReadMARCXML, single.Bytes()); !reflect.DeepEqual(got, want[1:]) {
+		t.Errorf("standalone record read back as %+v, want %+v", got, want[1:])
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+)
+
+const (
+	oauthStateAudience = "naan-oauth-state"
+	oauthStateTTL      = 10 * time.Minute
+)
+
+var ErrInvalidOAuthState = errors.New("invalid oauth state")
+
+// OAuthLogin is what the callback learns back from a verified state.
+type OAuthLogin struct {
+	RedirectTo string
+	Nonce      string
+}
+
+// StartOAuthLogin prepares the secrets for one login attempt. The returned
+// binding must be stored on the browser (cookie); it doubles as the PKCE
+// verifier. The state handed to the provider is signed and carries the
+// nonce, the return target and a hash of the binding, so a callback is only
+// accepted from the browser that started the login.
+func StartOAuthLogin(provider, redirectTo string) (string, url.Values, error) {
+	binding, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce, err := randomToken(16)
+	if err != nil {
+		return "", nil, err
+	}
+
+	state, err := SignToken(jwt.MapClaims{
+		"aud":      oauthStateAudience,
+		"exp":      time.Now().Add(oauthStateTTL).Unix(),
+		"provider": provider,
+		"redirect": redirectTo,
+		"nonce":    nonce,
+		"binding":  hashToken(binding),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	params := url.Values{}
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", pkceChallenge(binding))
+	params.Set("code_challenge_method", "S256")
+	return binding, params, nil
+}
+
+// FinishOAuthLogin verifies the state returned by the provider against the
+// binding from the browser. The returned values go along with the code
+// exchange.
+func FinishOAuthLogin(provider, state, binding string) (OAuthLogin, url.Values, error) {
+	if state == "" || binding == "" {
+		return OAuthLogin{}, nil, ErrInvalidOAuthState
+	}
+	token, err := jwt.Parse(state, VerificationKey,
+		jwt.WithValidMethods([]string{"RS256", "EdDSA"}),
+		jwt.WithAudience(oauthStateAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return OAuthLogin{}, nil, ErrInvalidOAuthState
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	bindingHash, _ := claims["binding"].(string)
+	if claims["provider"] != provider ||
+		subtle.ConstantTimeCompare([]byte(bindingHash), []byte(hashToken(binding))) != 1 {
+		return OAuthLogin{}, nil, ErrInvalidOAuthState
+	}
+
+	login := OAuthLogin{}
+	login.RedirectTo, _ = claims["redirect"].(string)
+	login.Nonce, _ = claims["nonce"].(string)
+
+	extra := url.Values{}
+	extra.Set("code_verifier", binding)
+	return login, extra, nil
+}
+
+// IsAllowedRedirect reports whether tokens may be handed to target. Entries
+// in AUTH_REDIRECT_ALLOWLIST are a scheme, host and path; the path allows
+// itself and anything below it. An entry without a host such as
+// "shelfie://" allows the whole scheme, which is how app deep links look.
+func IsAllowedRedirect(target string) bool {
+	parsed, err := url.Parse(target)
+	if err != nil || parsed.Scheme == "" || parsed.User != nil {
+		return false
+	}
+	defaults := config.Env("FRONTEND_AUTH_URL", "http://localhost:3000") + ",shelfie://"
+	for _, entry := range strings.Split(config.Env("AUTH_REDIRECT_ALLOWLIST", defaults), ",") {
+		allowed, err := url.Parse(strings.TrimSpace(entry))
+		if err != nil || allowed.Scheme == "" {
+			continue
+		}
+		if !strings.EqualFold(allowed.Scheme, parsed.Scheme) {
+			continue
+		}
+		if allowed.Host == "" {
+			return true
+		}
+		if strings.EqualFold(allowed.Host, parsed.Host) && underPath(parsed.Path, allowed.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// underPath reports whether path is base or below it, so "/app" covers
+// "/app/callback" but not "/appevil".
+func underPath(path, base string) bool {
+	base = strings.TrimSuffix(base, "/")
+	return path == base || strings.HasPrefix(path, base+"/")
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
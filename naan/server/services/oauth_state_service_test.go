@@ -0,0 +1,32 @@
+package services
+
+import "testing"
+
+func TestIsAllowedRedirect(t *testing.T) {
+	t.Setenv("AUTH_REDIRECT_ALLOWLIST", "https://library.example/app, shelfie://, http://localhost:3000")
+
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{"https://library.example/app", true},
+		{"https://library.example/app/", true},
+		{"https://library.example/app/callback?x=1", true},
+		{"https://library.example/appevil", false},
+		{"https://library.example/", false},
+		{"https://LIBRARY.example/app", true},
+		{"http://library.example/app", false},
+		{"https://evil.example/app", false},
+		{"https://user@library.example/app", false},
+		{"shelfie://auth", true},
+		{"http://localhost:3000/login", true},
+		{"http://localhost:3001/login", false},
+		{"/app", false},
+		{"::", false},
+	}
+	for _, tt := range tests {
+		if got := IsAllowedRedirect(tt.target); got != tt.want {
+			t.Errorf("IsAllowedRedirect(%q) = %v, want %v", tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,453 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+)
+
+const (
+	oidcDiscoveryTTL = time.Hour
+	oidcKeysTTL      = time.Hour
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown login provider")
+	ErrNonceMismatch   = errors.New("id token nonce does not match the login")
+)
+
+var oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type OIDCProvider struct {
+	Name         string   `json:"name"`
+	DisplayName  string   `json:"display_name"`
+	Issuer       string   `json:"-"`
+	ClientID     string   `json:"-"`
+	ClientSecret string   `json:"-"`
+	RedirectURL  string   `json:"-"`
+	Scopes       []string `json:"-"`
+
+	mu           sync.Mutex
+	discovery    *oidcDiscovery
+	discoveredAt time.Time
+	keys         map[string]crypto.PublicKey
+	keysAt       time.Time
+}
+
+// OIDCIdentity is what naan keeps from a validated ID token.
+type OIDCIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	Nonce         string
+}
+
+// LinkEmail is the email the identity may be matched to an existing account
+// by and stored under. Only an email the provider says it verified counts,
+// otherwise anyone could claim someone else's account.
+func (i OIDCIdentity) LinkEmail() string {
+	if !i.EmailVerified {
+		return ""
+	}
+	return i.Email
+}
+
+var oidcProviders = map[string]*OIDCProvider{}
+
+// LoadOIDCProviders reads the providers listed in OIDC_PROVIDERS. Each one is
+// configured with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and
+// optionally _REDIRECT_URL, _SCOPES and _DISPLAY_NAME. Google falls back to
+// the older GOOGLE_* variables.
+func LoadOIDCProviders() {
+	providers := map[string]*OIDCProvider{}
+	for _, name := range strings.Split(config.Env("OIDC_PROVIDERS", "google"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := &OIDCProvider{
+			Name:         name,
+			DisplayName:  config.Env(prefix+"DISPLAY_NAME", name),
+			Issuer:       strings.TrimSuffix(config.Env(prefix+"ISSUER", ""), "/"),
+			ClientID:     config.Env(prefix+"CLIENT_ID", ""),
+			ClientSecret: config.Env(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  config.Env(prefix+"REDIRECT_URL", config.Env("PUBLIC_URL", "http://localhost:8000")+"/auth/"+name),
+			Scopes:       strings.Fields(config.Env(prefix+"SCOPES", "openid email profile")),
+		}
+		if name == "google" {
+			if provider.Issuer == "" {
+				provider.Issuer = "https://accounts.google.com"
+			}
+			if provider.ClientID == "" {
+				provider.ClientID = config.Env("GOOGLE_CLIENT_ID", "")
+				provider.ClientSecret = config.Env("GOOGLE_CLIENT_SECRET", "")
+				provider.RedirectURL = config.Env("GOOGLE_REDIRECT_URL", provider.RedirectURL)
+			}
+			if provider.DisplayName == name {
+				provider.DisplayName = "Google"
+			}
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Printf("⚠️ skipping login provider %s: issuer and client id are required", name)
+			continue
+		}
+		providers[name] = provider
+	}
+	oidcProviders = providers
+}
+
+func GetOIDCProvider(name string) (*OIDCProvider, error) {
+	provider, ok := oidcProviders[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return provider, nil
+}
+
+func ListOIDCProviders() []*OIDCProvider {
+	providers := make([]*OIDCProvider, 0, len(oidcProviders))
+	for _, provider := range oidcProviders {
+		providers = append(providers, provider)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Name < providers[j].Name })
+	return providers
+}
+
+// AuthCodeURL builds the authorization request. extra carries per-login
+// parameters such as state.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, extra url.Values) (string, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("response_type", "code")
+	params.Set("scope", strings.Join(p.Scopes, " "))
+	for key, values := range extra {
+		params[key] = values
+	}
+	return discovery.AuthorizationEndpoint + "?" + params.Encode(), nil
+}
+
+// Exchange redeems the authorization code and validates the returned ID
+// token, which must carry the nonce the login was started with. Missing
+// profile claims are filled in from the userinfo endpoint.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, nonce string, extra url.Values) (OIDCIdentity, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+	for key, values := range extra {
+		form[key] = values
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokenRes struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}
+	if err := doJSON(oidcHTTPClient, req, &tokenRes); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("token exchange: %w", err)
+	}
+	if tokenRes.IDToken == "" {
+		return OIDCIdentity{}, errors.New("token exchange: no id_token in response")
+	}
+
+	identity, err := p.verifyIDToken(ctx, tokenRes.IDToken)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	if identity.Nonce == "" || identity.Nonce != nonce {
+		return OIDCIdentity{}, ErrNonceMismatch
+	}
+	if identity.Email == "" && discovery.UserinfoEndpoint != "" && tokenRes.AccessToken != "" {
+		if err := p.fillFromUserinfo(ctx, discovery.UserinfoEndpoint, tokenRes.AccessToken, &identity); err != nil {
+			return OIDCIdentity{}, fmt.Errorf("userinfo: %w", err)
+		}
+	}
+	return identity, nil
+}
+
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	Nonce         string `json:"nonce"`
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, raw string) (OIDCIdentity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if !p.issuerMatches(claims.Issuer) {
+		return OIDCIdentity{}, fmt.Errorf("invalid id token: unexpected issuer %q", claims.Issuer)
+	}
+	if claims.Subject == "" {
+		return OIDCIdentity{}, errors.New("invalid id token: missing sub")
+	}
+
+	return OIDCIdentity{
+		Provider:      p.Name,
+		Subject:       claims.Subject,
+		Email:         strings.ToLower(claims.Email),
+		EmailVerified: isTrue(claims.EmailVerified),
+		Name:          claims.Name,
+		Picture:       claims.Picture,
+		Nonce:         claims.Nonce,
+	}, nil
+}
+
+// Google is known to issue tokens with and without the scheme.
+func (p *OIDCProvider) issuerMatches(issuer string) bool {
+	if issuer == p.Issuer {
+		return true
+	}
+	return p.Issuer == "https://accounts.google.com" && issuer == "accounts.google.com"
+}
+
+func (p *OIDCProvider) fillFromUserinfo(ctx context.Context, endpoint, accessToken string, identity *OIDCIdentity) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	var userinfo struct {
+		Subject       string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"`
+		Name          string `json:"name"`
+		Picture       string `json:"picture"`
+	}
+	if err := doJSON(oidcHTTPClient, req, &userinfo); err != nil {
+		return err
+	}
+	// userinfo must describe the same subject as the ID token
+	if userinfo.Subject != identity.Subject {
+		return errors.New("subject mismatch")
+	}
+	identity.Email = strings.ToLower(userinfo.Email)
+	identity.EmailVerified = isTrue(userinfo.EmailVerified)
+	if identity.Name == "" {
+		identity.Name = userinfo.Name
+	}
+	if identity.Picture == "" {
+		identity.Picture = userinfo.Picture
+	}
+	return nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil && time.Since(p.discoveredAt) < oidcDiscoveryTTL {
+		return p.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	discovery := &oidcDiscovery{}
+	if err := doJSON(oidcHTTPClient, req, discovery); err != nil {
+		return nil, fmt.Errorf("discovery for %s: %w", p.Name, err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery for %s: issuer %q does not match %q", p.Name, discovery.Issuer, p.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery for %s: incomplete provider metadata", p.Name)
+	}
+	p.discovery = discovery
+	p.discoveredAt = time.Now()
+	return discovery, nil
+}
+
+// publicKey looks the kid up in the cached key set and refetches it once when
+// the kid is unknown, which is what happens right after the provider rotates.
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	discovery, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok && time.Since(p.keysAt) < oidcKeysTTL {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := doJSON(oidcHTTPClient, req, &set); err != nil {
+		return nil, fmt.Errorf("jwks for %s: %w", p.Name, err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parseJWK(jwk.Kty, jwk.Crv, jwk.N, jwk.E, jwk.X, jwk.Y)
+		if err != nil {
+			log.Printf("skipping jwk %s from %s: %v", jwk.Kid, p.Name, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	p.keys = keys
+	p.keysAt = time.Now()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("no key %q published by %s", kid, p.Name)
+	}
+	return key, nil
+}
+
+func parseJWK(kty, crv, n, e, x, y string) (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch kty {
+	case "RSA":
+		nBytes, err := decode(n)
+		if err != nil {
+			return nil, err
+		}
+		eBytes, err := decode(e)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: int(new(big.Int).SetBytes(eBytes).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", crv)
+		}
+		xBytes, err := decode(x)
+		if err != nil {
+			return nil, err
+		}
+		yBytes, err := decode(y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(xBytes), Y: new(big.Int).SetBytes(yBytes)}, nil
+	case "OKP":
+		if crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", crv)
+		}
+		xBytes, err := decode(x)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(xBytes), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", kty)
+}
+
+func doJSON(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d: %s", req.URL.Host, resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, out)
+}
+
+// some providers send email_verified as a string
+func isTrue(value any) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
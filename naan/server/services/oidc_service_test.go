@@ -0,0 +1,330 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubIDP is a local OpenID Connect provider. Every code it is handed is
+// answered with an ID token built from claims, signed with key under kid.
+type stubIDP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu          sync.Mutex
+	issuer      string
+	claims      func(issuer string) jwt.MapClaims
+	signWith    *rsa.PrivateKey
+	userinfo    map[string]any
+	verifier    string
+	discoveries int
+}
+
+func newStubIDP(t *testing.T) *stubIDP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &stubIDP{t: t, key: key, kid: "stub-1"}
+	idp.claims = idp.validClaims
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		idp.discoveries++
+		issuer := idp.issuer
+		idp.mu.Unlock()
+		writeJSON(w, map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"userinfo_endpoint":      idp.server.URL + "/userinfo",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": idp.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.Form.Get("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idp.mu.Lock()
+		idp.verifier = r.Form.Get("code_verifier")
+		claims := idp.claims(idp.server.URL)
+		signWith := idp.signWith
+		idp.mu.Unlock()
+		if signWith == nil {
+			signWith = idp.key
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = idp.kid
+		idToken, err := token.SignedString(signWith)
+		if err != nil {
+			t.Errorf("signing id token: %v", err)
+		}
+		writeJSON(w, map[string]string{"access_token": "stub-access", "id_token": idToken})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer stub-access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		writeJSON(w, idp.userinfo)
+	})
+	idp.server = httptest.NewServer(mux)
+	idp.issuer = idp.server.URL
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
+
+func (idp *stubIDP) validClaims(issuer string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            issuer,
+		"sub":            "user-1",
+		"aud":            "naan",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          "nonce-1",
+		"email":          "Patron@Example.com",
+		"email_verified": true,
+		"name":           "Stub Patron",
+	}
+}
+
+// with changes the claims of the next ID token.
+func (idp *stubIDP) with(change func(claims jwt.MapClaims)) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.claims = func(issuer string) jwt.MapClaims {
+		claims := idp.validClaims(issuer)
+		change(claims)
+		return claims
+	}
+}
+
+func (idp *stubIDP) provider() *OIDCProvider {
+	return &OIDCProvider{
+		Name:         "stub",
+		DisplayName:  "Stub",
+		Issuer:       idp.server.URL,
+		ClientID:     "naan",
+		ClientSecret: "secret",
+		RedirectURL:  "http://naan.test/auth/stub",
+		Scopes:       []string{"openid", "email"},
+	}
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	idp := newStubIDP(t)
+	provider := idp.provider()
+
+	extra := url.Values{}
+	extra.Set("state", "state-1")
+	authURL, err := provider.AuthCodeURL(t.Context(), extra)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed.Scheme + "://" + parsed.Host + parsed.Path; got != idp.server.URL+"/authorize" {
+		t.Errorf("authorization endpoint = %s", got)
+	}
+	query := parsed.Query()
+	for key, want := range map[string]string{
+		"client_id":     "naan",
+		"redirect_uri":  "http://naan.test/auth/stub",
+		"response_type": "code",
+		"scope":         "openid email",
+		"state":         "state-1",
+	} {
+		if got := query.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+
+	if _, err := provider.AuthCodeURL(t.Context(), nil); err != nil {
+		t.Fatalf("second AuthCodeURL: %v", err)
+	}
+	if idp.discoveries != 1 {
+		t.Errorf("discovery fetched %d times, want it cached after the first", idp.discoveries)
+	}
+}
+
+func TestOIDCDiscoveryRejectsOtherIssuer(t *testing.T) {
+	idp := newStubIDP(t)
+	idp.issuer = "https://impostor.example"
+	if _, err := idp.provider().AuthCodeURL(t.Context(), nil); err == nil {
+		t.Fatal("discovery with a foreign issuer was accepted")
+	}
+}
+
+func TestOIDCExchange(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		change  func(claims jwt.MapClaims)
+		forge   bool
+		code    string
+		nonce   string
+		wantErr bool
+	}{
+		{name: "valid", change: func(jwt.MapClaims) {}},
+		{name: "bad signature", change: func(jwt.MapClaims) {}, forge: true, wantErr: true},
+		{name: "wrong issuer", change: func(c jwt.MapClaims) { c["iss"] = "https://impostor.example" }, wantErr: true},
+		{name: "wrong audience", change: func(c jwt.MapClaims) { c["aud"] = "someone-else" }, wantErr: true},
+		{name: "audience list", change: func(c jwt.MapClaims) { c["aud"] = []string{"other", "naan"} }},
+		{name: "wrong nonce", change: func(jwt.MapClaims) {}, nonce: "nonce-2", wantErr: true},
+		{name: "missing nonce", change: func(c jwt.MapClaims) { delete(c, "nonce") }, nonce: "-", wantErr: true},
+		{name: "expired", change: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: true},
+		{name: "within leeway", change: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() }},
+		{name: "no expiry", change: func(c jwt.MapClaims) { delete(c, "exp") }, wantErr: true},
+		{name: "no subject", change: func(c jwt.MapClaims) { delete(c, "sub") }, wantErr: true},
+		{name: "bad code", change: func(jwt.MapClaims) {}, code: "bad-code", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newStubIDP(t)
+			idp.with(tt.change)
+			if tt.forge {
+				idp.signWith = otherKey
+			}
+			code, nonce := "good-code", "nonce-1"
+			if tt.code != "" {
+				code = tt.code
+			}
+			if tt.nonce == "-" {
+				nonce = ""
+			} else if tt.nonce != "" {
+				nonce = tt.nonce
+			}
+			extra := url.Values{}
+			extra.Set("code_verifier", "verifier-1")
+
+			identity, err := idp.provider().Exchange(t.Context(), code, nonce, extra)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("accepted id token, identity %+v", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if identity.Provider != "stub" || identity.Subject != "user-1" || identity.Email != "patron@example.com" {
+				t.Errorf("identity = %+v", identity)
+			}
+			if idp.verifier != "verifier-1" {
+				t.Errorf("code_verifier sent as %q", idp.verifier)
+			}
+		})
+	}
+}
+
+func TestOIDCLinkEmail(t *testing.T) {
+	tests := []struct {
+		name     string
+		claims   func(c jwt.MapClaims)
+		userinfo map[string]any
+		want     string
+		wantErr  bool
+	}{
+		{name: "verified", claims: func(jwt.MapClaims) {}, want: "patron@example.com"},
+		{name: "verified as string", claims: func(c jwt.MapClaims) { c["email_verified"] = "true" }, want: "patron@example.com"},
+		{name: "unverified", claims: func(c jwt.MapClaims) { c["email_verified"] = false }, want: ""},
+		{name: "unverified as string", claims: func(c jwt.MapClaims) { c["email_verified"] = "false" }, want: ""},
+		{name: "no claim", claims: func(c jwt.MapClaims) { delete(c, "email_verified") }, want: ""},
+		{
+			name: "verified by userinfo",
+			claims: func(c jwt.MapClaims) {
+				delete(c, "email")
+				delete(c, "email_verified")
+			},
+			userinfo: map[string]any{"sub": "user-1", "email": "Other@Example.com", "email_verified": true},
+			want:     "other@example.com",
+		},
+		{
+			name: "unverified by userinfo",
+			claims: func(c jwt.MapClaims) {
+				delete(c, "email")
+				delete(c, "email_verified")
+			},
+			userinfo: map[string]any{"sub": "user-1", "email": "other@example.com"},
+			want:     "",
+		},
+		{
+			name: "userinfo for another subject",
+			claims: func(c jwt.MapClaims) {
+				delete(c, "email")
+			},
+			userinfo: map[string]any{"sub": "user-2", "email": "victim@example.com", "email_verified": true},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newStubIDP(t)
+			idp.with(tt.claims)
+			idp.userinfo = tt.userinfo
+
+			identity, err := idp.provider().Exchange(t.Context(), "good-code", "nonce-1", nil)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("accepted identity %+v", identity)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange: %v", err)
+			}
+			if got := identity.LinkEmail(); got != tt.want {
+				t.Errorf("LinkEmail() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPKCEChallenge(t *testing.T) {
+	sum := sha256.Sum256([]byte("verifier"))
+	want := strings.TrimRight(base64.URLEncoding.EncodeToString(sum[:]), "=")
+	if got := pkceChallenge("verifier"); got != want {
+		t.Errorf("pkceChallenge = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+)
+
+const (
+	OPDSPageSize        = 25
+	OPDSNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	OPDSAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	OPDSEntryType       = "application/atom+xml;type=entry;profile=opds-catalog"
+	OpenSearchType      = "application/opensearchdescription+xml"
+)
+
+// OPDSFeed is an OPDS 1.2 catalog feed. Prefixed names are written as is,
+// which is how encoding/xml can emit namespaced elements.
+type OPDSFeed struct {
+	XMLName         xml.Name    `xml:"feed"`
+	Xmlns           string      `xml:"xmlns,attr"`
+	XmlnsDC         string      `xml:"xmlns:dc,attr"`
+	XmlnsOpenSearch string      `xml:"xmlns:opensearch,attr"`
+	XmlnsOPDS       string      `xml:"xmlns:opds,attr"`
+	XmlnsThr        string      `xml:"xmlns:thr,attr"`
+	ID              string      `xml:"id"`
+	Title           string      `xml:"title"`
+	Updated         string      `xml:"updated"`
+	Author          OPDSPerson  `xml:"author"`
+	Links           []OPDSLink  `xml:"link"`
+	TotalResults    *int64      `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage    *int64      `xml:"opensearch:itemsPerPage,omitempty"`
+	StartIndex      *int64      `xml:"opensearch:startIndex,omitempty"`
+	Entries         []OPDSEntry `xml:"entry"`
+}
+
+type OPDSPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type OPDSLink struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Count int64  `xml:"thr:count,attr,omitempty"`
+}
+
+type OPDSCategory struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type OPDSContent struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type OPDSEntry struct {
+	XMLName      xml.Name       `xml:"entry"`
+	Xmlns        string         `xml:"xmlns,attr,omitempty"`
+	XmlnsDC      string         `xml:"xmlns:dc,attr,omitempty"`
+	Title        string         `xml:"title"`
+	ID           string         `xml:"id"`
+	Updated      string         `xml:"updated"`
+	Authors      []OPDSPerson   `xml:"author"`
+	Contributors []OPDSPerson   `xml:"contributor"`
+	Identifier   string         `xml:"dc:identifier,omitempty"`
+	Publisher    string         `xml:"dc:publisher,omitempty"`
+	Issued       string         `xml:"dc:issued,omitempty"`
+	Categories   []OPDSCategory `xml:"category"`
+	Content      *OPDSContent   `xml:"content,omitempty"`
+	Links        []OPDSLink     `xml:"link"`
+}
+
+// OPDSLinker turns a catalog path into the absolute URL a feed links to.
+type OPDSLinker func(path string) string
+
+// NewOPDSFeed starts a feed with its self, start and search links.
+func NewOPDSFeed(link OPDSLinker, id, title, self, kind string) OPDSFeed {
+	return OPDSFeed{
+		Xmlns:           "http://www.w3.org/2005/Atom",
+		XmlnsDC:         "http://purl.org/dc/terms/",
+		XmlnsOpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		XmlnsOPDS:       "http://opds-spec.org/2010/catalog",
+		XmlnsThr:        "http://purl.org/syndication/thread/1.0",
+		ID:              "urn:naan:opds:" + id,
+		Title:           title,
+		Updated:         time.Now().UTC().Format(time.RFC3339),
+		Author:          OPDSPerson{Name: "naan", URI: link("/opds")},
+		Links: []OPDSLink{
+			{Rel: "self", Href: link(self), Type: kind},
+			{Rel: "start", Href: link("/opds"), Type: OPDSNavigationType},
+			{Rel: "search", Href: link("/opds/opensearch.xml"), Type: OpenSearchType},
+		},
+	}
+}
+
+// Paginate adds the OpenSearch counts and first, previous and next links.
+// path may already carry a query string.
+func (f *OPDSFeed) Paginate(link OPDSLinker, path, kind string, page, total int64) {
+	perPage := int64(OPDSPageSize)
+	start := (page-1)*perPage + 1
+	f.TotalResults, f.ItemsPerPage, f.StartIndex = &total, &perPage, &start
+
+	pageLink := func(rel string, n int64) OPDSLink {
+		separator := "?"
+		if strings.Contains(path, "?") {
+			separator = "&"
+		}
+		return OPDSLink{Rel: rel, Href: link(path + separator + "page=" + strconv.FormatInt(n, 10)), Type: kind}
+	}
+	f.Links = append(f.Links, pageLink("first", 1))
+	if page > 1 {
+		f.Links = append(f.Links, pageLink("previous", page-1))
+	}
+	if page*perPage < total {
+		f.Links = append(f.Links, pageLink("next", page+1))
+	}
+}
+
+// NavigationEntry links to another feed of the given kind.
+func NavigationEntry(link OPDSLinker, id, title, path, kind, summary string, count int64) OPDSEntry {
+	entry := OPDSEntry{
+		Title:   title,
+		ID:      "urn:naan:opds:" + id,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+		Links:   []OPDSLink{{Rel: "subsection", Href: link(path), Type: kind, Count: count}},
+	}
+	if summary != "" {
+		entry.Content = &OPDSContent{Type: "text", Text: summary}
+	}
+	return entry
+}
+
+// BookEntry describes a physical book. Since copies are borrowed at the
+// desk, the borrow link leads to the book's full entry, which says where it
+// is shelved and whether it is on loan.
+func BookEntry(link OPDSLinker, book ExportedBook) OPDSEntry {
+	record := NewExportRecord(book)
+	entry := OPDSEntry{
+		Title:     book.Title,
+		ID:        "urn:naan:book:" + record.ID,
+		Updated:   book.AddedAt.UTC().Format(time.RFC3339),
+		Publisher: book.Publisher,
+	}
+	for _, author := range BookAuthors(book.Book) {
+		entry.Authors = append(entry.Authors, OPDSPerson{
+			Name: author,
+			URI:  link("/opds/authors/" + url.PathEscape(author)),
+		})
+	}
+	for _, contributor := range book.Contributors {
+		if contributor.Role != models.RoleAuthor {
+			entry.Contributors = append(entry.Contributors, OPDSPerson{Name: contributor.Name})
+		}
+	}
+	if book.ISBN != "" {
+		entry.Identifier = "urn:isbn:" + book.ISBN
+	}
+	if book.PublishedYear > 0 {
+		entry.Issued = strconv.Itoa(book.PublishedYear)
+	}
+	if book.Genre != "" {
+		entry.Categories = append(entry.Categories, OPDSCategory{Term: book.Genre, Label: book.Genre})
+	}
+	for _, subject := range book.Subjects {
+		if subject != book.Genre {
+			entry.Categories = append(entry.Categories, OPDSCategory{Term: subject, Label: subject})
+		}
+	}
+
+	availability := "Available"
+	if record.Availability == AvailabilityOnLoan {
+		availability = "On loan"
+	}
+	entry.Content = &OPDSContent{Type: "text", Text: fmt.Sprintf("%s. Shelf %s, row %d, column %d.",
+		availability, book.ShelfAddress, book.Row, book.Column)}
+
+	self := link("/opds/books/" + record.ID)
+	entry.Links = append(entry.Links,
+		OPDSLink{Rel: "alternate", Href: self, Type: OPDSEntryType},
+		OPDSLink{Rel: "http://opds-spec.org/acquisition/borrow", Href: self, Type: OPDSEntryType},
+	)
+	if book.Cover != nil {
+		entry.Links = append(entry.Links,
+			OPDSLink{Rel: "http://opds-spec.org/image", Href: link(CoverPath(book.ID, book.Cover, "large")), Type: "image/jpeg"},
+			OPDSLink{Rel: "http://opds-spec.org/image/thumbnail", Href: link(CoverPath(book.ID, book.Cover, "small")), Type: "image/jpeg"},
+		)
+	} else if book.CoverURL != "" {
+		entry.Links = append(entry.Links,
+			OPDSLink{Rel: "http://opds-spec.org/image", Href: book.CoverURL, Type: "image/jpeg"},
+			OPDSLink{Rel: "http://opds-spec.org/image/thumbnail", Href: book.CoverURL, Type: "image/jpeg"},
+		)
+	}
+	return entry
+}
+
+// OpenSearchDescription points OPDS clients at the search feed.
+func OpenSearchDescription(link OPDSLinker) []byte {
+	type urlTemplate struct {
+		Type     string `xml:"type,attr"`
+		Template string `xml:"template,attr"`
+	}
+	description := struct {
+		XMLName       xml.Name    `xml:"OpenSearchDescription"`
+		Xmlns         string      `xml:"xmlns,attr"`
+		ShortName     string      `xml:"ShortName"`
+		Description   string      `xml:"Description"`
+		InputEncoding string      `xml:"InputEncoding"`
+		URL           urlTemplate `xml:"Url"`
+	}{
+		Xmlns:         "http://a9.com/-/spec/opensearch/1.1/",
+		ShortName:     "naan",
+		Description:   "Search the library catalog",
+		InputEncoding: "UTF-8",
+		URL:           urlTemplate{Type: OPDSAcquisitionType, Template: link("/opds/search?q={searchTerms}&page={startPage?}")},
+	}
+	out, _ := xml.MarshalIndent(description, "", "  ")
+	return append([]byte(xml.Header), out...)
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortValueField is where ValueStage copies the value a book is sorted by.
+const SortValueField = "sort_value"
+
+// BookSort is a stable ordering of books; ties on Field are broken by _id in
+// the same direction. Every book has each Field (see BackfillSortFields):
+// a book without it would sort as null, and no cursor could page past it.
+type BookSort struct {
+	Key   string
+	Field string
+	Desc  bool
+}
+
+var BookSorts = map[string]BookSort{
+	"title":    {Key: "title", Field: "title_key"},
+	"author":   {Key: "author", Field: "author_key"},
+	"added_at": {Key: "added_at", Field: "added_at", Desc: true},
+	// reading order, meant for listings filtered to one series
+	"series_number": {Key: "series_number", Field: "series_number"},
+	"call_number":   {Key: "call_number", Field: "call_number_key"},
+	"popularity":    {Key: "popularity", Field: "loan_count", Desc: true},
+	"relevance":     {Key: "relevance", Field: "score", Desc: true},
+}
+
+// SortKey folds a title or author line into the key it sorts by, so case
+// and accents don't decide the order: "apple" comes before "Zebra".
+func SortKey(text string) string {
+	return FoldText(text)
+}
+
+// ResolveBookSort picks the requested sort. Relevance only exists for text
+// searches and is the default for them, everything else defaults to title.
+func ResolveBookSort(key string, ranked bool) (BookSort, error) {
+	if key == "" {
+		key = "title"
+		if ranked {
+			key = "relevance"
+		}
+	}
+	sort, ok := BookSorts[key]
+	if !ok {
+		return BookSort{}, errors.New("unknown sort " + key)
+	}
+	if sort.Key == "relevance" && !ranked {
+		sort = BookSorts["title"]
+	}
+	return sort, nil
+}
+
+func (s BookSort) direction() int {
+	if s.Desc {
+		return -1
+	}
+	return 1
+}
+
+// Stage sorts on the stored fields, so the sort and After can both use the
+// field's index.
+func (s BookSort) Stage() bson.D {
+	return bson.D{{Key: "$sort", Value: bson.D{
+		{Key: s.Field, Value: s.direction()},
+		{Key: "_id", Value: s.direction()},
+	}}}
+}
+
+// ValueStage copies Field to SortValueField for the next page's cursor. It
+// belongs after $limit, so it only touches the books on the page.
+func (s BookSort) ValueStage() bson.D {
+	return bson.D{{Key: "$addFields", Value: bson.D{{Key: SortValueField, Value: "$" + s.Field}}}}
+}
+
+// After matches the books that come after the cursor in this order.
+func (s BookSort) After(cursor PageCursor) bson.M {
+	op := "$gt"
+	if s.Desc {
+		op = "$lt"
+	}
+	return bson.M{"$or": bson.A{
+		bson.M{s.Field: bson.M{op: cursor.Value}},
+		bson.M{s.Field: cursor.Value, "_id": bson.M{op: cursor.ID}},
+	}}
+}
+
+// PageCursor points just past the last book of a page. It is handed to
+// clients as an opaque string; BSON keeps the type of the sort value intact.
+type PageCursor struct {
+	Sort  string        `bson:"s"`
+	Value any           `bson:"v"`
+	ID    bson.ObjectID `bson:"id"`
+}
+
+func EncodeCursor(cursor PageCursor) (string, error) {
+	raw, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// DecodeCursor parses a cursor and checks it was made for this sort.
+func DecodeCursor(encoded string, sort BookSort) (PageCursor, error) {
+	var cursor PageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := bson.Unmarshal(raw, &cursor); err != nil || cursor.Sort != sort.Key || cursor.ID.IsZero() {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// FindBooksPage returns one numbered page of a search with shelf addresses,
+// and how many books the search matches in total.
+func FindBooksPage(ctx context.Context, plan SearchPlan, sort BookSort, skip, limit int64) ([]ExportedBook, int64, error) {
+	collection := config.GetBookCollection()
+	total, err := collection.CountDocuments(ctx, plan.Filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: plan.Filter}}}
+	if plan.Ranked {
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: "score", Value: bson.D{{Key: "$meta", Value: "textScore"}}},
+		}}})
+	}
+	pipeline = append(pipeline,
+		sort.Stage(),
+		bson.D{{Key: "$skip", Value: skip}},
+		bson.D{{Key: "$limit", Value: limit}},
+	)
+	pipeline = append(pipeline, ShelfAddressStages()...)
+
+	cursor, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, 0, err
+	}
+	books := []ExportedBook{}
+	err = cursor.All(ctx, &books)
+	return books, total, err
+}
+
+// sortFieldDefaults are what books written before a sort field existed get
+// for it. added_at is taken from when the book's _id was made.
+var sortFieldDefaults = bson.D{
+	{Key: "added_at", Value: bson.M{"$toDate": "$_id"}},
+	{Key: "loan_count", Value: 0},
+	{Key: "series_number", Value: 0},
+	{Key: "call_number_key", Value: ""},
+}
+
+type SortFieldReport struct {
+	Keyed  int64            `json:"keyed"`
+	Filled map[string]int64 `json:"filled"`
+}
+
+// BackfillSortFields gives every book the fields BookSorts sort on: the
+// title and author keys, and sortFieldDefaults for the rest. Books are only
+// counted unless apply is set.
+func BackfillSortFields(ctx context.Context, apply bool) (SortFieldReport, error) {
+	report := SortFieldReport{Filled: map[string]int64{}}
+	collection := config.GetBookCollection()
+	for _, field := range sortFieldDefaults {
+		// nil matches both a missing field and a stored null
+		filter := bson.M{field.Key: nil}
+		if !apply {
+			count, err := collection.CountDocuments(ctx, filter)
+			if err != nil {
+				return report, err
+			}
+			report.Filled[field.Key] = count
+			continue
+		}
+		result, err := collection.UpdateMany(ctx, filter, mongo.Pipeline{
+			{{Key: "$set", Value: bson.D{{Key: field.Key, Value: field.Value}}}},
+		})
+		if err != nil {
+			return report, err
+		}
+		report.Filled[field.Key] = result.ModifiedCount
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"$or": bson.A{bson.M{"title_key": nil}, bson.M{"author_key": nil}}},
+		options.Find().SetProjection(bson.M{"title": 1, "author": 1}))
+	if err != nil {
+		return report, err
+	}
+	defer cursor.Close(ctx)
+	var writes []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var book models.Book
+		if err := cursor.Decode(&book); err != nil {
+			return report, err
+		}
+		report.Keyed++
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": book.ID}).
+			SetUpdate(bson.M{"$set": bson.M{"title_key": SortKey(book.Title), "author_key": SortKey(book.Author)}}))
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+	if apply && len(writes) > 0 {
+		if _, err := collection.BulkWrite(ctx, writes); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// bsonBracket orders values of different types the way MongoDB sorts them.
+// Range operators only match values in the same bracket as their operand.
+func bsonBracket(value any) int {
+	switch value.(type) {
+	case nil:
+		return 0
+	case int, int32, int64, float64:
+		return 1
+	case string:
+		return 2
+	case bson.ObjectID:
+		return 3
+	case time.Time, bson.DateTime:
+		return 4
+	}
+	panic(fmt.Sprintf("no bracket for %T", value))
+}
+
+func compareBSON(a, b any) int {
+	if ba, bb := bsonBracket(a), bsonBracket(b); ba != bb {
+		return ba - bb
+	}
+	switch a := a.(type) {
+	case nil:
+		return 0
+	case string:
+		return strings.Compare(a, b.(string))
+	case bson.ObjectID:
+		return strings.Compare(a.Hex(), b.(bson.ObjectID).Hex())
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case bson.DateTime:
+		return a.Time().Compare(b.(bson.DateTime).Time())
+	}
+	x, y := toFloat(a), toFloat(b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(value any) float64 {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return value.(float64)
+}
+
+// matchesFilter evaluates the subset of the query language After produces.
+func matchesFilter(t *testing.T, doc bson.M, filter bson.M) bool {
+	t.Helper()
+	for key, cond := range filter {
+		if key == "$or" {
+			matched := false
+			for _, clause := range cond.(bson.A) {
+				matched = matched || matchesFilter(t, doc, clause.(bson.M))
+			}
+			if !matched {
+				return false
+			}
+			continue
+		}
+		value := doc[key]
+		ops, ok := cond.(bson.M)
+		if !ok {
+			if bsonBracket(value) != bsonBracket(cond) || compareBSON(value, cond) != 0 {
+				return false
+			}
+			continue
+		}
+		for op, operand := range ops {
+			if bsonBracket(value) != bsonBracket(operand) {
+				return false
+			}
+			c := compareBSON(value, operand)
+			if (op == "$gt" && c <= 0) || (op == "$lt" && c >= 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// pageAll lists books the way GetAllBooks does, limit at a time, following
+// the encoded cursor of each page, and returns the names in order.
+func pageAll(t *testing.T, sort BookSort, books []bson.M, limit int) []string {
+	t.Helper()
+	keyed := make([]bson.M, 0, len(books))
+	for _, book := range books {
+		doc := bson.M{}
+		for k, v := range book {
+			doc[k] = v
+		}
+		doc[SortValueField] = doc[sort.Field]
+		// what comes back from the database is what the cursor is made of
+		raw, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := bson.M{}
+		if err := bson.Unmarshal(raw, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		keyed = append(keyed, decoded)
+	}
+	slices.SortFunc(keyed, func(a, b bson.M) int {
+		c := compareBSON(a[sort.Field], b[sort.Field])
+		if c == 0 {
+			c = compareBSON(a["_id"], b["_id"])
+		}
+		if sort.Desc {
+			return -c
+		}
+		return c
+	})
+
+	var titles []string
+	var after *PageCursor
+	for pages := 0; pages <= len(books); pages++ {
+		var page []bson.M
+		for _, doc := range keyed {
+			if after != nil && !matchesFilter(t, doc, sort.After(*after)) {
+				continue
+			}
+			page = append(page, doc)
+			if len(page) == limit+1 {
+				break
+			}
+		}
+		hasMore := len(page) > limit
+		if hasMore {
+			page = page[:limit]
+		}
+		for _, doc := range page {
+			titles = append(titles, doc["name"].(string))
+		}
+		if !hasMore {
+			return titles
+		}
+		last := page[len(page)-1]
+		encoded, err := EncodeCursor(PageCursor{Sort: sort.Key, Value: last[SortValueField], ID: last["_id"].(bson.ObjectID)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := DecodeCursor(encoded, sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after = &decoded
+	}
+	t.Fatal("paging did not end")
+	return nil
+}
+
+func TestCursorPaging(t *testing.T) {
+	id := func(n byte) bson.ObjectID { return bson.ObjectID{11: n} }
+	added := func(day int) time.Time { return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC) }
+	book := func(n byte, name, title string, seriesNumber any, callNumberKey string, day int) bson.M {
+		return bson.M{"_id": id(n), "name": name, "title_key": SortKey(title), "series_number": seriesNumber,
+			"call_number_key": callNumberKey, "added_at": added(day), "loan_count": int64(n % 3)}
+	}
+	books := []bson.M{
+		book(1, "a", "Dune", 1, "0500", 1),
+		book(2, "b", "emma", 0, "", 2),
+		book(3, "c", "Aria", 2.5, "0100", 4),
+		book(4, "d", "", 3, "", 3),
+		book(5, "e", "Béloved", 0, "0300", 1),
+		book(6, "f", "carrie", 0, "", 5),
+		book(7, "g", "aria", 1, "0100", 4),
+		book(8, "h", "Zebra", 0, "", 6),
+	}
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		{"title", []string{"d", "c", "g", "e", "f", "a", "b", "h"}},
+		{"series_number", []string{"b", "e", "f", "h", "a", "g", "c", "d"}},
+		{"call_number", []string{"b", "d", "f", "h", "c", "g", "e", "a"}},
+		{"added_at", []string{"h", "f", "g", "c", "d", "b", "e", "a"}},
+		{"popularity", []string{"h", "e", "b", "g", "d", "a", "f", "c"}},
+	}
+	for _, tt := range tests {
+		for _, limit := range []int{1, 2, 3, 10} {
+			t.Run(fmt.Sprintf("%s by %d", tt.sort, limit), func(t *testing.T) {
+				got := pageAll(t, BookSorts[tt.sort], books, limit)
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("paged %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+
+	// a book without the field sorts as null, which no cursor gets past
+	missing := append(slices.Clone(books), bson.M{"_id": id(9), "name": "i"})
+	if got := pageAll(t, BookSorts["title"], missing, 1); len(got) == len(missing) {
+		t.Errorf("paging past a book without a title key should have lost books, got %v", got)
+	}
+}
+
+func TestSortKey(t *testing.T) {
+	titles := []string{"", "apple", "Apple Pie", "Éclair", "eclairs", "The Hobbit", "zebra", "Zoo"}
+	for i := 1; i < len(titles); i++ {
+		if a, b := SortKey(titles[i-1]), SortKey(titles[i]); a >= b {
+			t.Errorf("SortKey(%q) = %q should sort before SortKey(%q) = %q", titles[i-1], a, titles[i], b)
+		}
+	}
+}
+
+func TestBookSortUsesStoredField(t *testing.T) {
+	for key, sort := range BookSorts {
+		stage := sort.Stage()[0].Value.(bson.D)
+		if stage[0].Key != sort.Field || stage[1].Key != "_id" {
+			t.Errorf("%s sorts on %v, want %s then _id", key, stage, sort.Field)
+		}
+		after := sort.After(PageCursor{Value: "x", ID: bson.NewObjectID()})["$or"].(bson.A)
+		if _, ok := after[0].(bson.M)[sort.Field]; !ok {
+			t.Errorf("%s cursor matches %v, want %s", key, after, sort.Field)
+		}
+	}
+}
+
+func TestDecodeCursor(t *testing.T) {
+	title := BookSorts["title"]
+	encoded, err := EncodeCursor(PageCursor{Sort: "title", Value: "Dune", ID: bson.NewObjectID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeCursor(encoded, title); err != nil {
+		t.Errorf("DecodeCursor of its own cursor: %v", err)
+	}
+	for name, bad := range map[string]string{
+		"other sort": encoded,
+		"not base64": "!!!",
+		"not bson":   "aGVsbG8",
+		"empty":      "",
+	} {
+		sort := title
+		if name == "other sort" {
+			sort = BookSorts["author"]
+		}
+		if _, err := DecodeCursor(bad, sort); err != ErrInvalidCursor {
+			t.Errorf("%s: err = %v, want ErrInvalidCursor", name, err)
+		}
+	}
+	noID, _ := EncodeCursor(PageCursor{Sort: "title", Value: "Dune"})
+	if _, err := DecodeCursor(noID, title); err != ErrInvalidCursor {
+		t.Errorf("cursor without id: err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestResolveBookSort(t *testing.T) {
+	tests := []struct {
+		key     string
+		ranked  bool
+		want    string
+		wantErr bool
+	}{
+		{"", false, "title", false},
+		{"", true, "relevance", false},
+		{"relevance", false, "title", false},
+		{"call_number", false, "call_number", false},
+		{"shoe_size", false, "", true},
+	}
+	for _, tt := range tests {
+		sort, err := ResolveBookSort(tt.key, tt.ranked)
+		if (err != nil) != tt.wantErr || sort.Key != tt.want {
+			t.Errorf("ResolveBookSort(%q, %v) = %q, %v", tt.key, tt.ranked, sort.Key, err)
+		}
+	}
+}
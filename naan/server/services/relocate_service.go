@@ -0,0 +1,246 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Why a book moved, recorded with each book_moved audit entry.
+const (
+	MoveRelocate     = "relocate"
+	MoveShelfDeleted = "shelf_deleted"
+	MoveUpdate       = "update"
+)
+
+var (
+	ErrShelfNotEmpty  = errors.New("shelf still has books, give a shelf to move them to")
+	ErrRelocateSame   = errors.New("books are already on this shelf")
+	ErrRelocateBooks  = errors.New("some books are not on the source shelf")
+	ErrShelfFull      = errors.New("not enough free slots on the target shelf")
+	ErrRelocateRacing = errors.New("a target slot was filled meanwhile, try again")
+)
+
+// BookMove is one book going from one slot to another.
+type BookMove struct {
+	BookID     bson.ObjectID `json:"book_id"`
+	Title      string        `json:"title"`
+	FromShelf  bson.ObjectID `json:"from_shelf_id"`
+	FromRow    int           `json:"from_row"`
+	FromColumn int           `json:"from_column"`
+	ToShelf    bson.ObjectID `json:"to_shelf_id"`
+	ToRow      int           `json:"to_row"`
+	ToColumn   int           `json:"to_column"`
+}
+
+// AuditDetails describes the move for its book_moved audit entry.
+func (m BookMove) AuditDetails(reason string) bson.M {
+	return bson.M{
+		"book_id":       m.BookID.Hex(),
+		"reason":        reason,
+		"from_shelf_id": m.FromShelf.Hex(),
+		"from_row":      m.FromRow,
+		"from_column":   m.FromColumn,
+		"to_shelf_id":   m.ToShelf.Hex(),
+		"to_row":        m.ToRow,
+		"to_column":     m.ToColumn,
+	}
+}
+
+// MovesAuditDetails is AuditDetails for each of moves.
+func MovesAuditDetails(moves []BookMove, reason string) []bson.M {
+	details := make([]bson.M, 0, len(moves))
+	for _, move := range moves {
+		details = append(details, move.AuditDetails(reason))
+	}
+	return details
+}
+
+type gridSlot struct {
+	row, column int
+}
+
+// assignSlots picks a target slot for each book. A book keeps its row and
+// column when that slot is free on the target; the rest fill the free slots
+// row by row in the order given. Shelves without declared dimensions grow
+// downwards, as wide as the widest row already in use.
+func assignSlots(target models.Shelf, occupied map[gridSlot]bool, books []ShelvedBook) ([]gridSlot, error) {
+	rows, columns := target.Rows, target.Columns
+	if columns == 0 {
+		columns = 1
+		for slot := range occupied {
+			columns = max(columns, slot.column)
+		}
+		for _, book := range books {
+			columns = max(columns, book.Column)
+		}
+	}
+	inGrid := func(slot gridSlot) bool {
+		return slot.row >= 1 && slot.column >= 1 && slot.column <= columns && (rows == 0 || slot.row <= rows)
+	}
+
+	taken := make(map[gridSlot]bool, len(occupied)+len(books))
+	for slot := range occupied {
+		taken[slot] = true
+	}
+	slots := make([]gridSlot, len(books))
+	for i, book := range books {
+		slot := gridSlot{book.Row, book.Column}
+		if inGrid(slot) && !taken[slot] {
+			slots[i] = slot
+			taken[slot] = true
+		}
+	}
+	next := gridSlot{1, 1}
+	for i := range books {
+		if slots[i] != (gridSlot{}) {
+			continue
+		}
+		for taken[next] {
+			if next.column++; next.column > columns {
+				next = gridSlot{next.row + 1, 1}
+			}
+		}
+		if !inGrid(next) {
+			return nil, ErrShelfFull
+		}
+		slots[i] = next
+		taken[next] = true
+	}
+	return slots, nil
+}
+
+// PlanRelocation works out where the books move to without moving them.
+// bookIDs picks books from the source shelf; nil moves all of them.
+func PlanRelocation(ctx context.Context, fromID, toID bson.ObjectID, bookIDs []bson.ObjectID) ([]BookMove, error) {
+	if fromID == toID {
+		return nil, ErrRelocateSame
+	}
+	if _, err := GetShelf(ctx, fromID); err != nil {
+		return nil, err
+	}
+	target, err := GetShelf(ctx, toID)
+	if err != nil {
+		return nil, err
+	}
+
+	books, err := shelvedBooks(ctx, fromID)
+	if err != nil {
+		return nil, err
+	}
+	if bookIDs != nil {
+		picked := books[:0]
+		for _, book := range books {
+			if containsID(bookIDs, book.ID) {
+				picked = append(picked, book)
+			}
+		}
+		books = picked
+		if len(books) != len(bookIDs) {
+			return nil, ErrRelocateBooks
+		}
+	}
+	sortShelfOrder(books)
+
+	onTarget, err := shelvedBooks(ctx, toID)
+	if err != nil {
+		return nil, err
+	}
+	occupied := make(map[gridSlot]bool, len(onTarget))
+	for _, book := range onTarget {
+		occupied[gridSlot{book.Row, book.Column}] = true
+	}
+	slots, err := assignSlots(target, occupied, books)
+	if err != nil {
+		return nil, err
+	}
+
+	moves := make([]BookMove, 0, len(books))
+	for i, book := range books {
+		moves = append(moves, BookMove{
+			BookID:     book.ID,
+			Title:      book.Title,
+			FromShelf:  fromID,
+			FromRow:    book.Row,
+			FromColumn: book.Column,
+			ToShelf:    toID,
+			ToRow:      slots[i].row,
+			ToColumn:   slots[i].column,
+		})
+	}
+	return moves, nil
+}
+
+// RelocateBooks moves books between shelves as PlanRelocation assigns them.
+// The target slots are checked again just before writing. Like the other
+// book writes this takes no lock, so a book shelved in the moment between
+// the check and the write can still share a slot; the shelf map lists
+// those as conflicts.
+//
+// Books moved off or deleted from the source shelf in the meantime are
+// skipped, so the moves returned are only the ones written. When a write
+// fails the moves made before it are returned with the error.
+func RelocateBooks(ctx context.Context, fromID, toID bson.ObjectID, bookIDs []bson.ObjectID) ([]BookMove, error) {
+	moves, err := PlanRelocation(ctx, fromID, toID, bookIDs)
+	if err != nil || len(moves) == 0 {
+		return moves, err
+	}
+
+	targets := make(bson.A, 0, len(moves))
+	for _, move := range moves {
+		targets = append(targets, bson.M{"row": move.ToRow, "column": move.ToColumn})
+	}
+	collisions, err := config.GetBookCollection().CountDocuments(ctx, bson.M{"shelf_id": toID, "$or": targets},
+		options.Count().SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	if collisions > 0 {
+		return nil, ErrRelocateRacing
+	}
+
+	// one update per book, as a bulk write only reports how many matched
+	moved := make([]BookMove, 0, len(moves))
+	for _, move := range moves {
+		result, err := config.GetBookCollection().UpdateOne(ctx,
+			bson.M{"_id": move.BookID, "shelf_id": fromID},
+			bson.M{"$set": bson.M{"shelf_id": toID, "row": move.ToRow, "column": move.ToColumn}})
+		if err != nil {
+			return moved, err
+		}
+		if result.MatchedCount > 0 {
+			moved = append(moved, move)
+		}
+	}
+	return moved, nil
+}
+
+// DeleteShelf removes a shelf. A shelf with books is only removed when
+// targetID names a shelf to move them to first.
+func DeleteShelf(ctx context.Context, shelfID bson.ObjectID, targetID *bson.ObjectID) ([]BookMove, error) {
+	if _, err := GetShelf(ctx, shelfID); err != nil {
+		return nil, err
+	}
+	var moves []BookMove
+	if targetID != nil {
+		var err error
+		if moves, err = RelocateBooks(ctx, shelfID, *targetID, nil); err != nil {
+			return moves, err
+		}
+	}
+	// also catches books placed on the shelf while the others were moving
+	remaining, err := config.GetBookCollection().CountDocuments(ctx, bson.M{"shelf_id": shelfID},
+		options.Count().SetLimit(1))
+	if err != nil {
+		return moves, err
+	}
+	if remaining > 0 {
+		return moves, ErrShelfNotEmpty
+	}
+	_, err = config.GetShelfCollection().DeleteOne(ctx, bson.M{"_id": shelfID})
+	return moves, err
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+)
+
+func TestAssignSlots(t *testing.T) {
+	slots := func(pairs ...int) []gridSlot {
+		out := make([]gridSlot, 0, len(pairs)/2)
+		for i := 0; i < len(pairs); i += 2 {
+			out = append(out, gridSlot{pairs[i], pairs[i+1]})
+		}
+		return out
+	}
+	tests := []struct {
+		name     string
+		rows     int
+		columns  int
+		occupied []gridSlot
+		books    []gridSlot
+		want     []gridSlot
+		wantErr  error
+	}{
+		{"books keep free slots", 2, 2, nil, slots(1, 2, 2, 1), slots(1, 2, 2, 1), nil},
+		{"the rest fill row by row", 2, 2, slots(1, 1), slots(1, 1, 0, 0, 5, 5), slots(1, 2, 2, 1, 2, 2), nil},
+		{"first book keeps a shared slot", 1, 2, nil, slots(1, 1, 1, 1), slots(1, 1, 1, 2), nil},
+		{"kept slots are not handed out again", 2, 2, nil, slots(0, 0, 1, 1), slots(1, 2, 1, 1), nil},
+		{"full shelf", 2, 2, slots(1, 1, 1, 2, 2, 1), slots(0, 0, 0, 0), nil, ErrShelfFull},
+		{"undeclared shelf is as wide as its widest row", 0, 0, slots(1, 3), slots(0, 0, 0, 0, 0, 0), slots(1, 1, 1, 2, 2, 1), nil},
+		{"undeclared rows grow downwards", 0, 2, slots(1, 1, 1, 2), slots(0, 0, 9, 1), slots(2, 1, 9, 1), nil},
+		{"columns past a declared width move", 0, 2, nil, slots(1, 3), slots(1, 1), nil},
+		{"no books", 1, 1, slots(1, 1), nil, []gridSlot{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			occupied := map[gridSlot]bool{}
+			for _, slot := range tt.occupied {
+				occupied[slot] = true
+			}
+			books := make([]ShelvedBook, len(tt.books))
+			for i, slot := range tt.books {
+				books[i].Row, books[i].Column = slot.row, slot.column
+			}
+			got, err := assignSlots(models.Shelf{Rows: tt.rows, Columns: tt.columns}, occupied, books)
+			if err != tt.wantErr || !slices.Equal(got, tt.want) {
+				t.Errorf("assignSlots = %v, %v, want %v, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// BookFilter holds the catalog filters shared by every endpoint that lists
+// books, so that listing, searching and exporting agree on what matches.
+type BookFilter struct {
+	AvailableOnly bool `json:"available_only"`
+	// Availability is one of the availability facet's values, "available"
+	// or "on_loan"; anything else matches nothing.
+	Availability string `json:"availability"`
+	Genre        string `json:"genre"`
+	Author       string `json:"author"`
+	Series       string `json:"series"`
+	// Subject is a subject ID; books filed under narrower subjects match too.
+	Subject       string `json:"subject"`
+	Tag           string `json:"tag"`
+	Publisher     string `json:"publisher"`
+	ShelfID       string `json:"shelf_id"`
+	PublishedYear int    `json:"published_year"`
+	Search        string `json:"search"`
+	// Exact matches Genre, Author, Series and Publisher as whole values the
+	// way the facets count them, instead of anywhere in the field. Author
+	// then only matches authors, not other contributors.
+	Exact bool `json:"exact"`
+}
+
+// HighlightedFields are the fields covered by the books text index, in the
+// order their weights rank them.
+var HighlightedFields = []string{"title", "author", "series", "genre", "publisher"}
+
+// searchedFields maps the highlighted fields onto the book fields searched
+// for them where the two differ: "author" matches every contributor.
+var searchedFields = map[string]string{"author": "contributors.name"}
+
+// Match builds the filter using the books text index for Search.
+func (f BookFilter) Match() bson.M {
+	filter := f.baseMatch()
+	search := strings.TrimSpace(f.Search)
+	switch {
+	case search == "":
+	case looksLikeISBN(search):
+		// a complete ISBN in either form finds the stored ISBN-13
+		if isbn, err := NormalizeISBN(search); err == nil {
+			filter["isbn"] = isbn
+		} else {
+			filter["isbn"] = ContainsRegex(CleanISBN(search))
+		}
+	default:
+		filter["$text"] = bson.M{"$search": search}
+	}
+	return filter
+}
+
+// SearchPlan is the filter a search ends up running with after falling back
+// from whole words to prefixes to spelling corrections.
+type SearchPlan struct {
+	Filter     bson.M
+	Ranked     bool
+	Query      string
+	DidYouMean string
+}
+
+// PlanBookSearch picks the first strategy that finds anything: the text
+// index, then word prefixes, then the query with misspelled terms
+// corrected. If nothing finds a book the text index plan is returned.
+func PlanBookSearch(ctx context.Context, f BookFilter) (SearchPlan, error) {
+	plan := SearchPlan{Filter: f.Match(), Ranked: f.IsTextSearch(), Query: f.Search}
+	if !plan.Ranked {
+		return plan, nil
+	}
+	found, err := anyBook(ctx, plan.Filter)
+	if err != nil || found {
+		return plan, err
+	}
+
+	prefix := SearchPlan{Filter: f.PrefixMatch(), Query: f.Search}
+	found, err = anyBook(ctx, prefix.Filter)
+	if err != nil || found {
+		return prefix, err
+	}
+
+	corrected := CorrectQuery(f.Search)
+	if corrected == "" {
+		return plan, nil
+	}
+	f.Search = corrected
+	return SearchPlan{Filter: f.Match(), Ranked: true, Query: corrected, DidYouMean: corrected}, nil
+}
+
+func anyBook(ctx context.Context, filter bson.M) (bool, error) {
+	err := config.GetBookCollection().FindOne(ctx, filter, options.FindOne().SetProjection(bson.M{"_id": 1})).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// IsTextSearch reports whether Match ranks by the text index.
+func (f BookFilter) IsTextSearch() bool {
+	search := strings.TrimSpace(f.Search)
+	return search != "" && !looksLikeISBN(search)
+}
+
+// PrefixMatch is the fallback for when the text index finds nothing, which
+// happens while a word is only partly typed ("tolk"). Every search term has
+// to start a word in one of the indexed fields.
+func (f BookFilter) PrefixMatch() bson.M {
+	if !f.IsTextSearch() {
+		return f.Match()
+	}
+	filter := f.baseMatch()
+	terms := SearchTerms(f.Search)
+	if len(terms) == 0 {
+		return filter
+	}
+	and := make([]bson.M, 0, len(terms))
+	for _, term := range terms {
+		pattern := bson.Regex{Pattern: `(^|\W)` + regexp.QuoteMeta(term), Options: "i"}
+		or := make([]bson.M, 0, len(HighlightedFields))
+		for _, field := range HighlightedFields {
+			if searched, ok := searchedFields[field]; ok {
+				field = searched
+			}
+			or = append(or, bson.M{field: pattern})
+		}
+		and = append(and, bson.M{"$or": or})
+	}
+	filter["$and"] = and
+	return filter
+}
+
+func (f BookFilter) baseMatch() bson.M {
+	filter := bson.M{}
+	if f.AvailableOnly {
+		filter["taken_by_user_id"] = nil
+	}
+	switch f.Availability {
+	case "":
+	case AvailabilityAvailable:
+		filter["taken_by_user_id"] = nil
+	case AvailabilityOnLoan:
+		if f.AvailableOnly {
+			filter["taken_by_user_id"] = bson.M{"$in": bson.A{}}
+		} else {
+			filter["taken_by_user_id"] = bson.M{"$ne": nil}
+		}
+	default:
+		filter["taken_by_user_id"] = bson.M{"$in": bson.A{}}
+	}
+	if f.Genre != "" {
+		filter["genre"] = f.fieldMatch(f.Genre)
+	}
+	if f.Author != "" {
+		if f.Exact {
+			filter["contributors"] = bson.M{"$elemMatch": bson.M{"name": f.Author, "role": models.RoleAuthor}}
+		} else {
+			filter["contributors.name"] = ContainsRegex(f.Author)
+		}
+	}
+	if f.Series != "" {
+		filter["series"] = f.fieldMatch(f.Series)
+	}
+	if f.Subject != "" {
+		// an unknown ID matches nothing rather than everything
+		subjectID, _ := bson.ObjectIDFromHex(f.Subject)
+		filter["subject_tree_ids"] = subjectID
+	}
+	if f.Tag != "" {
+		filter["tags"] = NormalizeTag(f.Tag)
+	}
+	if f.Publisher != "" {
+		filter["publisher"] = f.fieldMatch(f.Publisher)
+	}
+	if f.PublishedYear != 0 {
+		filter["published_year"] = f.PublishedYear
+	}
+	if f.ShelfID != "" {
+		shelfID, err := bson.ObjectIDFromHex(f.ShelfID)
+		if err == nil {
+			filter["shelf_id"] = shelfID
+		}
+	}
+	return filter
+}
+
+func (f BookFilter) fieldMatch(value string) any {
+	if f.Exact {
+		return value
+	}
+	return ContainsRegex(value)
+}
+
+// ContainsRegex matches value literally anywhere in the field, ignoring case.
+func ContainsRegex(value string) bson.Regex {
+	return bson.Regex{Pattern: regexp.QuoteMeta(value), Options: "i"}
+}
+
+// FoldText lower cases text, strips accents and collapses everything that
+// isn't a letter or digit into single spaces, so "Saint-Exupéry" and
+// "saint exupery" compare equal.
+func FoldText(text string) string {
+	stripAccents := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(stripAccents, text)
+	if err != nil {
+		folded = text
+	}
+	return strings.Join(SearchTerms(folded), " ")
+}
+
+// SearchTerms splits a query into lower case words.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+type HighlightSegment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match"`
+}
+
+// Highlight splits text into segments, marking the words that match one of
+// the terms. A word matches when it starts with a term, or when the term
+// starts with the word, which covers the stemming the text index applies
+// ("hobbits" finds "Hobbit").
+func Highlight(text string, terms []string) ([]HighlightSegment, bool) {
+	var segments []HighlightSegment
+	matched := false
+	runes := []rune(text)
+	start := 0
+	for start < len(runes) {
+		end := start
+		isWord := isWordRune(runes[start])
+		for end < len(runes) && isWordRune(runes[end]) == isWord {
+			end++
+		}
+		chunk := string(runes[start:end])
+		match := isWord && wordMatches(strings.ToLower(chunk), terms)
+		matched = matched || match
+
+		if n := len(segments); n > 0 && segments[n-1].Match == match {
+			segments[n-1].Text += chunk
+		} else {
+			segments = append(segments, HighlightSegment{Text: chunk, Match: match})
+		}
+		start = end
+	}
+	return segments, matched
+}
+
+// HighlightBook returns the highlighted segments for every indexed field
+// that matched the query.
+func HighlightBook(fields map[string]string, query string) map[string][]HighlightSegment {
+	terms := SearchTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	highlights := map[string][]HighlightSegment{}
+	for _, field := range HighlightedFields {
+		if segments, ok := Highlight(fields[field], terms); ok {
+			highlights[field] = segments
+		}
+	}
+	return highlights
+}
+
+func wordMatches(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) {
+			return true
+		}
+		if len([]rune(word)) >= 4 && strings.HasPrefix(term, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// the text index does not cover isbn, so queries made of ISBN characters with
+// at least ten digits look there instead
+func looksLikeISBN(query string) bool {
+	digits := 0
+	for _, r := range query {
+		switch {
+		case unicode.IsDigit(r):
+			digits++
+		case r == '-' || r == ' ' || r == 'x' || r == 'X':
+		default:
+			return false
+		}
+	}
+	return digits >= 10
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// ShelfAddressStages joins the shelf address onto each book, along with the
+// location breadcrumb ending in the shelf (see LocationPath).
+func ShelfAddressStages() mongo.Pipeline {
+	return mongo.Pipeline{
+		{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "shelves"},
+			{Key: "localField", Value: "shelf_id"},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: "shelf_details"},
+		}}},
+		{{Key: "$unwind", Value: bson.D{
+			{Key: "path", Value: "$shelf_details"},
+			{Key: "preserveNullAndEmptyArrays", Value: true},
+		}}},
+		{{Key: "$addFields", Value: bson.D{
+			{Key: "shelf_address", Value: "$shelf_details.address"},
+			{Key: "location_path", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$ifNull", Value: bson.A{"$shelf_details._id", false}}},
+				bson.D{{Key: "$concatArrays", Value: bson.A{
+					bson.D{{Key: "$ifNull", Value: bson.A{"$shelf_details.path", bson.A{}}}},
+					bson.A{bson.D{
+						{Key: "id", Value: "$shelf_details._id"},
+						{Key: "kind", Value: models.LocationShelf},
+						{Key: "name", Value: "$shelf_details.address"},
+					}},
+				}}},
+				bson.A{},
+			}}}},
+		}}},
+		{{Key: "$project", Value: bson.D{
+			{Key: "shelf_details", Value: 0},
+		}}},
+	}
+}
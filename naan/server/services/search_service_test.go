@@ -0,0 +1,41 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestBookFilterMatch(t *testing.T) {
+	nothing := bson.M{"$in": bson.A{}}
+	tests := []struct {
+		name   string
+		filter BookFilter
+		want   bson.M
+	}{
+		{"empty", BookFilter{}, bson.M{}},
+		{"genre contains", BookFilter{Genre: "Fiction"}, bson.M{"genre": ContainsRegex("Fiction")}},
+		{"genre exact", BookFilter{Genre: "Fiction", Exact: true}, bson.M{"genre": "Fiction"}},
+		{"series exact", BookFilter{Series: "Discworld", Exact: true}, bson.M{"series": "Discworld"}},
+		{"publisher exact", BookFilter{Publisher: "Tor", Exact: true}, bson.M{"publisher": "Tor"}},
+		{"author contains", BookFilter{Author: "Tom"}, bson.M{"contributors.name": ContainsRegex("Tom")}},
+		{"author exact", BookFilter{Author: "Tom", Exact: true}, bson.M{
+			"contributors": bson.M{"$elemMatch": bson.M{"name": "Tom", "role": models.RoleAuthor}},
+		}},
+		{"available", BookFilter{Availability: AvailabilityAvailable}, bson.M{"taken_by_user_id": nil}},
+		{"on loan", BookFilter{Availability: AvailabilityOnLoan}, bson.M{"taken_by_user_id": bson.M{"$ne": nil}}},
+		{"on loan and available only", BookFilter{Availability: AvailabilityOnLoan, AvailableOnly: true}, bson.M{"taken_by_user_id": nothing}},
+		{"unknown availability", BookFilter{Availability: "lost"}, bson.M{"taken_by_user_id": nothing}},
+		{"isbn", BookFilter{Search: "0-306-40615-2"}, bson.M{"isbn": "9780306406157"}},
+		{"text", BookFilter{Search: "hobbit"}, bson.M{"$text": bson.M{"$search": "hobbit"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
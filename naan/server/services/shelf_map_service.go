@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// Slot states besides AvailabilityAvailable and AvailabilityOnLoan. A book
+// on hold is on the shelf with patrons waiting in its hold queue.
+const (
+	SlotEmpty  = "empty"
+	SlotOnHold = "on_hold"
+)
+
+// maxUndeclaredGrid caps the grid drawn for a shelf without declared
+// dimensions, which is sized to the books on it.
+const maxUndeclaredGrid = 200
+
+// SlotBook is a book in the shelf map.
+type SlotBook struct {
+	ShelvedBook      `bson:",inline"`
+	TakenByUserID    *bson.ObjectID `bson:"taken_by_user_id,omitempty" json:"-"`
+	Status           string         `bson:"-" json:"status"`
+	HoldQueueLength  int64          `bson:"-" json:"hold_queue_length"`
+	ExpectedReturnAt *time.Time     `bson:"-" json:"expected_return_at,omitempty"`
+}
+
+// ShelfSlot is one row and column of a shelf. Book is the book recorded
+// there; Conflicts are any further books recorded at the same position.
+type ShelfSlot struct {
+	Row       int        `json:"row"`
+	Column    int        `json:"column"`
+	Status    string     `json:"status"`
+	Book      *SlotBook  `json:"book,omitempty"`
+	Conflicts []SlotBook `json:"conflicts,omitempty"`
+}
+
+type ShelfMap struct {
+	Shelf        models.Shelf           `json:"shelf"`
+	LocationPath []models.LocationCrumb `json:"location_path"`
+	Rows         int                    `json:"rows"`
+	Columns      int                    `json:"columns"`
+	// Declared is false when the shelf has no declared grid and Rows and
+	// Columns only reach as far as its books.
+	Declared bool `json:"declared"`
+	// Grid holds the slots row by row, Grid[0][0] being row 1, column 1.
+	Grid [][]ShelfSlot `json:"grid"`
+	// Counts tallies the slots by status.
+	Counts map[string]int `json:"counts"`
+	// Conflicts lists the slots with more than one book, and OutOfGrid the
+	// books recorded outside the shelf's rows and columns.
+	Conflicts []ShelfSlot `json:"conflicts"`
+	OutOfGrid []SlotBook  `json:"out_of_grid"`
+}
+
+func slotStatus(book SlotBook, holds map[bson.ObjectID]int64) string {
+	switch {
+	case book.TakenByUserID != nil:
+		return AvailabilityOnLoan
+	case holds[book.ID] > 0:
+		return SlotOnHold
+	}
+	return AvailabilityAvailable
+}
+
+// GetShelfMap lays a shelf's books out on its row by column grid.
+func GetShelfMap(ctx context.Context, shelf models.Shelf) (ShelfMap, error) {
+	cursor, err := config.GetBookCollection().Find(ctx, bson.M{"shelf_id": shelf.ID}, options.Find().
+		SetProjection(bson.M{
+			"title": 1, "author": 1, "call_number": 1, "call_number_key": 1,
+			"row": 1, "column": 1, "taken_by_user_id": 1,
+		}).
+		SetSort(bson.D{{Key: "row", Value: 1}, {Key: "column", Value: 1}, {Key: "_id", Value: 1}}))
+	if err != nil {
+		return ShelfMap{}, err
+	}
+	books := []SlotBook{}
+	if err := cursor.All(ctx, &books); err != nil {
+		return ShelfMap{}, err
+	}
+
+	bookIDs := make([]bson.ObjectID, 0, len(books))
+	for _, book := range books {
+		bookIDs = append(bookIDs, book.ID)
+	}
+	holds, err := HoldQueueLengths(ctx, bookIDs)
+	if err != nil {
+		return ShelfMap{}, err
+	}
+	loans, err := OpenLoans(ctx, bookIDs)
+	if err != nil {
+		return ShelfMap{}, err
+	}
+	for i := range books {
+		book := &books[i]
+		book.Status = slotStatus(*book, holds)
+		book.HoldQueueLength = holds[book.ID]
+		book.ExpectedReturnAt = expectedReturn(book.ID, book.TakenByUserID != nil, loans)
+	}
+	return layOutShelf(shelf, books), nil
+}
+
+// layOutShelf places books, sorted by row and column, on the shelf's grid.
+func layOutShelf(shelf models.Shelf, books []SlotBook) ShelfMap {
+	shelfMap := ShelfMap{
+		Shelf:        shelf,
+		LocationPath: LocationPath(shelf),
+		Rows:         shelf.Rows,
+		Columns:      shelf.Columns,
+		Declared:     shelf.Rows > 0 && shelf.Columns > 0,
+		Counts:       map[string]int{},
+		Conflicts:    []ShelfSlot{},
+		OutOfGrid:    []SlotBook{},
+	}
+	if !shelfMap.Declared {
+		for _, book := range books {
+			if book.Row > shelfMap.Rows && book.Row <= maxUndeclaredGrid {
+				shelfMap.Rows = book.Row
+			}
+			if book.Column > shelfMap.Columns && book.Column <= maxUndeclaredGrid {
+				shelfMap.Columns = book.Column
+			}
+		}
+	}
+
+	shelfMap.Grid = make([][]ShelfSlot, shelfMap.Rows)
+	for r := range shelfMap.Grid {
+		shelfMap.Grid[r] = make([]ShelfSlot, shelfMap.Columns)
+		for c := range shelfMap.Grid[r] {
+			shelfMap.Grid[r][c] = ShelfSlot{Row: r + 1, Column: c + 1, Status: SlotEmpty}
+		}
+	}
+	for i := range books {
+		book := books[i]
+		if book.Row < 1 || book.Row > shelfMap.Rows || book.Column < 1 || book.Column > shelfMap.Columns {
+			shelfMap.OutOfGrid = append(shelfMap.OutOfGrid, book)
+			continue
+		}
+		slot := &shelfMap.Grid[book.Row-1][book.Column-1]
+		if slot.Book == nil {
+			slot.Book = &book
+			slot.Status = book.Status
+		} else {
+			slot.Conflicts = append(slot.Conflicts, book)
+		}
+	}
+	for _, row := range shelfMap.Grid {
+		for _, slot := range row {
+			shelfMap.Counts[slot.Status]++
+			if len(slot.Conflicts) > 0 {
+				shelfMap.Conflicts = append(shelfMap.Conflicts, slot)
+			}
+		}
+	}
+	return shelfMap
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func slotBook(title string, row, column int, status string) SlotBook {
+	return SlotBook{
+		ShelvedBook: ShelvedBook{ID: bson.NewObjectID(), Title: title, Row: row, Column: column},
+		Status:      status,
+	}
+}
+
+func TestLayOutShelfDeclared(t *testing.T) {
+	shelf := models.Shelf{ID: bson.NewObjectID(), Address: "A1", Rows: 2, Columns: 3}
+	books := []SlotBook{
+		slotBook("Dune", 1, 1, AvailabilityAvailable),
+		slotBook("Emma", 1, 1, AvailabilityAvailable),
+		slotBook("Beloved", 2, 3, AvailabilityOnLoan),
+		slotBook("Ulysses", 3, 1, AvailabilityAvailable),
+		slotBook("Walden", 1, 4, AvailabilityAvailable),
+		slotBook("Unplaced", 0, 0, AvailabilityAvailable),
+	}
+	shelfMap := layOutShelf(shelf, books)
+
+	if !shelfMap.Declared || shelfMap.Rows != 2 || shelfMap.Columns != 3 {
+		t.Fatalf("grid = %dx%d declared %v, want the declared 2x3", shelfMap.Rows, shelfMap.Columns, shelfMap.Declared)
+	}
+	if len(shelfMap.Grid) != 2 || len(shelfMap.Grid[0]) != 3 {
+		t.Fatalf("Grid is %d rows, want 2 of 3 slots", len(shelfMap.Grid))
+	}
+	slot := shelfMap.Grid[0][0]
+	if slot.Book == nil || slot.Book.Title != "Dune" || len(slot.Conflicts) != 1 || slot.Conflicts[0].Title != "Emma" {
+		t.Errorf("slot 1,1 = %+v, want Dune with Emma as a conflict", slot)
+	}
+	if len(shelfMap.Conflicts) != 1 || shelfMap.Conflicts[0].Row != 1 || shelfMap.Conflicts[0].Column != 1 {
+		t.Errorf("Conflicts = %+v, want slot 1,1", shelfMap.Conflicts)
+	}
+	if slot := shelfMap.Grid[1][2]; slot.Row != 2 || slot.Column != 3 || slot.Status != AvailabilityOnLoan {
+		t.Errorf("slot 2,3 = %+v, want Beloved on loan", slot)
+	}
+	var outside []string
+	for _, book := range shelfMap.OutOfGrid {
+		outside = append(outside, book.Title)
+	}
+	if len(outside) != 3 || outside[0] != "Ulysses" || outside[1] != "Walden" || outside[2] != "Unplaced" {
+		t.Errorf("OutOfGrid = %v, want Ulysses, Walden and Unplaced", outside)
+	}
+	want := map[string]int{AvailabilityAvailable: 1, AvailabilityOnLoan: 1, SlotEmpty: 4}
+	for status, count := range want {
+		if shelfMap.Counts[status] != count {
+			t.Errorf("Counts[%s] = %d, want %d", status, shelfMap.Counts[status], count)
+		}
+	}
+	if path := shelfMap.LocationPath; len(path) == 0 || path[len(path)-1].Name != "A1" {
+		t.Errorf("LocationPath = %+v, want it to end at the shelf", path)
+	}
+}
+
+func TestLayOutShelfUndeclared(t *testing.T) {
+	tests := []struct {
+		name          string
+		books         []SlotBook
+		rows, columns int
+		outOfGrid     int
+	}{
+		{"empty", nil, 0, 0, 0},
+		{"sized to books", []SlotBook{
+			slotBook("Dune", 2, 5, AvailabilityAvailable),
+			slotBook("Emma", 4, 1, SlotOnHold),
+		}, 4, 5, 0},
+		{"capped", []SlotBook{
+			slotBook("Dune", 3, 2, AvailabilityAvailable),
+			slotBook("Typo", maxUndeclaredGrid+1, 1, AvailabilityAvailable),
+			slotBook("Typo too", 1, 10000, AvailabilityAvailable),
+		}, 3, 2, 2},
+		{"at the cap", []SlotBook{
+			slotBook("Dune", maxUndeclaredGrid, 1, AvailabilityAvailable),
+		}, maxUndeclaredGrid, 1, 0},
+	}
+	for _, tt := range tests {
+		shelfMap := layOutShelf(models.Shelf{Address: "B2"}, tt.books)
+		if shelfMap.Declared {
+			t.Errorf("%s: Declared is true for a shelf without rows and columns", tt.name)
+		}
+		if shelfMap.Rows != tt.rows || shelfMap.Columns != tt.columns || len(shelfMap.Grid) != tt.rows {
+			t.Errorf("%s: grid = %dx%d with %d rows, want %dx%d", tt.name, shelfMap.Rows, shelfMap.Columns, len(shelfMap.Grid), tt.rows, tt.columns)
+		}
+		if len(shelfMap.OutOfGrid) != tt.outOfGrid {
+			t.Errorf("%s: %d books out of grid, want %d", tt.name, len(shelfMap.OutOfGrid), tt.outOfGrid)
+		}
+	}
+}
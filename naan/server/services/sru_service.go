@@ -0,0 +1,252 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+)
+
+const (
+	SRUVersion          = "2.0"
+	SRUResponseNS       = "http://docs.oasis-open.org/ns/search-ws/sruResponse"
+	SRUDiagnosticNS     = "http://docs.oasis-open.org/ns/search-ws/diagnostic"
+	SRUDefaultRecords   = 10
+	SRUMaxRecords       = 100
+	SRUSchemaDC         = "info:srw/schema/1/dc-v1.1"
+	SRUSchemaMARCXML    = "info:srw/schema/1/marcxml-v1.1"
+	oaiDCNamespace      = "http://www.openarchives.org/OAI/2.0/oai_dc/"
+	dcElementsNamespace = "http://purl.org/dc/elements/1.1/"
+)
+
+// SRUSchemas maps the recordSchema names clients may ask for, short or as
+// URIs, to the schema URI.
+var SRUSchemas = map[string]string{
+	"dc":             SRUSchemaDC,
+	SRUSchemaDC:      SRUSchemaDC,
+	"marcxml":        SRUSchemaMARCXML,
+	"marc21":         SRUSchemaMARCXML,
+	SRUSchemaMARCXML: SRUSchemaMARCXML,
+}
+
+type SRUDiagnostic struct {
+	XMLName xml.Name `xml:"diag:diagnostic"`
+	URI     string   `xml:"diag:uri"`
+	Details string   `xml:"diag:details,omitempty"`
+	Message string   `xml:"diag:message,omitempty"`
+}
+
+type SRURecord struct {
+	Schema   string `xml:"sru:recordSchema"`
+	Escaping string `xml:"sru:recordXMLEscaping"`
+	Data     struct {
+		Inner string `xml:",innerxml"`
+	} `xml:"sru:recordData"`
+	Position int64 `xml:"sru:recordPosition"`
+}
+
+type SRUSearchRetrieveResponse struct {
+	XMLName            xml.Name        `xml:"sru:searchRetrieveResponse"`
+	XmlnsSRU           string          `xml:"xmlns:sru,attr"`
+	XmlnsDiag          string          `xml:"xmlns:diag,attr"`
+	Version            string          `xml:"sru:version"`
+	NumberOfRecords    int64           `xml:"sru:numberOfRecords"`
+	Records            *SRURecords     `xml:"sru:records,omitempty"`
+	NextRecordPosition int64           `xml:"sru:nextRecordPosition,omitempty"`
+	Diagnostics        *SRUDiagnostics `xml:"sru:diagnostics,omitempty"`
+}
+
+type SRURecords struct {
+	Records []SRURecord `xml:"sru:record"`
+}
+
+type SRUDiagnostics struct {
+	Diagnostics []SRUDiagnostic `xml:"diag:diagnostic"`
+}
+
+func NewSRUSearchRetrieveResponse() SRUSearchRetrieveResponse {
+	return SRUSearchRetrieveResponse{XmlnsSRU: SRUResponseNS, XmlnsDiag: SRUDiagnosticNS, Version: SRUVersion}
+}
+
+// SRURecordFor renders a book in the schema, escaped as a string when the
+// client asked for recordXMLEscaping=string.
+func SRURecordFor(book ExportedBook, schema string, escaping string, position int64) (SRURecord, error) {
+	var data bytes.Buffer
+	var err error
+	if schema == SRUSchemaMARCXML {
+		err = WriteMARCXMLRecord(&data, BookToMARC(book.Book, book.ShelfAddress), true)
+	} else {
+		err = writeDublinCore(&data, book)
+	}
+	if err != nil {
+		return SRURecord{}, err
+	}
+	record := SRURecord{Schema: schema, Escaping: "xml", Position: position}
+	if escaping == "string" {
+		var escaped bytes.Buffer
+		xml.EscapeText(&escaped, data.Bytes())
+		record.Escaping = "string"
+		record.Data.Inner = escaped.String()
+	} else {
+		record.Data.Inner = data.String()
+	}
+	return record, nil
+}
+
+func writeDublinCore(w *bytes.Buffer, book ExportedBook) error {
+	type dc struct {
+		XMLName     xml.Name `xml:"oai_dc:dc"`
+		XmlnsOAI    string   `xml:"xmlns:oai_dc,attr"`
+		XmlnsDC     string   `xml:"xmlns:dc,attr"`
+		Title       string   `xml:"dc:title"`
+		Creators    []string `xml:"dc:creator"`
+		Contributor []string `xml:"dc:contributor"`
+		Publisher   string   `xml:"dc:publisher,omitempty"`
+		Date        string   `xml:"dc:date,omitempty"`
+		Subjects    []string `xml:"dc:subject"`
+		Type        string   `xml:"dc:type"`
+		Format      string   `xml:"dc:format,omitempty"`
+		Identifiers []string `xml:"dc:identifier"`
+		Relation    string   `xml:"dc:relation,omitempty"`
+		Language    string   `xml:"dc:language,omitempty"`
+		Description string   `xml:"dc:description,omitempty"`
+	}
+	record := NewExportRecord(book)
+	out := dc{
+		XmlnsOAI:    oaiDCNamespace,
+		XmlnsDC:     dcElementsNamespace,
+		Title:       book.Title,
+		Creators:    BookAuthors(book.Book),
+		Contributor: ContributorNames(book.Contributors, models.RoleEditor, models.RoleTranslator, models.RoleIllustrator),
+		Publisher:   book.Publisher,
+		Type:        "Text",
+		Identifiers: []string{"urn:naan:book:" + record.ID},
+		Description: "Shelf " + book.ShelfAddress + ", row " + strconv.Itoa(book.Row) + ", column " + strconv.Itoa(book.Column) + "; " + record.Availability,
+	}
+	if book.PublishedYear > 0 {
+		out.Date = strconv.Itoa(book.PublishedYear)
+	}
+	if book.Genre != "" {
+		out.Subjects = append(out.Subjects, book.Genre)
+	}
+	for _, subject := range book.Subjects {
+		if subject != book.Genre {
+			out.Subjects = append(out.Subjects, subject)
+		}
+	}
+	if book.ISBN != "" {
+		out.Identifiers = append(out.Identifiers, "urn:isbn:"+book.ISBN)
+	}
+	if book.Series != "" {
+		series := book.Series
+		if book.SeriesNumber != 0 {
+			series += " ; " + strconv.FormatFloat(book.SeriesNumber, 'f', -1, 64)
+		}
+		out.Relation = series
+	}
+	if book.PageCount > 0 {
+		out.Format = strconv.Itoa(book.PageCount) + " pages"
+	}
+	return xml.NewEncoder(w).Encode(out)
+}
+
+type sruExplainRecord struct {
+	Schema   string `xml:"sru:recordSchema"`
+	Escaping string `xml:"sru:recordXMLEscaping"`
+	Data     struct {
+		Explain sruExplain `xml:"explain"`
+	} `xml:"sru:recordData"`
+}
+
+type sruExplainSet struct {
+	Name       string `xml:"name,attr"`
+	Identifier string `xml:"identifier,attr"`
+}
+
+type sruExplainIndex struct {
+	Title string `xml:"title"`
+	Name  struct {
+		Set  string `xml:"set,attr"`
+		Name string `xml:",chardata"`
+	} `xml:"map>name"`
+}
+
+type sruExplainSchema struct {
+	Identifier string `xml:"identifier,attr"`
+	Name       string `xml:"name,attr"`
+	Title      string `xml:"title"`
+}
+
+type sruExplainSetting struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type sruExplain struct {
+	Xmlns      string `xml:"xmlns,attr"`
+	ServerInfo struct {
+		Protocol string `xml:"protocol,attr"`
+		Version  string `xml:"version,attr"`
+		Host     string `xml:"host"`
+		Port     string `xml:"port"`
+		Database string `xml:"database"`
+	} `xml:"serverInfo"`
+	DatabaseInfo struct {
+		Title       string `xml:"title"`
+		Description string `xml:"description"`
+	} `xml:"databaseInfo"`
+	Sets     []sruExplainSet     `xml:"indexInfo>set"`
+	Indexes  []sruExplainIndex   `xml:"indexInfo>index"`
+	Schemas  []sruExplainSchema  `xml:"schemaInfo>schema"`
+	Defaults []sruExplainSetting `xml:"configInfo>default"`
+	Settings []sruExplainSetting `xml:"configInfo>setting"`
+}
+
+type SRUExplainResponse struct {
+	XMLName  xml.Name         `xml:"sru:explainResponse"`
+	XmlnsSRU string           `xml:"xmlns:sru,attr"`
+	Version  string           `xml:"sru:version"`
+	Record   sruExplainRecord `xml:"sru:record"`
+}
+
+// NewSRUExplainResponse describes the server in ZeeRex, the format SRU
+// clients read indexes and schemas from.
+func NewSRUExplainResponse(host, port, database string) SRUExplainResponse {
+	var explain sruExplain
+	explain.Xmlns = "http://explain.z3950.org/dtd/2.0/"
+	explain.ServerInfo.Protocol = "SRU"
+	explain.ServerInfo.Version = SRUVersion
+	explain.ServerInfo.Host = host
+	explain.ServerInfo.Port = port
+	explain.ServerInfo.Database = database
+	explain.DatabaseInfo.Title = "naan library catalog"
+	explain.DatabaseInfo.Description = "Books held by the library, with their shelf location and availability"
+	explain.Sets = []sruExplainSet{
+		{"cql", "info:srw/cql-context-set/1/cql-v1.2"},
+		{"dc", "info:srw/cql-context-set/1/dc-v1.1"},
+		{"bath", "http://zing.z3950.org/cql/bath/2.0/"},
+	}
+	for _, index := range CQLIndexes {
+		var entry sruExplainIndex
+		entry.Title = index.Title
+		entry.Name.Set = index.Set
+		entry.Name.Name = index.Name
+		explain.Indexes = append(explain.Indexes, entry)
+	}
+	explain.Schemas = []sruExplainSchema{
+		{SRUSchemaDC, "dc", "Dublin Core"},
+		{SRUSchemaMARCXML, "marcxml", "MARC21 XML"},
+	}
+	explain.Defaults = []sruExplainSetting{
+		{"numberOfRecords", strconv.Itoa(SRUDefaultRecords)},
+		{"recordSchema", "dc"},
+	}
+	explain.Settings = []sruExplainSetting{{"maximumRecords", strconv.Itoa(SRUMaxRecords)}}
+
+	response := SRUExplainResponse{XmlnsSRU: SRUResponseNS, Version: SRUVersion}
+	response.Record.Schema = "http://explain.z3950.org/dtd/2.0/"
+	response.Record.Escaping = "xml"
+	response.Record.Data.Explain = explain
+	return response
+}
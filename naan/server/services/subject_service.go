@@ -0,0 +1,593 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+var (
+	ErrSubjectNotFound    = errors.New("subject not found")
+	ErrSubjectName        = errors.New("subject name is required")
+	ErrSubjectExists      = errors.New("a subject with this name already exists, merge them instead")
+	ErrSubjectCycle       = errors.New("a subject can't be placed below itself")
+	ErrSubjectHasChildren = errors.New("subject has narrower subjects, move or merge them first")
+)
+
+// SubjectKey identifies a subject regardless of case and punctuation, so
+// "Science-Fiction" and "science fiction" are one heading.
+func SubjectKey(name string) string {
+	return FoldText(name)
+}
+
+func cleanSubjectName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+func GetSubject(ctx context.Context, id bson.ObjectID) (models.Subject, error) {
+	var subject models.Subject
+	err := config.GetSubjectCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&subject)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return subject, ErrSubjectNotFound
+	}
+	return subject, err
+}
+
+// subjectAncestry is the ancestors list of a subject placed under parent.
+func subjectAncestry(ctx context.Context, parentID *bson.ObjectID) ([]bson.ObjectID, error) {
+	if parentID == nil {
+		return []bson.ObjectID{}, nil
+	}
+	parent, err := GetSubject(ctx, *parentID)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]bson.ObjectID{}, parent.Ancestors...), parent.ID), nil
+}
+
+func CreateSubject(ctx context.Context, name string, parentID *bson.ObjectID, scopeNote string) (models.Subject, error) {
+	name = cleanSubjectName(name)
+	if SubjectKey(name) == "" {
+		return models.Subject{}, ErrSubjectName
+	}
+	ancestors, err := subjectAncestry(ctx, parentID)
+	if err != nil {
+		return models.Subject{}, err
+	}
+	now := time.Now()
+	subject := models.Subject{
+		Name:      name,
+		Key:       SubjectKey(name),
+		ParentID:  parentID,
+		Ancestors: ancestors,
+		ScopeNote: strings.TrimSpace(scopeNote),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	result, err := config.GetSubjectCollection().InsertOne(ctx, subject)
+	if mongo.IsDuplicateKeyError(err) {
+		return subject, ErrSubjectExists
+	}
+	if err != nil {
+		return subject, err
+	}
+	subject.ID = result.InsertedID.(bson.ObjectID)
+	return subject, nil
+}
+
+// RenameSubject changes a heading and the subject names and genres stored on
+// its books.
+func RenameSubject(ctx context.Context, id bson.ObjectID, name string) (models.Subject, error) {
+	name = cleanSubjectName(name)
+	if SubjectKey(name) == "" {
+		return models.Subject{}, ErrSubjectName
+	}
+	subject, err := GetSubject(ctx, id)
+	if err != nil {
+		return subject, err
+	}
+	oldKey := subject.Key
+	err = config.GetSubjectCollection().FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
+		"name":       name,
+		"key":        SubjectKey(name),
+		"updated_at": time.Now(),
+	}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&subject)
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return subject, ErrSubjectNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return subject, ErrSubjectExists
+	case err != nil:
+		return subject, err
+	}
+	if err := renameBookGenres(ctx, id, oldKey, name); err != nil {
+		return subject, err
+	}
+	return subject, refreshBookSubjects(ctx, bson.M{"subject_tree_ids": id, "subject_ids": id}, nil)
+}
+
+// renameBookGenres carries a subject's new name into the genre of the books
+// filed under it, since OPDS feeds and facets group books by genre.
+func renameBookGenres(ctx context.Context, id bson.ObjectID, oldKey, name string) error {
+	collection := config.GetBookCollection()
+	cursor, err := collection.Find(ctx, bson.M{"subject_ids": id}, options.Find().SetProjection(bson.M{"genre": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var book models.Book
+		if err := cursor.Decode(&book); err != nil {
+			return err
+		}
+		if SubjectKey(book.Genre) == oldKey && book.Genre != name {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": book.ID}).
+				SetUpdate(bson.M{"$set": bson.M{"genre": name}}))
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	_, err = collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// MoveSubject places a subject, with everything below it, under a new
+// parent, or at the top of the tree when parentID is nil.
+func MoveSubject(ctx context.Context, id bson.ObjectID, parentID *bson.ObjectID) (models.Subject, error) {
+	subject, err := GetSubject(ctx, id)
+	if err != nil {
+		return subject, err
+	}
+	if err := reparentSubject(ctx, &subject, parentID); err != nil {
+		return subject, err
+	}
+	return subject, refreshBookSubjects(ctx, bson.M{"subject_tree_ids": id}, nil)
+}
+
+// reparentSubject moves a subtree without touching books.
+func reparentSubject(ctx context.Context, subject *models.Subject, parentID *bson.ObjectID) error {
+	ancestors, err := subjectAncestry(ctx, parentID)
+	if err != nil {
+		return err
+	}
+	if parentID != nil && (*parentID == subject.ID || containsID(ancestors, subject.ID)) {
+		return ErrSubjectCycle
+	}
+
+	collection := config.GetSubjectCollection()
+	now := time.Now()
+	writes := []mongo.WriteModel{mongo.NewUpdateOneModel().
+		SetFilter(bson.M{"_id": subject.ID}).
+		SetUpdate(bson.M{"$set": bson.M{"parent_id": parentID, "ancestors": ancestors, "updated_at": now}})}
+
+	cursor, err := collection.Find(ctx, bson.M{"ancestors": subject.ID})
+	if err != nil {
+		return err
+	}
+	var descendants []models.Subject
+	if err := cursor.All(ctx, &descendants); err != nil {
+		return err
+	}
+	for _, descendant := range descendants {
+		// keep the part of the path from the moved subject down
+		for i, ancestor := range descendant.Ancestors {
+			if ancestor == subject.ID {
+				path := append(append([]bson.ObjectID{}, ancestors...), descendant.Ancestors[i:]...)
+				writes = append(writes, mongo.NewUpdateOneModel().
+					SetFilter(bson.M{"_id": descendant.ID}).
+					SetUpdate(bson.M{"$set": bson.M{"ancestors": path, "updated_at": now}}))
+				break
+			}
+		}
+	}
+	if _, err := collection.BulkWrite(ctx, writes); err != nil {
+		return err
+	}
+	subject.ParentID, subject.Ancestors, subject.UpdatedAt = parentID, ancestors, now
+	return nil
+}
+
+// MergeSubjects folds source into target: its books get target instead,
+// its narrower subjects move under target and source is deleted.
+func MergeSubjects(ctx context.Context, sourceID, targetID bson.ObjectID) (models.Subject, error) {
+	source, err := GetSubject(ctx, sourceID)
+	if err != nil {
+		return source, err
+	}
+	target, err := GetSubject(ctx, targetID)
+	if err != nil {
+		return target, err
+	}
+	if source.ID == target.ID || containsID(target.Ancestors, source.ID) {
+		return target, ErrSubjectCycle
+	}
+
+	cursor, err := config.GetSubjectCollection().Find(ctx, bson.M{"parent_id": source.ID})
+	if err != nil {
+		return target, err
+	}
+	var children []models.Subject
+	if err := cursor.All(ctx, &children); err != nil {
+		return target, err
+	}
+	for i := range children {
+		if err := reparentSubject(ctx, &children[i], &target.ID); err != nil {
+			return target, err
+		}
+	}
+
+	if err := renameBookGenres(ctx, source.ID, source.Key, target.Name); err != nil {
+		return target, err
+	}
+	err = refreshBookSubjects(ctx, bson.M{"subject_tree_ids": source.ID}, map[bson.ObjectID]bson.ObjectID{source.ID: target.ID})
+	if err != nil {
+		return target, err
+	}
+	_, err = config.GetSubjectCollection().DeleteOne(ctx, bson.M{"_id": source.ID})
+	return target, err
+}
+
+// DeleteSubject removes a subject without narrower subjects, and takes it
+// off its books.
+func DeleteSubject(ctx context.Context, id bson.ObjectID) error {
+	subject, err := GetSubject(ctx, id)
+	if err != nil {
+		return err
+	}
+	children, err := config.GetSubjectCollection().CountDocuments(ctx, bson.M{"parent_id": subject.ID})
+	if err != nil {
+		return err
+	}
+	if children > 0 {
+		return ErrSubjectHasChildren
+	}
+	if err := refreshBookSubjects(ctx, bson.M{"subject_tree_ids": id, "subject_ids": id}, map[bson.ObjectID]bson.ObjectID{id: {}}); err != nil {
+		return err
+	}
+	_, err = config.GetSubjectCollection().DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// refreshBookSubjects rewrites the subject fields of the matching books from
+// the vocabulary, after applying replace to their subject IDs. Replacing
+// with the zero ID removes a subject.
+func refreshBookSubjects(ctx context.Context, filter bson.M, replace map[bson.ObjectID]bson.ObjectID) error {
+	subjects, err := subjectsByID(ctx)
+	if err != nil {
+		return err
+	}
+	collection := config.GetBookCollection()
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"subject_ids": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var book models.Book
+		if err := cursor.Decode(&book); err != nil {
+			return err
+		}
+		ids := make([]bson.ObjectID, 0, len(book.SubjectIDs))
+		for _, id := range book.SubjectIDs {
+			if replacement, ok := replace[id]; ok {
+				id = replacement
+			}
+			if !id.IsZero() {
+				ids = append(ids, id)
+			}
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": book.ID}).
+			SetUpdate(bson.M{"$set": bookSubjectFields(subjectList(ids, subjects))}))
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	_, err = collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func subjectsByID(ctx context.Context) (map[bson.ObjectID]models.Subject, error) {
+	cursor, err := config.GetSubjectCollection().Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	var all []models.Subject
+	if err := cursor.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	subjects := make(map[bson.ObjectID]models.Subject, len(all))
+	for _, subject := range all {
+		subjects[subject.ID] = subject
+	}
+	return subjects, nil
+}
+
+// subjectList looks ids up, dropping repeats and subjects that are gone.
+func subjectList(ids []bson.ObjectID, subjects map[bson.ObjectID]models.Subject) []models.Subject {
+	seen := map[bson.ObjectID]bool{}
+	list := make([]models.Subject, 0, len(ids))
+	for _, id := range ids {
+		if subject, ok := subjects[id]; ok && !seen[id] {
+			seen[id] = true
+			list = append(list, subject)
+		}
+	}
+	return list
+}
+
+// bookSubjectFields are the fields a book stores for its subjects.
+func bookSubjectFields(subjects []models.Subject) bson.M {
+	names := make([]string, 0, len(subjects))
+	ids := make([]bson.ObjectID, 0, len(subjects))
+	tree := []bson.ObjectID{}
+	for _, subject := range subjects {
+		names = append(names, subject.Name)
+		ids = append(ids, subject.ID)
+		for _, id := range append(append([]bson.ObjectID{}, subject.Ancestors...), subject.ID) {
+			if !containsID(tree, id) {
+				tree = append(tree, id)
+			}
+		}
+	}
+	return bson.M{"subjects": names, "subject_ids": ids, "subject_tree_ids": tree}
+}
+
+// BookSubjects files a book under the named subjects. Names the vocabulary
+// doesn't have yet, from cataloguers or metadata providers, are added at the
+// top of the tree for a librarian to place or merge later.
+func BookSubjects(ctx context.Context, names []string) (bson.M, error) {
+	collection := config.GetSubjectCollection()
+	subjects := make([]models.Subject, 0, len(names))
+	for _, name := range names {
+		name = cleanSubjectName(name)
+		key := SubjectKey(name)
+		if key == "" {
+			continue
+		}
+		var subject models.Subject
+		now := time.Now()
+		err := collection.FindOneAndUpdate(ctx, bson.M{"key": key}, bson.M{
+			"$setOnInsert": bson.M{
+				"name":       name,
+				"key":        key,
+				"ancestors":  []bson.ObjectID{},
+				"created_at": now,
+				"updated_at": now,
+			},
+		}, options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)).Decode(&subject)
+		if err != nil {
+			return nil, err
+		}
+		subjects = append(subjects, subject)
+	}
+	ids := make([]bson.ObjectID, 0, len(subjects))
+	byID := map[bson.ObjectID]models.Subject{}
+	for _, subject := range subjects {
+		ids = append(ids, subject.ID)
+		byID[subject.ID] = subject
+	}
+	return bookSubjectFields(subjectList(ids, byID)), nil
+}
+
+// SubjectTree returns the whole vocabulary as a tree in name order.
+func SubjectTree(ctx context.Context) ([]models.SubjectNode, error) {
+	subjects, err := subjectsByID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := subjectBookCounts(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	children := map[bson.ObjectID][]models.Subject{}
+	var roots []models.Subject
+	for _, subject := range subjects {
+		if subject.ParentID == nil {
+			roots = append(roots, subject)
+		} else {
+			children[*subject.ParentID] = append(children[*subject.ParentID], subject)
+		}
+	}
+	var build func([]models.Subject) []models.SubjectNode
+	build = func(level []models.Subject) []models.SubjectNode {
+		sort.Slice(level, func(i, j int) bool { return level[i].Key < level[j].Key })
+		nodes := make([]models.SubjectNode, 0, len(level))
+		for _, subject := range level {
+			nodes = append(nodes, models.SubjectNode{
+				Subject:   subject,
+				BookCount: counts[subject.ID],
+				Children:  build(children[subject.ID]),
+			})
+		}
+		return nodes
+	}
+	return build(roots), nil
+}
+
+// SubjectBranch returns a subject with the path down to it and its direct
+// narrower subjects, for browsing.
+func SubjectBranch(ctx context.Context, id bson.ObjectID) (models.SubjectNode, []models.Subject, error) {
+	subject, err := GetSubject(ctx, id)
+	if err != nil {
+		return models.SubjectNode{}, nil, err
+	}
+	collection := config.GetSubjectCollection()
+	breadcrumb := []models.Subject{}
+	if len(subject.Ancestors) > 0 {
+		cursor, err := collection.Find(ctx, bson.M{"_id": bson.M{"$in": subject.Ancestors}})
+		if err != nil {
+			return models.SubjectNode{}, nil, err
+		}
+		var ancestors []models.Subject
+		if err := cursor.All(ctx, &ancestors); err != nil {
+			return models.SubjectNode{}, nil, err
+		}
+		sort.Slice(ancestors, func(i, j int) bool { return len(ancestors[i].Ancestors) < len(ancestors[j].Ancestors) })
+		breadcrumb = ancestors
+	}
+
+	cursor, err := collection.Find(ctx, bson.M{"parent_id": subject.ID}, options.Find().SetSort(bson.D{{Key: "key", Value: 1}}))
+	if err != nil {
+		return models.SubjectNode{}, nil, err
+	}
+	var narrower []models.Subject
+	if err := cursor.All(ctx, &narrower); err != nil {
+		return models.SubjectNode{}, nil, err
+	}
+	ids := []bson.ObjectID{subject.ID}
+	for _, child := range narrower {
+		ids = append(ids, child.ID)
+	}
+	counts, err := subjectBookCounts(ctx, ids)
+	if err != nil {
+		return models.SubjectNode{}, nil, err
+	}
+	node := models.SubjectNode{Subject: subject, BookCount: counts[subject.ID], Children: []models.SubjectNode{}}
+	for _, child := range narrower {
+		node.Children = append(node.Children, models.SubjectNode{
+			Subject:   child,
+			BookCount: counts[child.ID],
+			Children:  []models.SubjectNode{},
+		})
+	}
+	return node, breadcrumb, nil
+}
+
+// subjectBookCounts counts the books filed under each subject or below it,
+// for the given subjects or all of them.
+func subjectBookCounts(ctx context.Context, ids []bson.ObjectID) (map[bson.ObjectID]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"subject_tree_ids.0": bson.M{"$exists": true}}}},
+		{{Key: "$unwind", Value: "$subject_tree_ids"}},
+	}
+	if ids != nil {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"subject_tree_ids": bson.M{"$in": ids}}}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$group", Value: bson.D{
+		{Key: "_id", Value: "$subject_tree_ids"},
+		{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+	}}})
+	cursor, err := config.GetBookCollection().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID    bson.ObjectID `bson:"_id"`
+		Count int64         `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[bson.ObjectID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.ID] = row.Count
+	}
+	return counts, nil
+}
+
+func containsID(ids []bson.ObjectID, id bson.ObjectID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+type SubjectReport struct {
+	Checked  int64    `json:"checked"`
+	Migrated int64    `json:"migrated"`
+	Subjects []string `json:"subjects"`
+}
+
+// MigrateSubjects files books saved before the vocabulary existed under
+// their genre and subjects. The headings they would add are listed; books
+// are only written when apply is set.
+func MigrateSubjects(ctx context.Context, apply bool) (SubjectReport, error) {
+	report := SubjectReport{Subjects: []string{}}
+	known := map[string]bool{}
+	cursor, err := config.GetSubjectCollection().Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"key": 1}))
+	if err != nil {
+		return report, err
+	}
+	var existing []models.Subject
+	if err := cursor.All(ctx, &existing); err != nil {
+		return report, err
+	}
+	for _, subject := range existing {
+		known[subject.Key] = true
+	}
+
+	collection := config.GetBookCollection()
+	cursor, err = collection.Find(ctx, bson.M{"subject_ids.0": bson.M{"$exists": false}})
+	if err != nil {
+		return report, err
+	}
+	defer cursor.Close(ctx)
+
+	var writes []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var book models.Book
+		if err := cursor.Decode(&book); err != nil {
+			return report, err
+		}
+		report.Checked++
+		names := append([]string{book.Genre}, book.Subjects...)
+		hasSubject := false
+		for _, name := range names {
+			key := SubjectKey(name)
+			if key == "" {
+				continue
+			}
+			hasSubject = true
+			if !known[key] {
+				known[key] = true
+				report.Subjects = append(report.Subjects, cleanSubjectName(name))
+			}
+		}
+		if !hasSubject {
+			continue
+		}
+		report.Migrated++
+		if !apply {
+			continue
+		}
+		fields, err := BookSubjects(ctx, names)
+		if err != nil {
+			return report, err
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": book.ID}).
+			SetUpdate(bson.M{"$set": fields}))
+	}
+	if err := cursor.Err(); err != nil {
+		return report, err
+	}
+	if len(writes) > 0 {
+		if _, err := collection.BulkWrite(ctx, writes); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
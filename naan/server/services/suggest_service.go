@@ -0,0 +1,254 @@
+package services
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const (
+	SuggestKindTitle  = "title"
+	SuggestKindAuthor = "author"
+	SuggestKindSeries = "series"
+
+	// suggestions are offered for the first few words of a phrase only,
+	// nobody types the sixth word of a title to find it
+	suggestMaxTokens = 6
+)
+
+var SuggestKinds = []string{SuggestKindTitle, SuggestKindAuthor, SuggestKindSeries}
+
+// suggestSources lists where each kind of suggestion is read from on a book.
+var suggestSources = map[string]func(models.Book) []string{
+	SuggestKindTitle: func(book models.Book) []string { return []string{book.Title} },
+	SuggestKindAuthor: func(book models.Book) []string {
+		if len(book.Contributors) == 0 {
+			return SplitAuthors(book.Author)
+		}
+		return ContributorNames(book.Contributors)
+	},
+	SuggestKindSeries: func(book models.Book) []string { return []string{book.Series} },
+}
+
+// Suggest returns up to limit suggestions of every kind where a word of the
+// phrase starts with prefix, most borrowed first.
+func Suggest(ctx context.Context, prefix string, limit int64) (map[string][]models.Suggestion, error) {
+	key := FoldText(prefix)
+	results := map[string][]models.Suggestion{}
+	if key == "" {
+		for _, kind := range SuggestKinds {
+			results[kind] = []models.Suggestion{}
+		}
+		return results, nil
+	}
+
+	collection := config.GetSuggestionCollection()
+	for _, kind := range SuggestKinds {
+		cursor, err := collection.Find(ctx, bson.M{
+			"kind":   kind,
+			"tokens": bson.Regex{Pattern: "^" + regexp.QuoteMeta(key)},
+		}, options.Find().
+			SetSort(bson.D{{Key: "popularity", Value: -1}, {Key: "book_count", Value: -1}, {Key: "key", Value: 1}}).
+			SetLimit(limit).
+			SetProjection(bson.M{"tokens": 0}))
+		if err != nil {
+			return nil, err
+		}
+		suggestions := []models.Suggestion{}
+		if err := cursor.All(ctx, &suggestions); err != nil {
+			return nil, err
+		}
+		results[kind] = suggestions
+	}
+	return results, nil
+}
+
+// RebuildSuggestions recomputes the suggestion index from the catalog, using
+// the number of loans in history as popularity.
+func RebuildSuggestions(ctx context.Context) error {
+	loans, err := loanCounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := config.GetBookCollection().Find(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	type entry struct {
+		models.Suggestion
+		bookIDs map[bson.ObjectID]bool
+	}
+	entries := map[string]*entry{}
+	for cursor.Next(ctx) {
+		var book models.Book
+		if err := cursor.Decode(&book); err != nil {
+			return err
+		}
+		for kind, source := range suggestSources {
+			for _, text := range source(book) {
+				key := FoldText(text)
+				if key == "" {
+					continue
+				}
+				e, ok := entries[kind+"\x00"+key]
+				if !ok {
+					e = &entry{
+						Suggestion: models.Suggestion{Kind: kind, Key: key, Text: strings.TrimSpace(text)},
+						bookIDs:    map[bson.ObjectID]bool{},
+					}
+					entries[kind+"\x00"+key] = e
+				}
+				if !e.bookIDs[book.ID] {
+					e.bookIDs[book.ID] = true
+					e.BookCount++
+					e.Popularity += loans[book.ID]
+				}
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	builtAt := time.Now()
+	writes := make([]mongo.WriteModel, 0, len(entries))
+	for _, e := range entries {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"kind": e.Kind, "key": e.Key}).
+			SetUpdate(bson.M{"$set": bson.M{
+				"text":       e.Text,
+				"tokens":     suggestTokens(e.Key),
+				"popularity": e.Popularity,
+				"book_count": e.BookCount,
+				"built_at":   builtAt,
+			}}).
+			SetUpsert(true))
+	}
+
+	collection := config.GetSuggestionCollection()
+	if len(writes) > 0 {
+		if _, err := collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return err
+		}
+	}
+	// anything not touched by this build belongs to books that are gone
+	_, err = collection.DeleteMany(ctx, bson.M{"built_at": bson.M{"$lt": builtAt}})
+	return err
+}
+
+// AddBookSuggestions makes a new or edited book suggestible right away,
+// popularity catches up on the next rebuild.
+func AddBookSuggestions(ctx context.Context, book models.Book) {
+	collection := config.GetSuggestionCollection()
+	for kind, source := range suggestSources {
+		for _, text := range source(book) {
+			key := FoldText(text)
+			if key == "" {
+				continue
+			}
+			_, err := collection.UpdateOne(ctx, bson.M{"kind": kind, "key": key}, bson.M{
+				"$setOnInsert": bson.M{
+					"text":       strings.TrimSpace(text),
+					"tokens":     suggestTokens(key),
+					"popularity": 0,
+					"book_count": 1,
+					"built_at":   time.Now(),
+				},
+			}, options.UpdateOne().SetUpsert(true))
+			if err != nil {
+				log.Printf("failed to add %s suggestion %q: %v", kind, key, err)
+			}
+		}
+	}
+}
+
+// StartSearchIndexRefresher rebuilds the suggestion index and the fuzzy
+// search vocabulary now and then every interval for as long as the server
+// runs.
+func StartSearchIndexRefresher(interval time.Duration) {
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			if err := RebuildSuggestions(ctx); err != nil {
+				log.Printf("⚠️ failed to rebuild suggestions: %v", err)
+			}
+			if err := RebuildVocabulary(ctx); err != nil {
+				log.Printf("⚠️ failed to rebuild search vocabulary: %v", err)
+			}
+			if err := SyncLoanCounts(ctx); err != nil {
+				log.Printf("⚠️ failed to sync loan counts: %v", err)
+			}
+			cancel()
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// SyncLoanCounts recomputes the loan_count used by the popularity sort from
+// history, which also backfills books created before the field existed.
+func SyncLoanCounts(ctx context.Context) error {
+	counts, err := loanCounts(ctx)
+	if err != nil {
+		return err
+	}
+	collection := config.GetBookCollection()
+	writes := make([]mongo.WriteModel, 0, len(counts)+1)
+	ids := make([]bson.ObjectID, 0, len(counts))
+	for id, count := range counts {
+		ids = append(ids, id)
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": id, "loan_count": bson.M{"$ne": count}}).
+			SetUpdate(bson.M{"$set": bson.M{"loan_count": count}}))
+	}
+	writes = append(writes, mongo.NewUpdateManyModel().
+		SetFilter(bson.M{"_id": bson.M{"$nin": ids}, "loan_count": bson.M{"$ne": 0}}).
+		SetUpdate(bson.M{"$set": bson.M{"loan_count": 0}}))
+	_, err = collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func loanCounts(ctx context.Context) (map[bson.ObjectID]int64, error) {
+	cursor, err := config.GetHistoryCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$book_id"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		BookID bson.ObjectID `bson:"_id"`
+		Count  int64         `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	counts := make(map[bson.ObjectID]int64, len(rows))
+	for _, row := range rows {
+		counts[row.BookID] = row.Count
+	}
+	return counts, nil
+}
+
+// suggestTokens lists the phrase starting at each of its first words, so
+// "the lord of the rings" can be found by typing "lord" or "rings".
+func suggestTokens(key string) []string {
+	words := strings.Fields(key)
+	tokens := make([]string, 0, suggestMaxTokens)
+	for i := 0; i < len(words) && i < suggestMaxTokens; i++ {
+		tokens = append(tokens, strings.Join(words[i:], " "))
+	}
+	return tokens
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var ErrTagName = errors.New("tag is required")
+
+// NormalizeTag lower cases a tag and collapses its spaces, so "Staff Pick"
+// and "staff  pick" are the same tag.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// NormalizeTags cleans a book's tags, dropping empty ones and repeats.
+func NormalizeTags(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag = NormalizeTag(tag); tag != "" && !containsString(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// ListTags returns every tag in use with the number of books carrying it.
+func ListTags(ctx context.Context) ([]models.TagCount, error) {
+	cursor, err := config.GetBookCollection().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$tags"},
+			{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	tags := []models.TagCount{}
+	err = cursor.All(ctx, &tags)
+	return tags, err
+}
+
+// TagBooks adds a tag to books, or takes it off them when remove is set.
+func TagBooks(ctx context.Context, tag string, bookIDs []bson.ObjectID, remove bool) (int64, error) {
+	if tag = NormalizeTag(tag); tag == "" {
+		return 0, ErrTagName
+	}
+	update := bson.M{"$addToSet": bson.M{"tags": tag}}
+	if remove {
+		update = bson.M{"$pull": bson.M{"tags": tag}}
+	}
+	result, err := config.GetBookCollection().UpdateMany(ctx, bson.M{"_id": bson.M{"$in": bookIDs}}, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// RenameTag renames a tag on every book. Renaming to a tag that is already
+// in use merges the two.
+func RenameTag(ctx context.Context, from, to string) (int64, error) {
+	from, to = NormalizeTag(from), NormalizeTag(to)
+	if from == "" || to == "" {
+		return 0, ErrTagName
+	}
+	if from == to {
+		return 0, nil
+	}
+	collection := config.GetBookCollection()
+	result, err := collection.UpdateMany(ctx, bson.M{"tags": from}, bson.M{"$addToSet": bson.M{"tags": to}})
+	if err != nil {
+		return 0, err
+	}
+	if _, err := collection.UpdateMany(ctx, bson.M{"tags": from}, bson.M{"$pull": bson.M{"tags": from}}); err != nil {
+		return 0, err
+	}
+	return result.MatchedCount, nil
+}
+
+// DeleteTag takes a tag off every book.
+func DeleteTag(ctx context.Context, tag string) (int64, error) {
+	if tag = NormalizeTag(tag); tag == "" {
+		return 0, ErrTagName
+	}
+	result, err := config.GetBookCollection().UpdateMany(ctx, bson.M{"tags": tag}, bson.M{"$pull": bson.M{"tags": tag}})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
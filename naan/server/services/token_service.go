@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/pranava-mohan/library-automation-pre/naan/config"
+	"github.com/pranava-mohan/library-automation-pre/naan/server/models"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	LoginCodeTTL    = time.Minute
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReuse   = errors.New("refresh token reused")
+	ErrInvalidLoginCode    = errors.New("invalid login code")
+)
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// SessionInfo is what gets recorded alongside a refresh token so that
+// sessions can be told apart.
+type SessionInfo struct {
+	UserAgent string
+	IP        string
+}
+
+func IssueAccessToken(userID, userType string) (string, error) {
+	claims := jwt.MapClaims{
+		"id":   userID,
+		"exp":  time.Now().Add(AccessTokenTTL).Unix(),
+		"type": userType,
+	}
+	return SignToken(claims)
+}
+
+// IssueTokenPair starts a new refresh token family for a fresh login.
+func IssueTokenPair(ctx context.Context, userID, userType string, session SessionInfo) (TokenPair, error) {
+	familyID, err := randomToken(16)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return issueInFamily(ctx, familyID, userID, userType, session)
+}
+
+// RotateRefreshToken exchanges a refresh token for a new pair. Each refresh
+// token can be used once; presenting one that was already rotated or revoked
+// means it leaked, so the whole family is revoked.
+func RotateRefreshToken(ctx context.Context, raw string, session SessionInfo) (TokenPair, error) {
+	collection := config.GetRefreshTokenCollection()
+	now := time.Now()
+
+	var current models.RefreshToken
+	err := collection.FindOneAndUpdate(ctx, bson.M{
+		"token_hash": hashToken(raw),
+		"rotated_at": bson.M{"$exists": false},
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}, bson.M{
+		"$set": bson.M{"rotated_at": now},
+	}).Decode(&current)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return TokenPair{}, detectReuse(ctx, raw)
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return issueInFamily(ctx, current.FamilyID, current.UserID, current.UserType, session)
+}
+
+// detectReuse works out why a refresh token was rejected and revokes its
+// family if it had already been spent.
+func detectReuse(ctx context.Context, raw string) error {
+	var token models.RefreshToken
+	err := config.GetRefreshTokenCollection().FindOne(ctx, bson.M{"token_hash": hashToken(raw)}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	if token.RotatedAt == nil && token.RevokedAt == nil {
+		// simply expired
+		return ErrInvalidRefreshToken
+	}
+	if err := revokeFamily(ctx, token.FamilyID); err != nil {
+		log.Printf("failed to revoke refresh token family %s: %v", token.FamilyID, err)
+	}
+	RecordAudit(models.AuditLog{
+		Action:    "refresh_token_reused",
+		ActorType: token.UserType,
+		ActorID:   token.UserID,
+		Details:   bson.M{"family_id": token.FamilyID},
+	})
+	return ErrRefreshTokenReuse
+}
+
+// RevokeRefreshToken ends the session the refresh token belongs to.
+func RevokeRefreshToken(ctx context.Context, raw string) error {
+	var token models.RefreshToken
+	err := config.GetRefreshTokenCollection().FindOne(ctx, bson.M{"token_hash": hashToken(raw)}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	return revokeFamily(ctx, token.FamilyID)
+}
+
+// RevokeAllRefreshTokens ends every session of the user. Access tokens that
+// are already out stay valid until they expire.
+func RevokeAllRefreshTokens(ctx context.Context, userID, userType string) (int64, error) {
+	result, err := config.GetRefreshTokenCollection().UpdateMany(ctx, bson.M{
+		"user_id":    userID,
+		"user_type":  userType,
+		"revoked_at": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func revokeFamily(ctx context.Context, familyID string) error {
+	_, err := config.GetRefreshTokenCollection().UpdateMany(ctx, bson.M{
+		"family_id":  familyID,
+		"revoked_at": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{"revoked_at": time.Now()},
+	})
+	return err
+}
+
+// IssueLoginCode stands in for the tokens on the redirect back to the app,
+// so they never end up in a URL. The code is short-lived and only good once.
+func IssueLoginCode(ctx context.Context, userID, userType string) (string, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, err = config.GetLoginCodeCollection().InsertOne(ctx, models.LoginCode{
+		CodeHash:  hashToken(raw),
+		UserID:    userID,
+		UserType:  userType,
+		CreatedAt: now,
+		ExpiresAt: now.Add(LoginCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// RedeemLoginCode spends a login code and starts the session it stands for.
+func RedeemLoginCode(ctx context.Context, raw string, session SessionInfo) (TokenPair, error) {
+	var code models.LoginCode
+	err := config.GetLoginCodeCollection().FindOneAndDelete(ctx, bson.M{
+		"code_hash":  hashToken(raw),
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&code)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return TokenPair{}, ErrInvalidLoginCode
+	}
+	if err != nil {
+		return TokenPair{}, err
+	}
+	return IssueTokenPair(ctx, code.UserID, code.UserType, session)
+}
+
+func issueInFamily(ctx context.Context, familyID, userID, userType string, session SessionInfo) (TokenPair, error) {
+	accessToken, err := IssueAccessToken(userID, userType)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	raw, err := randomToken(32)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	now := time.Now()
+	_, err = config.GetRefreshTokenCollection().InsertOne(ctx, models.RefreshToken{
+		TokenHash: hashToken(raw),
+		FamilyID:  familyID,
+		UserID:    userID,
+		UserType:  userType,
+		CreatedAt: now,
+		ExpiresAt: now.Add(RefreshTokenTTL),
+		UserAgent: session.UserAgent,
+		IP:        session.IP,
+	})
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: raw,
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+	}, nil
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// only the hash is stored so a database dump does not hand out sessions
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func SessionFromRequest(c *fiber.Ctx) SessionInfo {
+	return SessionInfo{
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		IP:        c.IP(),
+	}
+}
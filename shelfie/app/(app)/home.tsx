@@ -3,10 +3,13 @@ import { StyleSheet, View, TextInput, TouchableOpacity, Text } from "react-nativ
 import { SafeAreaView } from "react-native-safe-area-context";
 import { useState } from "react";
 import { normalize } from "@/core/normalize";
+import { useSuggestions } from "@/core/hooks/useSuggestions";
 
 export default function ExploreScreen() {
   const [search, setSearch] = useState("");
   const [showFilters, setShowFilters] = useState(false);
+  const [typing, setTyping] = useState(false);
+  const { data: suggestions } = useSuggestions(typing ? search : "");
   const [filters, setFilters] = useState({
     genre: "",
     author: "",
@@ -23,8 +26,29 @@ export default function ExploreScreen() {
           style={styles.input}
           placeholder="Search books..."
           value={search}
-          onChangeText={setSearch}
+          onChangeText={(text) => {
+            setSearch(text);
+            setTyping(true);
+          }}
+          onSubmitEditing={() => setTyping(false)}
         />
+        {typing && suggestions && suggestions.length > 0 && (
+          <View style={styles.suggestions}>
+            {suggestions.map((suggestion) => (
+              <TouchableOpacity
+                key={`${suggestion.kind}-${suggestion.text}`}
+                style={styles.suggestion}
+                onPress={() => {
+                  setSearch(suggestion.text);
+                  setTyping(false);
+                }}
+              >
+                <Text style={styles.suggestionText}>{suggestion.text}</Text>
+                <Text style={styles.suggestionKind}>{suggestion.kind}</Text>
+              </TouchableOpacity>
+            ))}
+          </View>
+        )}
         <TouchableOpacity
           style={styles.filterButton}
           onPress={() => setShowFilters(!showFilters)}
@@ -104,5 +128,26 @@ const styles = StyleSheet.create({
   filtersContainer: {
     marginTop: normalize(10),
   },
+  suggestions: {
+    backgroundColor: "#ffffff",
+    borderRadius: normalize(8),
+    borderWidth: 1,
+    borderColor: "#e2e8f0",
+    marginBottom: normalize(10),
+  },
+  suggestion: {
+    flexDirection: "row",
+    justifyContent: "space-between",
+    padding: normalize(10),
+  },
+  suggestionText: {
+    color: "#1A202C",
+    flexShrink: 1,
+  },
+  suggestionKind: {
+    color: "#718096",
+    fontSize: normalize(12),
+    marginLeft: normalize(8),
+  },
 });
 
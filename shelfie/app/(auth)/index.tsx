@@ -6,8 +6,9 @@ import { Pressable, Text, View } from "react-native";
 import * as Linking from "expo-linking";
 import * as WebBrowser from "expo-web-browser";
 import { useEffect } from "react";
+import axios from "axios";
 import { useAuth } from "@/core/hooks/useAuth";
-import { AUTH } from "@/config";
+import { API, AUTH } from "@/config";
 
 export default function Index() {
   const router = useRouter();
@@ -16,9 +17,16 @@ export default function Index() {
   const handleDeepLink = async (event: any) => {
     let { queryParams } = Linking.parse(event.url);
 
-    if (queryParams?.token) {
-      await login(queryParams?.token as string);
-      router.replace("/(app)/home");
+    if (queryParams?.login_code) {
+      try {
+        const { data } = await axios.post(`${API.BASE_URL}/auth/exchange`, {
+          login_code: queryParams.login_code as string,
+        });
+        await login(data.token, data.refresh_token);
+        router.replace("/(app)/home");
+      } catch (e: any) {
+        alert("Login failed: " + (e.response?.data?.error || String(e)));
+      }
     }
   };
 
@@ -40,7 +48,11 @@ export default function Index() {
     try {
       const redirectUrl = Linking.createURL("auth");
       if (!AUTH.GOOGLE_URL) throw new Error("Google Auth URL is not defined");
-      await WebBrowser.openAuthSessionAsync(AUTH.GOOGLE_URL, redirectUrl);
+      // naan sends a one-time login code back to this deep link once login completes
+      const loginUrl = `${AUTH.GOOGLE_URL}?redirect_uri=${encodeURIComponent(
+        redirectUrl
+      )}`;
+      await WebBrowser.openAuthSessionAsync(loginUrl, redirectUrl);
     } catch (e: any) {
       alert("Error opening browser: " + (e.message || String(e)));
     }
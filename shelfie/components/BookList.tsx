@@ -20,6 +20,35 @@ interface BookListProps {
     };
 }
 
+type HighlightSegment = { text: string; match: boolean };
+
+// renders the search highlights from naan, falling back to the plain value
+const Highlighted = ({
+    value,
+    segments,
+    style,
+}: {
+    value: string;
+    segments?: HighlightSegment[];
+    style: any;
+}) => {
+    if (!segments) {
+        return <Text style={style}>{value}</Text>;
+    }
+    return (
+        <Text style={style}>
+            {segments.map((segment, index) => (
+                <Text
+                    key={index}
+                    style={segment.match ? styles.match : undefined}
+                >
+                    {segment.text}
+                </Text>
+            ))}
+        </Text>
+    );
+};
+
 export const BookList = ({ filters }: BookListProps) => {
     const {
         data,
@@ -32,19 +61,32 @@ export const BookList = ({ filters }: BookListProps) => {
     } = useBooks(filters);
 
     const books = data?.pages.flatMap((page) => page.data) || [];
+    const didYouMean = data?.pages[0]?.did_you_mean;
 
     const renderItem = ({ item }: { item: any }) => (
         <View style={styles.card}>
             <View style={styles.bookInfo}>
-                <Text style={styles.title}>{item.title}</Text>
-                <Text style={styles.author}>{item.author}</Text>
+                <Highlighted
+                    style={styles.title}
+                    value={item.title}
+                    segments={item.highlights?.title}
+                />
+                <Highlighted
+                    style={styles.author}
+                    value={item.author}
+                    segments={item.highlights?.author}
+                />
                 <Text style={styles.publisher}>{item.publisher}</Text>
 
                 <Text style={styles.genre}>Genre: {item.genre}</Text>
             </View>
             <View style={styles.locationContainer}>
                 <Text style={styles.locationLabel}>Location</Text>
-                <Text style={styles.location}>{item.shelf_address}</Text>
+                <Text style={styles.location}>
+                    {item.location_path?.length
+                        ? item.location_path.map((crumb: { name: string }) => crumb.name).join(' › ')
+                        : item.shelf_address}
+                </Text>
                 <Text style={styles.location}>Row: {item.row}, Col: {item.column}</Text>
             </View>
         </View>
@@ -69,6 +111,11 @@ export const BookList = ({ filters }: BookListProps) => {
 
     return (
         <View style={styles.container}>
+            {didYouMean && (
+                <Text style={styles.didYouMean}>
+                    Showing results for <Text style={styles.match}>{didYouMean}</Text>
+                </Text>
+            )}
 
             <FlatList
                 data={books}
@@ -94,6 +141,14 @@ export const BookList = ({ filters }: BookListProps) => {
 };
 
 const styles = StyleSheet.create({
+    match: {
+        backgroundColor: "#fff3a3",
+    },
+    didYouMean: {
+        paddingHorizontal: normalize(16),
+        paddingTop: normalize(8),
+        color: "#4a5568",
+    },
     container: {
         flex: 1,
         backgroundColor: "#F5F7FA",
@@ -4,11 +4,20 @@ import {
   setUserInfo,
 } from "@/core/store/authSlice";
 import { useAppDispatch } from "@/core/store/store";
-import { getToken, removeToken, saveToken } from "@/core/tokenStorage";
+import {
+  getRefreshToken,
+  getToken,
+  removeToken,
+  saveRefreshToken,
+  saveToken,
+} from "@/core/tokenStorage";
 import { jwtDecode } from "jwt-decode";
 import axios from "axios";
 import { API } from "@/config";
 
+// refresh tokens are single use, so concurrent 401s must share one refresh
+let refreshInFlight: Promise<string | null> | null = null;
+
 export const useAuth = () => {
   const dispatch = useAppDispatch();
 
@@ -31,8 +40,11 @@ export const useAuth = () => {
     }
   }
 
-  async function login(token: string) {
+  async function login(token: string, refreshToken?: string) {
     await saveToken(token);
+    if (refreshToken) {
+      await saveRefreshToken(refreshToken);
+    }
     const payload: any = jwtDecode(token);
     const adminStatus = (payload.admin as boolean) || false;
     const userID = payload.id as string;
@@ -41,7 +53,37 @@ export const useAuth = () => {
     fetchProfile(token);
   }
 
+  async function refresh(): Promise<string | null> {
+    if (!refreshInFlight) {
+      refreshInFlight = (async () => {
+        const refreshToken = await getRefreshToken();
+        if (refreshToken == null) {
+          return null;
+        }
+        try {
+          const { data } = await axios.post(`${API.BASE_URL}/auth/refresh`, {
+            refresh_token: refreshToken,
+          });
+          await login(data.token, data.refresh_token);
+          return data.token as string;
+        } catch (error) {
+          console.log("Error refreshing session:", error);
+          return null;
+        }
+      })().finally(() => {
+        refreshInFlight = null;
+      });
+    }
+    return refreshInFlight;
+  }
+
   async function logout() {
+    const refreshToken = await getRefreshToken();
+    if (refreshToken != null) {
+      axios
+        .post(`${API.BASE_URL}/auth/logout`, { refresh_token: refreshToken })
+        .catch((error) => console.log("Error logging out:", error));
+    }
     await removeToken();
     dispatch(logoutSuccess());
   }
@@ -65,8 +107,12 @@ export const useAuth = () => {
         fetchProfile(token);
         return [true, token];
       } else {
-        await removeToken();
-        return [false, null];
+        const refreshed = await refresh();
+        if (refreshed == null) {
+          await removeToken();
+          return [false, null];
+        }
+        return [true, refreshed];
       }
     }
   }
@@ -75,5 +121,6 @@ export const useAuth = () => {
     check,
     login,
     logout,
+    refresh,
   };
 };
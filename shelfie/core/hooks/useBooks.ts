@@ -1,44 +1,70 @@
 import { useInfiniteQuery } from "@tanstack/react-query";
 import { useClient } from "./useClient";
 
+export type ContributorRole = "author" | "editor" | "translator" | "illustrator";
+
+interface Contributor {
+    author_id?: string;
+    name: string;
+    role: ContributorRole;
+}
+
 interface Book {
     _id: string; // Assuming ObjectId is hex string
     title: string;
     author: string;
+    contributors?: Contributor[];
+    series?: string;
+    series_number?: number;
     publisher: string;
     isbn: string;
     shelf_id: string;
     row: number;
     column: number;
     shelf_address: string;
+    location_path?: { id: string; kind: string; name: string }[];
     added_at: string;
     genre: string;
+    subjects?: string[];
+    tags?: string[];
+    call_number?: string;
+    cover_urls?: Record<string, string>;
+    loan_count: number;
+    score?: number;
+    highlights?: Record<string, { text: string; match: boolean }[]>;
 }
 
 interface FetchBooksResponse {
     data: Book[];
     meta: {
-        total: number;
-        page: number;
-        last_page: number;
         limit: number;
+        sort: BookSort;
+        next_cursor?: string;
+        total?: number;
     };
+    did_you_mean?: string;
 }
 
+export type BookSort = "title" | "author" | "added_at" | "popularity" | "relevance" | "series_number" | "call_number";
+
 interface UseBooksParams {
     genre?: string;
     author?: string;
+    series?: string;
+    subject?: string; // subject ID, narrower subjects included
+    tag?: string;
     publisher?: string;
     shelf_id?: string;
     search?: string;
+    sort?: BookSort;
 }
 
 export const useBooks = (filters: UseBooksParams = {}) => {
     const { client } = useClient();
 
-    const fetchBooks = async ({ pageParam = 1 }) => {
+    const fetchBooks = async ({ pageParam }: { pageParam?: string }) => {
         const { data } = await client.post<FetchBooksResponse>("/book/all", {
-            page: pageParam,
+            cursor: pageParam,
             limit: 10,
             available_only: true,
             ...filters
@@ -49,12 +75,7 @@ export const useBooks = (filters: UseBooksParams = {}) => {
     return useInfiniteQuery({
         queryKey: ["books", filters],
         queryFn: fetchBooks,
-        getNextPageParam: (lastPage) => {
-            if (lastPage.meta.page < lastPage.meta.last_page) {
-                return lastPage.meta.page + 1;
-            }
-            return undefined;
-        },
-        initialPageParam: 1,
+        getNextPageParam: (lastPage) => lastPage.meta.next_cursor,
+        initialPageParam: undefined as string | undefined,
     });
 };
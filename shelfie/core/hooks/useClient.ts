@@ -1,9 +1,11 @@
 import { API } from "@/config";
 import axios from "axios";
 import { useAppSelector } from "../store/store";
+import { useAuth } from "./useAuth";
 
 export const useClient = () => {
   const token = useAppSelector((state) => state.auth.token);
+  const { refresh, logout } = useAuth();
 
   const authHeaders = token
     ? {
@@ -18,5 +20,20 @@ export const useClient = () => {
     },
   });
 
+  client.interceptors.response.use(undefined, async (error) => {
+    const original = error.config;
+    if (error.response?.status !== 401 || original?._retried) {
+      throw error;
+    }
+    original._retried = true;
+    const newToken = await refresh();
+    if (newToken == null) {
+      await logout();
+      throw error;
+    }
+    original.headers.Authorization = `Bearer ${newToken}`;
+    return client(original);
+  });
+
   return { client };
 };
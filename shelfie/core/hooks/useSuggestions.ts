@@ -0,0 +1,29 @@
+import { useQuery } from "@tanstack/react-query";
+import { useClient } from "./useClient";
+
+export interface Suggestion {
+    kind: "title" | "author" | "series";
+    text: string;
+    popularity: number;
+    book_count: number;
+}
+
+type SuggestResponse = Record<Suggestion["kind"], Suggestion[]>;
+
+export const useSuggestions = (query: string, limit = 5) => {
+    const { client } = useClient();
+    const q = query.trim();
+
+    return useQuery({
+        queryKey: ["suggestions", q, limit],
+        queryFn: async () => {
+            const { data } = await client.get<SuggestResponse>("/book/suggest", {
+                params: { q, limit },
+            });
+            return [...data.title, ...data.author, ...data.series];
+        },
+        enabled: q.length >= 2,
+        staleTime: 60 * 1000,
+        placeholderData: (previous) => previous,
+    });
+};
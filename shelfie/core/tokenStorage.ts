@@ -1,6 +1,7 @@
 import * as SecureStore from "expo-secure-store";
 
 const TOKEN_KEY = "auth-token";
+const REFRESH_TOKEN_KEY = "auth-refresh-token";
 
 export const saveToken = async (token: string): Promise<void> => {
   try {
@@ -22,7 +23,25 @@ export const getToken = async (): Promise<string | null> => {
 export const removeToken = async (): Promise<void> => {
   try {
     await SecureStore.deleteItemAsync(TOKEN_KEY);
+    await SecureStore.deleteItemAsync(REFRESH_TOKEN_KEY);
   } catch (error) {
     console.error("Error removing the token", error);
   }
 };
+
+export const saveRefreshToken = async (token: string): Promise<void> => {
+  try {
+    await SecureStore.setItemAsync(REFRESH_TOKEN_KEY, token);
+  } catch (error) {
+    console.error("Error saving the refresh token", error);
+  }
+};
+
+export const getRefreshToken = async (): Promise<string | null> => {
+  try {
+    return await SecureStore.getItemAsync(REFRESH_TOKEN_KEY);
+  } catch (error) {
+    console.error("Error getting the refresh token", error);
+    return null;
+  }
+};